@@ -5,18 +5,32 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/CanadianCommander/gopherproxy/cmd/gopherproxyclient/proxy"
 	"github.com/CanadianCommander/gopherproxy/internal/proxcom"
 )
 
 type CliArgs struct {
 	ProxyUrl          url.URL
 	Password          string
+	Token             string
 	Channel           string
 	ClientName        string
 	Debug             bool
 	DebugPrintPackets bool
 	LoggingBasedUi    bool
+	LegacyEncoding    bool
+	Compress          bool
+	RequireEncryption bool
+	HeartbeatInterval time.Duration
+	HeartbeatTimeout  time.Duration
+	CaCertFile        string
+	CertFile          string
+	KeyFile           string
+	Lanes             int
+	Exposure          proxy.ExposurePolicy
 	Command           string
 	ForwardingRules   []*proxcom.ForwardingRule
 }
@@ -29,13 +43,30 @@ type CliArgs struct {
 func ParseArgs() CliArgs {
 	setupHelpMessage()
 
-	proxyUrlStr := flag.String("proxy", "wss://localhost", "The URL of the GopherProxy instance")
+	proxyUrlStr := flag.String("proxy", "wss://localhost", "The URL of the GopherProxy instance. Use a gopher+tls:// URL to connect over raw TLS instead of a websocket.")
 	password := flag.String("password", "", "The password to use for the proxy connection")
+	token := flag.String("token", "", "An access token issued by the proxy server operator, or a JWT from the identity provider the server trusts. Used instead of --password.")
 	channel := flag.String("channel", "", "The channel to connect to. Use the same channel name on both ends of the connection.")
 	clientName := flag.String("name", "", "The name of the client connecting to the proxy. Use this to organize clients. Defaults to the hostname of the machine.")
 	debug := flag.Bool("debug", false, "Enable debug logging")
 	debugPrintPackets := flag.Bool("debug-packets", false, "Enable debug logging of packets")
 	loggingUi := flag.Bool("logging-ui", false, "Enable the logging based UI. This \"UI\" produces output easily parsable by other applications.")
+	compress := flag.Bool("compress", false, "Compress data on all forwarding rules. Individual rules can also enable compression with the \",compress\" option.")
+	requireEncryption := flag.Bool("require-encryption", false, "Refuse socket channels with channel members that cannot end to end encrypt traffic.")
+	heartbeatInterval := flag.Duration("heartbeat-interval", 0, "How often to ping the proxy server. Defaults to 10s.")
+	heartbeatTimeout := flag.Duration("heartbeat-timeout", 0, "How long the proxy server may stay silent before the connection is considered dead and re-established. Defaults to 30s.")
+	caCertFile := flag.String("ca-cert", "", "PEM file of the certificate authority to trust for the proxy server certificate, instead of the system roots.")
+	certFile := flag.String("cert", "", "PEM client certificate to authenticate with, if the proxy server accepts client certificates. Used instead of --password.")
+	keyFile := flag.String("key", "", "PEM private key of the client certificate.")
+	lanes := flag.Int("lanes", 1, "Stripe forwarded connections over this many parallel connections to the proxy server. Helps when a single connection is throttled. The server may grant fewer.")
+	var exposeRules []string
+	flag.Func("expose", "Let other members reach a target through this client: [member@]host[:port[-port]]. Host may be a hostname, *.domain, an IP, a CIDR or unix:<path>. Repeatable.", func(value string) error {
+		exposeRules = append(exposeRules, value)
+		return nil
+	})
+	exposeFile := flag.String("expose-file", "", "File with one --expose rule per line. Lines starting with # are ignored.")
+	exposeStrict := flag.Bool("expose-strict", false, "Deny other members every target not allowed by --expose. Without it targets that are not exposed are allowed, but reported.")
+	legacyEncoding := flag.Bool("legacy-encoding", false, "Use the legacy gob packet encoding. Only needed to talk to old GopherProxy servers.")
 
 	flag.Parse()
 	if flag.NArg() == 0 {
@@ -57,6 +88,27 @@ func ParseArgs() CliArgs {
 		panic("The url provided for --proxy could not be parsed. Please provide a valid URL. --help for more information.")
 	}
 
+	if *exposeFile != "" {
+		contents, err := os.ReadFile(*exposeFile)
+		if err != nil {
+			panic("Could not read --expose-file: " + err.Error())
+		}
+		for _, line := range strings.Split(string(contents), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				exposeRules = append(exposeRules, line)
+			}
+		}
+	}
+	exposure := proxy.ExposurePolicy{Strict: *exposeStrict}
+	for _, spec := range exposeRules {
+		rule, err := proxy.ParseExposureRule(spec)
+		if err != nil {
+			panic(err.Error() + ". Type --help for more information.")
+		}
+		exposure.Rules = append(exposure.Rules, rule)
+	}
+
 	if *clientName == "" {
 		hostname, err := os.Hostname()
 		if err != nil {
@@ -69,6 +121,7 @@ func ParseArgs() CliArgs {
 	cliArgs := CliArgs{
 		ProxyUrl:          *proxyUrl,
 		Password:          *password,
+		Token:             *token,
 		Channel:           *channel,
 		ClientName:        *clientName,
 		Debug:             *debug,
@@ -76,6 +129,16 @@ func ParseArgs() CliArgs {
 		Command:           command,
 		ForwardingRules:   forwardingRules,
 		LoggingBasedUi:    *loggingUi,
+		LegacyEncoding:    *legacyEncoding,
+		Compress:          *compress,
+		RequireEncryption: *requireEncryption,
+		HeartbeatInterval: *heartbeatInterval,
+		HeartbeatTimeout:  *heartbeatTimeout,
+		CaCertFile:        *caCertFile,
+		CertFile:          *certFile,
+		KeyFile:           *keyFile,
+		Lanes:             *lanes,
+		Exposure:          exposure,
 	}
 
 	validateArgs(cliArgs)
@@ -87,12 +150,18 @@ func ParseArgs() CliArgs {
 // ============================================
 
 func validateArgs(args CliArgs) {
-	if args.Password == "" {
-		panic("You must provide a password to connect to the proxy. Type --help for more information.")
+	if args.Password == "" && args.Token == "" && args.CertFile == "" {
+		panic("You must provide a password, token or client certificate to connect to the proxy. Type --help for more information.")
+	}
+	if (args.CertFile == "") != (args.KeyFile == "") {
+		panic("--cert and --key must be provided together. Type --help for more information.")
 	}
 	if args.Channel == "" {
 		panic("You must provide a channel to connect to. Type --help for more information.")
 	}
+	if args.Lanes < 1 {
+		panic("--lanes must be at least 1. Type --help for more information.")
+	}
 }
 
 func setupHelpMessage() {
@@ -103,12 +172,18 @@ func setupHelpMessage() {
 		fmt.Println("  start   Start the client and forward traffic as defined by the forward definitions")
 		fmt.Println("Forward Defninition:")
 		fmt.Println("  <forward definition> defines how traffic should be proxied. It can appear multiple times. It has the following format:")
-		fmt.Println("  <local port>:<remote client>:[remote host]:<remote port>")
-		fmt.Println("    - local port: The port on the local machine to listen on")
+		fmt.Println("  [protocol/]<local port>:<remote client>:[remote host]:<remote port>[,option...]")
+		fmt.Println("    - [optional] protocol: tcp or udp. Defaults to tcp.")
+		fmt.Println("    - local port: The port on the local machine to listen on, or unix:<path> to listen on a unix socket")
 		fmt.Println("    - remote client: The name of the remote client to forward traffic to. Use the \"list\" command to see available clients.")
 		fmt.Println("    - [optional] remote host: The host to forward traffic to on the remote client. Defaults to localhost.")
-		fmt.Println("    - remote port: The port to forward traffic to on the remote target.")
+		fmt.Println("    - remote port: The port to forward traffic to on the remote target, or unix:<path> (without a remote host) to connect to a unix socket.")
+		fmt.Println("    - [optional] options: comma separated rule options.")
+		fmt.Println("        compress: compress traffic for this rule. Payloads that do not compress are sent as is.")
+		fmt.Println("        mode=<octal>: permissions of the local unix socket. Defaults to 0600.")
 		fmt.Println("  Example: 8080:client1:google.com:80 - Forward traffic on local port 8080 to google.com:80 from client1")
+		fmt.Println("  Example: udp/5353:client1:10.0.0.2:53 - Forward udp datagrams on local port 5353 to 10.0.0.2:53 from client1")
+		fmt.Println("  Example: unix:/tmp/docker.sock:client1:unix:/var/run/docker.sock - Reach the docker daemon of client1 through /tmp/docker.sock")
 		fmt.Println("Options:")
 		flag.PrintDefaults()
 	}
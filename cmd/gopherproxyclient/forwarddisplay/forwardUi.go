@@ -124,7 +124,14 @@ func (ui *ForwardUi) updateFowardRulesTable() {
 
 	for idx, rule := range forwardingRules {
 		builder := strings.Builder{}
-		fmt.Fprintf(&builder, "  %d -> %s -> %s:%d", rule.LocalPort, rule.RemoteClient, rule.RemoteHost, rule.RemotePort)
+		fmt.Fprintf(&builder, "  %s -> %s -> %s", rule.LocalAddress(), rule.RemoteClient, rule.RemoteAddress())
+
+		if rule.IsUdp() {
+			builder.WriteString(" (udp)")
+		}
+		if rule.Compress {
+			builder.WriteString(" (compressed)")
+		}
 
 		str := builder.String()
 		if !rule.Valid {
@@ -146,7 +153,10 @@ func (ui *ForwardUi) updateFowardRulesTable() {
 
 		for idx, rule := range incomingRules {
 			builder := strings.Builder{}
-			fmt.Fprintf(&builder, "  %s:%d <- %s <- %d", rule.RemoteHost, rule.RemotePort, rule.RemoteClient, rule.LocalPort)
+			fmt.Fprintf(&builder, "  %s <- %s <- %s", rule.RemoteAddress(), rule.RemoteClient, rule.LocalAddress())
+			if rule.IsUdp() {
+				builder.WriteString(" (udp)")
+			}
 			str := builder.String()
 			if !rule.Valid {
 				str = "[red]" + str + " (offline)[-]"
@@ -160,12 +170,19 @@ func (ui *ForwardUi) updateFowardRulesTable() {
 }
 
 func (ui *ForwardUi) updateClientsList() {
+	// the server may have assigned us another name than the one we asked for
+	ui.clientList.SetTitle("Channel Clients - joined as " + ui.clientManager.Client.Settings.Name)
+
 	for idx, client := range ui.clientManager.StateManager.ChannelMembers {
 
 		secondaryText := "Remote"
 		if ui.clientManager.Client != nil && client.Id == ui.clientManager.Client.Id {
 			secondaryText = "You"
 		}
+		secondaryText = fmt.Sprintf("%s - protocol v%d", secondaryText, client.ProtocolVersion)
+		if len(client.Capabilities) > 0 {
+			secondaryText += fmt.Sprintf(" %v", client.Capabilities)
+		}
 
 		if idx < ui.clientList.GetItemCount() {
 			ui.clientList.SetItemText(idx, client.Name, secondaryText)
@@ -187,6 +204,11 @@ func (ui *ForwardUi) updateClientsList() {
 func (ui *ForwardUi) updateAlerts() {
 	builder := strings.Builder{}
 
+	if ui.clientManager.Client.Suspended() {
+		// local connections are held open while we try to resume the session
+		builder.WriteString("📡 Connection Lost, Resuming Session... ")
+	}
+
 	if ui.clientManager.NotificationString != "" {
 		fmt.Fprintf(&builder, "❗ %s", ui.clientManager.NotificationString)
 
@@ -220,5 +242,25 @@ func (ui *ForwardUi) updateMetrics() {
 		fmt.Fprintf(&builder, "Rx: %d B", Rx)
 	}
 
+	ratio := ui.clientManager.SocketManager.CompressionRatio()
+	if ratio > 0 {
+		fmt.Fprintf(&builder, " Zip: %.1fx", ratio)
+	}
+
+	encrypted, total := ui.clientManager.SocketManager.EncryptionStats()
+	if total > 0 {
+		fmt.Fprintf(&builder, " E2E: %d/%d", encrypted, total)
+	}
+
+	rtt := ui.clientManager.Client.RoundTripTime()
+	if rtt > 0 {
+		fmt.Fprintf(&builder, " RTT: %dms", rtt.Milliseconds())
+	}
+
+	lanes := ui.clientManager.Client.Lanes()
+	if lanes > 1 {
+		fmt.Fprintf(&builder, " Lanes: %d", lanes)
+	}
+
 	ui.metrics.SetText(builder.String())
 }
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"os"
 
@@ -21,11 +24,29 @@ func main() {
 		logging.CreateLogger(zap.ErrorLevel)
 	}
 
+	encoding := proxylib.BinaryEncoding
+	if cliArgs.LegacyEncoding {
+		encoding = proxylib.GobEncoding
+	}
+
+	tlsConfig, err := newTlsConfig(cliArgs.CaCertFile, cliArgs.CertFile, cliArgs.KeyFile)
+	if err != nil {
+		fmt.Print("Failed to load the tls certificates")
+		panic(err)
+	}
+
 	// Create a new GopherProxyClient
 	client, err := proxylib.NewOutgoingSocket(cliArgs.ProxyUrl, proxylib.ProxyClientSettings{
 		Channel:  cliArgs.Channel,
 		Password: cliArgs.Password,
+		Token:    cliArgs.Token,
 		Name:     cliArgs.ClientName,
+		Encoding: encoding,
+		// heartbeat
+		HeartbeatInterval: cliArgs.HeartbeatInterval,
+		HeartbeatTimeout:  cliArgs.HeartbeatTimeout,
+		TlsConfig:         tlsConfig,
+		Lanes:             cliArgs.Lanes,
 	})
 
 	if err != nil {
@@ -33,7 +54,12 @@ func main() {
 		panic(err)
 	}
 
-	clientManager := proxy.NewClientManager(client, cliArgs.ForwardingRules, cliArgs.ProxyUrl, cliArgs.DebugPrintPackets)
+	clientManager := proxy.NewClientManager(client, cliArgs.ForwardingRules, cliArgs.ProxyUrl, proxy.ClientSettings{
+		DebugPackets:      cliArgs.DebugPrintPackets,
+		Compress:          cliArgs.Compress,
+		RequireEncryption: cliArgs.RequireEncryption,
+		Exposure:          cliArgs.Exposure,
+	})
 	clientManager.Start()
 	clientManager.WaitForInitialization()
 
@@ -63,13 +89,42 @@ func main() {
 	clientManager.Close()
 }
 
+// newTlsConfig builds the tls settings used to connect to the proxy server
+// @param caCertFile: PEM file of the certificate authorities to trust. Empty uses the system roots
+// @param certFile, keyFile: PEM client certificate and key to authenticate with. Empty to not present one
+func newTlsConfig(caCertFile string, certFile string, keyFile string) (*tls.Config, error) {
+	if caCertFile == "" && certFile == "" {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{}
+
+	if caCertFile != "" {
+		pem, err := os.ReadFile(caCertFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in " + caCertFile)
+		}
+	}
+	if certFile != "" {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
+
 func listChannelMembers(channel string, clientManager *proxy.ClientManager) {
 	fmt.Printf("================ Clients On Channel [%s] ================\n", channel)
 	for _, member := range clientManager.StateManager.ChannelMembers {
 		if member.Id == clientManager.Client.Id {
-			fmt.Printf("  %s (You)\n", member.Name)
+			fmt.Printf("  %s (You) %s\n", member.Name, member.Identity)
 		} else {
-			fmt.Printf("  %s \n", member.Name)
+			fmt.Printf("  %s %s\n", member.Name, member.Identity)
 		}
 	}
 }
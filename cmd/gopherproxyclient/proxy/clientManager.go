@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"crypto/ecdh"
 	"net/url"
 	"os"
 	"os/signal"
@@ -20,6 +21,9 @@ type ClientManager struct {
 	Initialized     bool
 	ForwardingRules []*proxcom.ForwardingRule
 	ProxyUrl        url.URL
+	Settings        ClientSettings
+	// ephemeral key pair used for end to end encryption of socket channels
+	KeyPair *ecdh.PrivateKey
 
 	// NotificationString is displayed to the user
 	// at the bottom of the panel. put error messages here.
@@ -32,15 +36,22 @@ type ClientManager struct {
 // ============================================
 
 // NewClientManager creates a new client manager
-func NewClientManager(client *proxy.ProxyClient, forwardingRules []*proxcom.ForwardingRule, proxyUrl url.URL, debugPackets bool) *ClientManager {
+func NewClientManager(client *proxy.ProxyClient, forwardingRules []*proxcom.ForwardingRule, proxyUrl url.URL, settings ClientSettings) *ClientManager {
+	keyPair, err := proxy.NewKeyPair()
+	if err != nil {
+		panic(err)
+	}
+
 	clientManager := ClientManager{
 		Client:          client,
 		Initialized:     false,
 		ForwardingRules: forwardingRules,
 		ProxyUrl:        proxyUrl,
+		Settings:        settings,
+		KeyPair:         keyPair,
 	}
 	clientManager.StateManager = NewStateManager(&clientManager)
-	clientManager.SocketManager = NewSocketManager(&clientManager, debugPackets)
+	clientManager.SocketManager = NewSocketManager(&clientManager)
 	return &clientManager
 }
 
@@ -51,7 +62,7 @@ func NewClientManager(client *proxy.ProxyClient, forwardingRules []*proxcom.Forw
 // Start starts the client manager
 func (manager *ClientManager) Start() {
 	go messageProcessingLoop(manager, manager.Client)
-	createSigtermHandler(manager.Client)
+	createSigtermHandler(manager)
 }
 
 // Close closes the client manager
@@ -88,6 +99,9 @@ func (manager *ClientManager) GetChannelMemberInfo() *proxcom.ChannelMember {
 		Id:              manager.Client.Id,
 		Name:            manager.Client.Settings.Name,
 		ForwardingRules: manager.ForwardingRules,
+		ProtocolVersion: manager.Client.ProtocolVersion,
+		Capabilities:    manager.Client.Capabilities,
+		PublicKey:       manager.KeyPair.PublicKey().Bytes(),
 	}
 }
 
@@ -134,7 +148,7 @@ func (manager *ClientManager) ReconnectToProxyServer() {
 	manager.Initialized = false
 	manager.SocketManager.Close()
 	manager.StateManager = NewStateManager(manager)
-	manager.SocketManager = NewSocketManager(manager, false)
+	manager.SocketManager = NewSocketManager(manager)
 
 	clientSettings := manager.Client.Settings
 	for {
@@ -181,15 +195,28 @@ func (manager *ClientManager) handleData(client *proxy.ProxyClient, packet proxy
 }
 
 func (manager *ClientManager) handleError(client *proxy.ProxyClient, packet proxy.Packet) {
+	errorPacket := proxy.DecodeErrorPacket(&packet)
 	logging.Get().Debugw("Received error packet",
-		"error", string(packet.Data))
+		"code", errorPacket.Code,
+		"error", errorPacket.Message)
+
+	if errorPacket.RequestId != "" && manager.SocketManager.FailPendingSocketChannel(errorPacket.RequestId, errorPacket) {
+		// the listener reports the failure to the user
+		return
+	}
+	if errorPacket.ChannelId != 0 {
+		// the other end of the socket channel is gone
+		manager.SocketManager.DisconnectSocketChannelInternal(errorPacket.ChannelId)
+	}
 
-	manager.NotificationString = string(packet.Data)
+	manager.NotificationString = errorPacket.Message
 }
 
 func (manager *ClientManager) handleCriticalError(client *proxy.ProxyClient, packet proxy.Packet) {
+	errorPacket := proxy.DecodeErrorPacket(&packet)
 	logging.Get().Errorw("Received critical error packet",
-		"error", string(packet.Data))
+		"code", errorPacket.Code,
+		"error", errorPacket.Message)
 	client.Close()
 	os.Exit(1)
 }
@@ -206,6 +233,12 @@ func (manager *ClientManager) handleSocketDisconnect(client *proxy.ProxyClient,
 
 	logging.Get().Debugw("Received socket disconnect packet", "channelId", disconnectPacket.Id)
 
+	channel := manager.SocketManager.GetSocketChannel(disconnectPacket.Id)
+	if channel != nil && channel.DeferRemoteClose() {
+		logging.Get().Debugw("Socket channel still writing out half closed data. Deferring disconnect", "channelId", disconnectPacket.Id)
+		return
+	}
+
 	// disconnect the socket
 	manager.SocketManager.DisconnectSocketChannelInternal(disconnectPacket.Id)
 }
@@ -214,12 +247,13 @@ func (manager *ClientManager) handleSocketDisconnect(client *proxy.ProxyClient,
 // Go Routines
 // ============================================
 
-func createSigtermHandler(client *proxy.ProxyClient) {
+func createSigtermHandler(manager *ClientManager) {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-c
-		client.Close()
+		// closing the listeners also removes our unix sockets
+		manager.Close()
 		os.Exit(0)
 	}()
 }
@@ -234,7 +268,7 @@ func messageProcessingLoop(manager *ClientManager, client *proxy.ProxyClient) {
 			return
 		} else {
 			switch packet.Type {
-			case proxy.Data:
+			case proxy.Data, proxy.Datagram:
 				manager.handleData(client, packet)
 			case proxy.Error:
 				manager.handleError(client, packet)
@@ -246,6 +280,10 @@ func messageProcessingLoop(manager *ClientManager, client *proxy.ProxyClient) {
 				manager.SocketManager.handleSocketConnect(client, packet)
 			case proxy.SocketDisconnect:
 				manager.handleSocketDisconnect(client, packet)
+			case proxy.WindowUpdate:
+				manager.SocketManager.handleWindowUpdate(client, packet)
+			case proxy.SocketHalfClose:
+				manager.SocketManager.handleSocketHalfClose(client, packet)
 			}
 		}
 	}
@@ -0,0 +1,13 @@
+package proxy
+
+// ClientSettings are the user provided options that control how the client behaves
+type ClientSettings struct {
+	// log the contents of every packet
+	DebugPackets bool
+	// compress data on all socket channels, not just rules that ask for it
+	Compress bool
+	// refuse socket channels that cannot be end to end encrypted
+	RequireEncryption bool
+	// which targets other members may reach through us
+	Exposure ExposurePolicy
+}
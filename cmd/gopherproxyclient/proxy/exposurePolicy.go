@@ -0,0 +1,32 @@
+package proxy
+
+import (
+	"slices"
+
+	"github.com/CanadianCommander/gopherproxy/internal/proxcom"
+)
+
+// ExposurePolicy decides which targets other channel members may reach through this client
+type ExposurePolicy struct {
+	// deny targets no rule allows. Otherwise they are allowed, but reported, as long as there are rules
+	Strict bool
+	Rules  []ExposureRule
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// Enforced returns true if the policy restricts or reports anything. A lenient policy without rules allows everything
+func (policy ExposurePolicy) Enforced() bool {
+	return policy.Strict || len(policy.Rules) > 0
+}
+
+// Allows returns true if a rule lets the member reach the target of the forwarding rule
+// @param member: name of the member that opens the socket channel
+// @param forwardingRule: the forwarding rule the socket channel is created for
+func (policy ExposurePolicy) Allows(member string, forwardingRule proxcom.ForwardingRule) bool {
+	return slices.ContainsFunc(policy.Rules, func(rule ExposureRule) bool {
+		return rule.Allows(member, forwardingRule)
+	})
+}
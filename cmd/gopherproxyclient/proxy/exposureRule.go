@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/CanadianCommander/gopherproxy/internal/proxcom"
+)
+
+// ExposureRule allows other channel members to reach a target through this client
+type ExposureRule struct {
+	// name of the member allowed to use the rule. Any member if empty
+	Member string
+	// see proxcom.MatchHostPattern
+	Host string
+	// ports of the target. Any port if nil. Never matches unix socket targets
+	Ports *proxcom.PortRange
+}
+
+// ============================================
+// Constructors
+// ============================================
+
+// ParseExposureRule parses an exposure rule of the form [member@]host[:port[-port]]
+// e.g. localhost:8080, laptop@10.0.0.0/8:8000-8999, [::1]:22, *.internal:443, unix:/var/run/docker.sock
+func ParseExposureRule(spec string) (ExposureRule, error) {
+	rule := ExposureRule{}
+	target := spec
+	if member, rest, found := strings.Cut(spec, "@"); found {
+		rule.Member = member
+		target = rest
+	}
+
+	ports := ""
+	switch {
+	case strings.HasPrefix(target, "unix:"):
+		rule.Host = target
+	case strings.HasPrefix(target, "["):
+		host, rest, found := strings.Cut(target[1:], "]")
+		if !found || (rest != "" && !strings.HasPrefix(rest, ":")) {
+			return ExposureRule{}, fmt.Errorf("invalid exposure rule %q", spec)
+		}
+		rule.Host = host
+		ports = strings.TrimPrefix(rest, ":")
+	default:
+		rule.Host, ports, _ = strings.Cut(target, ":")
+	}
+
+	err := proxcom.ValidateHostPattern(rule.Host)
+	if err != nil {
+		return ExposureRule{}, fmt.Errorf("invalid exposure rule %q: %w", spec, err)
+	}
+	if ports != "" && ports != "*" {
+		portRange, err := proxcom.ParsePortRange(ports)
+		if err != nil {
+			return ExposureRule{}, fmt.Errorf("invalid exposure rule %q: %w", spec, err)
+		}
+		rule.Ports = &portRange
+	}
+	return rule, nil
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// Allows returns true if the rule lets a member reach the target of a forwarding rule
+// @param member: name of the member that opens the socket channel
+// @param forwardingRule: the forwarding rule the socket channel is created for
+func (rule ExposureRule) Allows(member string, forwardingRule proxcom.ForwardingRule) bool {
+	if rule.Member != "" && rule.Member != member {
+		return false
+	}
+	if rule.Ports != nil && (forwardingRule.RemoteSocket != "" || !rule.Ports.Contains(forwardingRule.RemotePort)) {
+		return false
+	}
+	return proxcom.MatchHostPattern(rule.Host, forwardingRule)
+}
@@ -0,0 +1,352 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/CanadianCommander/gopherproxy/internal/logging"
+	"github.com/CanadianCommander/gopherproxy/internal/proxcom"
+	"github.com/CanadianCommander/gopherproxy/internal/proxy"
+)
+
+// SocketChannel is our end of a socket channel. It links a local socket
+// to the socket channel on the proxy server.
+type SocketChannel struct {
+	Id uint32
+	// the local tcp or unix socket, or udp socket or flow for datagram socket channels
+	Conn net.Conn
+	// true if the socket channel carries udp datagrams. Each read from Conn is sent as one Datagram packet
+	Datagram bool
+	// true if both ends of the socket channel speak flow control
+	FlowControl bool
+	// true if we compress data we send on this socket channel
+	Compression bool
+	// true if payloads are end to end encrypted
+	Encrypted bool
+	// true if each direction of the socket channel can be closed on its own
+	HalfClose bool
+	Closed    bool
+
+	socketManager *SocketManager
+	cipher        *proxy.ChannelCipher
+	mutex         sync.Mutex
+	// bytes we may still send to the remote end before it grants us more
+	sendCredit int
+	creditCond *sync.Cond
+	// data received from the remote end waiting to be written to the local socket
+	writeQueue []queuedWrite
+	writeCond  *sync.Cond
+
+	// half close state
+	// our local socket reached EOF and we sent a FIN to the remote end
+	readFinished bool
+	// the remote end sent us a FIN
+	finReceived bool
+	// the write side of our local socket has been closed
+	writeFinished bool
+	// the remote end disconnected the socket channel while we were still writing out its data
+	remoteClosed bool
+}
+
+// an entry in the write queue. Either data, or the remote end's FIN
+type queuedWrite struct {
+	data []byte
+	fin  bool
+}
+
+// initial credit each end of a flow controlled socket channel starts with
+const INITIAL_WINDOW_SIZE = 4 * PACKET_READ_SIZE
+
+// ============================================
+// Constructors
+// ============================================
+
+// NewSocketChannel creates a new socket channel for the given local socket
+// @param createPacket the create packet the server confirmed the socket channel with
+// @param conn the local socket
+// @param socketManager the socket manager that owns the socket channel
+// @return the socket channel or an error if the required encryption could not be set up
+func NewSocketChannel(createPacket proxcom.CreateSocketChannelPacket, conn net.Conn, socketManager *SocketManager) (*SocketChannel, error) {
+	compress := socketManager.ClientManager.Settings.Compress || createPacket.ForwardingRule.Compress
+	datagram := createPacket.ForwardingRule.IsUdp()
+	// datagrams are dropped rather than queued, and have no stream to half close
+	flowControl := createPacket.BothHaveCapability(proxy.CapabilityFlowControl) && !datagram
+
+	var channelCipher *proxy.ChannelCipher
+	if createPacket.CanEncrypt() {
+		var err error
+		isSource := createPacket.Source.Id == socketManager.ClientManager.Client.Id
+		channelCipher, err = proxy.NewChannelCipher(socketManager.ClientManager.KeyPair, createPacket.Source.PublicKey, createPacket.Sink.PublicKey, createPacket.KeySalt, isSource)
+		if err != nil {
+			return nil, err
+		}
+	} else if socketManager.ClientManager.Settings.RequireEncryption {
+		return nil, errors.New("the remote channel member does not support end to end encryption")
+	}
+
+	channel := &SocketChannel{
+		Id:            createPacket.Id,
+		Conn:          conn,
+		Datagram:      datagram,
+		FlowControl:   flowControl,
+		Compression:   compress && createPacket.BothHaveCapability(proxy.CapabilityCompression),
+		Encrypted:     channelCipher != nil,
+		HalfClose:     createPacket.BothHaveCapability(proxy.CapabilityHalfClose) && !datagram,
+		Closed:        false,
+		socketManager: socketManager,
+		cipher:        channelCipher,
+		sendCredit:    INITIAL_WINDOW_SIZE,
+		writeQueue:    make([]queuedWrite, 0),
+	}
+	channel.creditCond = sync.NewCond(&channel.mutex)
+	channel.writeCond = sync.NewCond(&channel.mutex)
+
+	if flowControl {
+		go channel.writeLoop()
+	}
+
+	return channel, nil
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// SealPayload wraps data read from the local socket in a Data packet for the remote end.
+// The data is compressed, then encrypted, as configured for the socket channel.
+// Must only be called from the socket channel's packet pump.
+// @param data the data read from the local socket
+func (channel *SocketChannel) SealPayload(data []byte) *proxy.Packet {
+	packetType := proxy.Data
+	if channel.Datagram {
+		packetType = proxy.Datagram
+	}
+	packet := proxy.NewPacketOfBytes(data, packetType)
+	packet.Chan = proxy.SocketChannel{Id: channel.Id}
+
+	if channel.Compression {
+		compressed, ok := proxy.CompressPayload(data)
+		if ok {
+			packet.Data = compressed
+			packet.Flags |= proxy.FlagCompressed
+		}
+		channel.socketManager.RecordCompression(uint64(len(data)), uint64(len(packet.Data)))
+	}
+
+	if channel.Encrypted {
+		packet.Flags |= proxy.FlagEncrypted
+		packet.Data = channel.cipher.Seal(packet.Data, channel.additionalData(packet))
+	}
+
+	return packet
+}
+
+// OpenPayload reverses SealPayload, returning the data to write to the local socket
+// @param packet the Data packet received from the remote end
+func (channel *SocketChannel) OpenPayload(packet *proxy.Packet) ([]byte, error) {
+	data := packet.Data
+
+	if channel.Encrypted != packet.HasFlag(proxy.FlagEncrypted) {
+		return nil, errors.New("encryption of received payload does not match the socket channel")
+	}
+	if channel.Encrypted {
+		var err error
+		data, err = channel.cipher.Open(data, channel.additionalData(packet))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if packet.HasFlag(proxy.FlagCompressed) {
+		return proxy.DecompressPayload(data)
+	}
+	return data, nil
+}
+
+// AcquireSendCredit blocks until we are allowed to send at least one byte to the remote end
+// @param max the most credit the caller wants
+// @return the number of bytes the caller may send, and false if the socket channel closed while waiting
+func (channel *SocketChannel) AcquireSendCredit(max int) (int, bool) {
+	if !channel.FlowControl {
+		return max, !channel.Closed
+	}
+
+	channel.mutex.Lock()
+	defer channel.mutex.Unlock()
+
+	for channel.sendCredit <= 0 && !channel.Closed {
+		channel.creditCond.Wait()
+	}
+	return min(max, channel.sendCredit), !channel.Closed
+}
+
+// ConsumeSendCredit records that bytes have been sent to the remote end
+func (channel *SocketChannel) ConsumeSendCredit(sent int) {
+	channel.mutex.Lock()
+	defer channel.mutex.Unlock()
+
+	channel.sendCredit -= sent
+}
+
+// GrantSendCredit is called when the remote end grants us more credit
+func (channel *SocketChannel) GrantSendCredit(credit int) {
+	channel.mutex.Lock()
+	defer channel.mutex.Unlock()
+
+	channel.sendCredit += credit
+	channel.creditCond.Broadcast()
+}
+
+// Write writes data from the remote end to the local socket.
+// With flow control the data is queued and written in the background so that a slow local socket
+// does not block the other socket channels.
+func (channel *SocketChannel) Write(data []byte) error {
+	if !channel.FlowControl {
+		_, err := channel.Conn.Write(data)
+		if err == nil {
+			channel.socketManager.RecordBytesSent(uint64(len(data)))
+		}
+		return err
+	}
+
+	channel.mutex.Lock()
+	defer channel.mutex.Unlock()
+
+	if channel.Closed {
+		return errors.New("socket channel is closed")
+	}
+	channel.writeQueue = append(channel.writeQueue, queuedWrite{data: data})
+	channel.writeCond.Signal()
+	return nil
+}
+
+// ReceiveFin is called when the remote end will send no more data.
+// Once all data from the remote end is written, the write side of the local socket is closed.
+func (channel *SocketChannel) ReceiveFin() {
+	channel.mutex.Lock()
+	channel.finReceived = true
+	if channel.FlowControl {
+		// let the write loop close the write side once it has caught up
+		channel.writeQueue = append(channel.writeQueue, queuedWrite{fin: true})
+		channel.writeCond.Signal()
+		channel.mutex.Unlock()
+		return
+	}
+	channel.mutex.Unlock()
+
+	channel.closeWrite()
+}
+
+// FinishRead is called once our local socket reached EOF and the FIN has been sent to the remote end.
+// The socket channel is torn down if the other direction is finished as well.
+func (channel *SocketChannel) FinishRead() {
+	channel.mutex.Lock()
+	channel.readFinished = true
+	done := channel.writeFinished
+	channel.mutex.Unlock()
+
+	if done {
+		channel.socketManager.DisconnectSocketChannel(channel.Id)
+	}
+}
+
+// DeferRemoteClose is called when the remote end disconnects the socket channel.
+// @return true if we are still writing out data the remote end sent before its FIN. In that case
+// the socket channel tears itself down once the data is written and the caller should not close it.
+func (channel *SocketChannel) DeferRemoteClose() bool {
+	channel.mutex.Lock()
+	defer channel.mutex.Unlock()
+
+	if channel.finReceived && !channel.writeFinished && !channel.Closed {
+		channel.remoteClosed = true
+		return true
+	}
+	return false
+}
+
+// Close closes the local socket and wakes anyone waiting on the socket channel
+func (channel *SocketChannel) Close() error {
+	channel.mutex.Lock()
+	channel.Closed = true
+	channel.writeQueue = nil
+	channel.creditCond.Broadcast()
+	channel.writeCond.Broadcast()
+	channel.mutex.Unlock()
+
+	return channel.Conn.Close()
+}
+
+// ============================================
+// Private Methods
+// ============================================
+
+// closeWrite closes the write side of the local socket, tearing down the socket channel
+// if the other direction is finished as well
+func (channel *SocketChannel) closeWrite() {
+	var err error = errors.New("socket does not support half close")
+	// tcp and unix sockets
+	if halfCloser, ok := channel.Conn.(interface{ CloseWrite() error }); ok {
+		err = halfCloser.CloseWrite()
+	}
+	if err != nil {
+		logging.Get().Debugw("Error closing write side of socket", "channelId", channel.Id, "error", err)
+	}
+
+	channel.mutex.Lock()
+	channel.writeFinished = true
+	done := channel.readFinished || channel.remoteClosed || err != nil
+	channel.mutex.Unlock()
+
+	if done {
+		channel.socketManager.DisconnectSocketChannel(channel.Id)
+	}
+}
+
+// additionalData is authenticated along with encrypted payloads, so the server cannot
+// move payloads between socket channels or tamper with the end to end flags
+func (channel *SocketChannel) additionalData(packet *proxy.Packet) []byte {
+	data := make([]byte, 6)
+	binary.BigEndian.PutUint32(data[0:4], channel.Id)
+	binary.BigEndian.PutUint16(data[4:6], uint16(packet.Flags&proxy.EndToEndFlags))
+	return data
+}
+
+// ============================================
+// Go Routines
+// ============================================
+
+// writeLoop writes queued data to the local socket and grants the remote end credit for it
+func (channel *SocketChannel) writeLoop() {
+	for {
+		channel.mutex.Lock()
+		for len(channel.writeQueue) == 0 && !channel.Closed {
+			channel.writeCond.Wait()
+		}
+		if channel.Closed {
+			channel.mutex.Unlock()
+			return
+		}
+		write := channel.writeQueue[0]
+		channel.writeQueue = channel.writeQueue[1:]
+		channel.mutex.Unlock()
+
+		if write.fin {
+			channel.closeWrite()
+			continue
+		}
+		data := write.data
+
+		_, err := channel.Conn.Write(data)
+		if err != nil {
+			logging.Get().Debugw("Error writing to socket. Closing socket channel", "channelId", channel.Id, "error", err)
+			channel.socketManager.DisconnectSocketChannel(channel.Id)
+			return
+		}
+		channel.socketManager.RecordBytesSent(uint64(len(data)))
+
+		// the data has left our hands, let the remote end send more
+		channel.socketManager.ClientManager.Client.Write(*proxcom.NewWindowUpdatePacket(channel.Id, uint32(len(data))))
+	}
+}
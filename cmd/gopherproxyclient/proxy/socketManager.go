@@ -2,9 +2,11 @@ package proxy
 
 import (
 	"errors"
-	"fmt"
+	"io"
 	"net"
+	"strconv"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/CanadianCommander/gopherproxy/internal/logging"
@@ -14,41 +16,58 @@ import (
 
 type SocketManager struct {
 	ClientManager *ClientManager
-	Listeners     []*net.TCPListener
-	// map, channel id -> socket
-	Sockets map[string][]*net.TCPConn
+	// tcp listeners, unix socket listeners and udp sockets of our forwarding rules
+	Listeners []io.Closer
+	// map, channel id -> socket channel
+	Sockets map[uint32]*SocketChannel
 	Closed  bool
 
-	socketMutex          sync.Mutex
-	listenerMutex        sync.Mutex
-	socketChannelCreated chan proxcom.CreateSocketChannelPacket
-	debugPackets         bool
+	socketMutex   sync.Mutex
+	listenerMutex sync.Mutex
+	// map, request id -> socket channel waiting for the server to confirm creation
+	pendingChannels map[string]*pendingSocketChannel
+	pendingMutex    sync.Mutex
+	debugPackets    bool
 
 	// metrics
 	Rx                       uint64
 	Tx                       uint64
 	BytesSentAccumulator     uint64
 	BytesReceivedAccumulator uint64
-	metricsMutex             sync.Mutex
+	// compression metrics. Bytes before and after compression of data sent on compressed socket channels
+	CompressionInputBytes  uint64
+	CompressionOutputBytes uint64
+	metricsMutex           sync.Mutex
+}
+
+// a socket channel this client requested, waiting for the server to confirm creation
+type pendingSocketChannel struct {
+	conn    net.Conn
+	created chan *SocketChannel
+	// why creation failed. Set before nil is sent on created
+	err error
 }
 
 const PACKET_READ_SIZE = 1024 * 1024 // 1MB
 const SOCKET_CHANNEL_CREATE_TIMEOUT = 5 * time.Second
 
+// shorter than SOCKET_CHANNEL_CREATE_TIMEOUT so the source hears about the dial timeout before it gives up
+const OUTBOUND_DIAL_TIMEOUT = 4 * time.Second
+
 // ============================================
 // Constructors
 // ============================================
 
 // NewSocketManager creates a new socket manager
-func NewSocketManager(clientManager *ClientManager, debugPackets bool) *SocketManager {
+func NewSocketManager(clientManager *ClientManager) *SocketManager {
 	return &SocketManager{
 		ClientManager: clientManager,
-		Listeners:     make([]*net.TCPListener, 0),
-		Sockets:       make(map[string][]*net.TCPConn),
+		Listeners:     make([]io.Closer, 0),
+		Sockets:       make(map[uint32]*SocketChannel),
 		Closed:        false,
 
-		socketChannelCreated: make(chan proxcom.CreateSocketChannelPacket, 10),
-		debugPackets:         debugPackets,
+		pendingChannels: make(map[string]*pendingSocketChannel),
+		debugPackets:    clientManager.Settings.DebugPackets,
 
 		Rx: 0,
 		Tx: 0,
@@ -63,14 +82,29 @@ func (socketManager *SocketManager) Start() {
 	go socketManager.UpdateMetricsRoutine()
 }
 
-// Listen starts the socket manager listening on the specified port
+// Listen starts the socket manager listening on the specified port, or the unix socket of the rule
 // @param port the port to listen on
 // @param tcpType the type of tcp to listen on, can be either "tcp" or "tcp4" or "tcp6"
 func (socketManager *SocketManager) Listen(port int, tcpType string, rule *proxcom.ForwardingRule) {
 	socketManager.listenerMutex.Lock()
 	defer socketManager.listenerMutex.Unlock()
 
-	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP("0.0.0.0"), Port: port})
+	if rule.IsUdp() {
+		udpListener, err := newUdpListener(socketManager, port, rule)
+		if err != nil {
+			panic(err)
+		}
+		socketManager.Listeners = append(socketManager.Listeners, udpListener)
+		return
+	}
+
+	var listener net.Listener
+	var err error
+	if rule.LocalSocket != "" {
+		listener, err = listenUnixSocket(rule.LocalSocket, rule.LocalSocketMode)
+	} else {
+		listener, err = net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP("0.0.0.0"), Port: port})
+	}
 	if err != nil {
 		panic(err)
 	}
@@ -84,45 +118,64 @@ func (socketManager *SocketManager) Listen(port int, tcpType string, rule *proxc
 // @param packet the packet to send
 // @return an error if one occurred
 func (socketManager *SocketManager) SendDataToSocket(packet *proxy.Packet) error {
-	socketManager.socketMutex.Lock()
-	defer socketManager.socketMutex.Unlock()
-
-	if socketManager.Sockets[packet.Chan.Id] == nil {
+	channel := socketManager.GetSocketChannel(packet.Chan.Id)
+	if channel == nil {
 		return errors.New("could not find a socket for the channel id")
 	}
 
-	if socketManager.debugPackets {
-		logging.Get().Infow("Sending data to socket", "packet", string(packet.Data))
+	data, err := channel.OpenPayload(packet)
+	if err != nil {
+		socketManager.DisconnectSocketChannel(packet.Chan.Id)
+		return err
 	}
 
-	for idx, socket := range socketManager.Sockets[packet.Chan.Id] {
-		_, err := socket.Write(packet.Data)
-		if err != nil {
-			socket.Close()
-			socketManager.DisconnectSocketChannel(packet.Chan.Id)
-			socketManager.Sockets[packet.Chan.Id] = append(socketManager.Sockets[packet.Chan.Id][:idx], socketManager.Sockets[packet.Chan.Id][idx+1:]...)
-		}
+	if socketManager.debugPackets {
+		logging.Get().Infow("Sending data to socket", "packet", string(data))
 	}
 
-	socketManager.RecordBytesSent(uint64(len(packet.Data)))
+	err = channel.Write(data)
+	if err != nil {
+		socketManager.DisconnectSocketChannel(packet.Chan.Id)
+		return err
+	}
 
 	return nil
 }
 
+// GetSocketChannel returns the socket channel with the given id or nil if there is none
+func (socketManager *SocketManager) GetSocketChannel(channelId uint32) *SocketChannel {
+	socketManager.socketMutex.Lock()
+	defer socketManager.socketMutex.Unlock()
+
+	return socketManager.Sockets[channelId]
+}
+
 // ConnectOutbound connects to the server on the specified port in the forwarding rule
 func (socketManager *SocketManager) ConnectOutbound(socketChannel proxcom.CreateSocketChannelPacket) {
-	logging.Get().Debugw("Connecting to outbound server", "channelId", socketChannel.Id, "remoteHost", socketChannel.ForwardingRule.RemoteHost, "remotePort", socketChannel.ForwardingRule.RemotePort)
+	rule := socketChannel.ForwardingRule
+	logging.Get().Debugw("Connecting to outbound server", "channelId", socketChannel.Id, "remoteAddress", rule.RemoteAddress())
+	if !socketManager.checkExposure(socketChannel) || !socketManager.checkEncryption(socketChannel) {
+		return
+	}
 
-	// connect to the server
-	conn, err := net.Dial("tcp", fmt.Sprintf("%s:%d", socketChannel.ForwardingRule.RemoteHost, socketChannel.ForwardingRule.RemotePort))
+	// connect to the server. For udp rules this is a connected udp socket, which preserves datagram boundaries
+	network := proxcom.ProtocolTcp
+	address := net.JoinHostPort(rule.RemoteHost, strconv.Itoa(rule.RemotePort))
+	if rule.IsUdp() {
+		network = proxcom.ProtocolUdp
+	} else if rule.RemoteSocket != "" {
+		network = "unix"
+		address = rule.RemoteSocket
+	}
+	conn, err := net.DialTimeout(network, address, OUTBOUND_DIAL_TIMEOUT)
 	if err != nil {
 		logging.Get().Debugw("Error connecting to outbound server", "error", err)
 		socketManager.ClientManager.NotificationString = "Error connecting to outbound server"
+		socketManager.reportSocketChannelError(socketChannel, dialErrorCode(err), err.Error())
 		return
 	}
 
 	logging.Get().Debugw("Established outgoing socket", "channelId", socketChannel.Id)
-	go socketManager.packetPump(conn.(*net.TCPConn), socketChannel.Id)
 
 	// notify proxy server
 	packet, err := proxy.NewPacketFromStruct(&socketChannel, proxy.SocketConnect)
@@ -132,9 +185,20 @@ func (socketManager *SocketManager) ConnectOutbound(socketChannel proxcom.Create
 		conn.Close()
 		return
 	}
+	// keeps the packet on the same lane as the data that follows it
+	packet.Chan.Id = socketChannel.Id
 
-	socketManager.AddChannelSocket(socketChannel.Id, conn.(*net.TCPConn))
+	channel, err := NewSocketChannel(socketChannel, conn, socketManager)
+	if err != nil {
+		logging.Get().Debugw("Error setting up socket channel", "error", err)
+		socketManager.ClientManager.NotificationString = "Refused socket channel: " + err.Error()
+		socketManager.reportSocketChannelError(socketChannel, proxy.ErrorSocketChannelRefused, err.Error())
+		conn.Close()
+		return
+	}
+	socketManager.AddChannelSocket(channel)
 	socketManager.ClientManager.Client.Write(*packet)
+	go socketManager.packetPump(channel)
 }
 
 // Close closes the socket manager. Closing all listeners and sockets
@@ -150,43 +214,82 @@ func (socketManager *SocketManager) Close() {
 
 // EstablishSocketChannel establishes a socket channel with the server
 // This channel is used to proxy packets between the source and sink defined in the forwarding rule
-func (socketManager *SocketManager) EstablishSocketChannel(rule *proxcom.ForwardingRule) (string, error) {
+// @param rule the forwarding rule the socket channel is for
+// @param conn the local socket, or udp flow, that will be linked to the socket channel
+func (socketManager *SocketManager) EstablishSocketChannel(rule *proxcom.ForwardingRule, conn net.Conn) (*SocketChannel, error) {
 	logging.Get().Debugw("Establishing socket channel", "rule", rule)
 
-	socketManager.listenerMutex.Lock()
-	defer socketManager.listenerMutex.Unlock()
-
 	source := *socketManager.ClientManager.GetChannelMemberInfo()
 	sink := socketManager.ClientManager.StateManager.getChannelMemberForRule(rule)
 	if sink == nil {
-		return "", errors.New("could not find a channel member for the forwarding rule")
+		return nil, errors.New("could not find a channel member for the forwarding rule")
+	}
+	if rule.IsUdp() && !(source.HasCapability(proxy.CapabilityDatagram) && sink.HasCapability(proxy.CapabilityDatagram)) {
+		return nil, errors.New("udp forwarding is not supported by the remote client or the proxy server")
+	}
+	if rule.RemoteSocket != "" && !(source.HasCapability(proxy.CapabilityUnixSocket) && sink.HasCapability(proxy.CapabilityUnixSocket)) {
+		return nil, errors.New("unix socket targets are not supported by the remote client or the proxy server")
 	}
 
 	socketCreatePacket, newChanRequestId, err := proxcom.BuildSocketChannelCreatePacket(source, *sink, *rule)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
+	pending := &pendingSocketChannel{
+		conn:    conn,
+		created: make(chan *SocketChannel, 1),
+	}
+	socketManager.pendingMutex.Lock()
+	socketManager.pendingChannels[newChanRequestId] = pending
+	socketManager.pendingMutex.Unlock()
+
+	defer func() {
+		socketManager.pendingMutex.Lock()
+		delete(socketManager.pendingChannels, newChanRequestId)
+		socketManager.pendingMutex.Unlock()
+	}()
+
 	// send connection request to server
 	socketManager.ClientManager.Client.Write(*socketCreatePacket)
 
 	// wait for the server to respond with the connection info
 	select {
-	case createPacket := <-socketManager.socketChannelCreated:
-		if createPacket.RequestId == newChanRequestId {
-			return createPacket.Id, nil
+	case channel := <-pending.created:
+		if channel == nil && pending.err != nil {
+			return nil, pending.err
+		} else if channel == nil {
+			return nil, errors.New("socket channel setup failed")
 		}
+		return channel, nil
 	case <-time.After(SOCKET_CHANNEL_CREATE_TIMEOUT):
-		return "", errors.New("socket channel creation timed out")
+		return nil, errors.New("socket channel creation timed out")
 	}
+}
+
+// FailPendingSocketChannel fails a socket channel this client requested, without waiting for the timeout
+// @param requestId the request id of the socket channel
+// @param err why the socket channel could not be created
+// @return false if there is no pending socket channel with that request id
+func (socketManager *SocketManager) FailPendingSocketChannel(requestId string, err error) bool {
+	socketManager.pendingMutex.Lock()
+	defer socketManager.pendingMutex.Unlock()
+
+	pending := socketManager.pendingChannels[requestId]
+	if pending == nil {
+		return false
+	}
+	delete(socketManager.pendingChannels, requestId)
 
-	return "", errors.New("socket channel creation failed")
+	pending.err = err
+	pending.created <- nil
+	return true
 }
 
 // DisconnectSocketChannel disconnects a socket channel internally and sends a disconnect packet to the server
 // @param channelId the id of the channel to disconnect
 // @return an error if one occurred
-func (socketManager *SocketManager) DisconnectSocketChannel(channelId string) error {
+func (socketManager *SocketManager) DisconnectSocketChannel(channelId uint32) error {
 	logging.Get().Debugw("Initiating socket channel disconnect", "channelId", channelId)
 
 	packet, err := proxcom.NewDisconnectSocketChannelPacket(channelId)
@@ -204,35 +307,30 @@ func (socketManager *SocketManager) DisconnectSocketChannel(channelId string) er
 // DisconnectSocketChannelInternal disconnects a socket channel internally
 // @param channelId the id of the channel to disconnect
 // @return an error if one occurred
-func (socketManager *SocketManager) DisconnectSocketChannelInternal(channelId string) error {
+func (socketManager *SocketManager) DisconnectSocketChannelInternal(channelId uint32) error {
 	logging.Get().Debugw("Disconnecting socket channel internally", "channelId", channelId)
 	socketManager.socketMutex.Lock()
-	defer socketManager.socketMutex.Unlock()
+	channel := socketManager.Sockets[channelId]
+	delete(socketManager.Sockets, channelId)
+	socketManager.socketMutex.Unlock()
 
-	if socketManager.Sockets[channelId] != nil {
-		for _, socket := range socketManager.Sockets[channelId] {
-			err := socket.Close()
-			if err != nil {
-				logging.Get().Debugw("Error closing socket", "error", err)
-				socketManager.ClientManager.NotificationString = "Error closing socket"
-				return err
-			}
+	if channel != nil {
+		err := channel.Close()
+		if err != nil {
+			logging.Get().Debugw("Error closing socket", "error", err)
+			return err
 		}
-		delete(socketManager.Sockets, channelId)
 	}
 
 	return nil
 }
 
-// AddChannelSocket adds a socket to the socket manager linked to a channel
-func (socketManager *SocketManager) AddChannelSocket(channelId string, conn *net.TCPConn) {
+// AddChannelSocket adds a socket channel to the socket manager
+func (socketManager *SocketManager) AddChannelSocket(channel *SocketChannel) {
 	socketManager.socketMutex.Lock()
 	defer socketManager.socketMutex.Unlock()
 
-	if socketManager.Sockets[channelId] == nil {
-		socketManager.Sockets[channelId] = make([]*net.TCPConn, 0)
-	}
-	socketManager.Sockets[channelId] = append(socketManager.Sockets[channelId], conn)
+	socketManager.Sockets[channel.Id] = channel
 }
 
 // RecordBytesSent records the number of bytes sent for metrics
@@ -244,6 +342,43 @@ func (socketManager *SocketManager) RecordBytesSent(sent uint64) {
 	socketManager.BytesSentAccumulator += sent
 }
 
+// EncryptionStats returns the number of end to end encrypted socket channels and the total number of socket channels
+func (socketManager *SocketManager) EncryptionStats() (int, int) {
+	socketManager.socketMutex.Lock()
+	defer socketManager.socketMutex.Unlock()
+
+	encrypted := 0
+	for _, channel := range socketManager.Sockets {
+		if channel.Encrypted {
+			encrypted++
+		}
+	}
+	return encrypted, len(socketManager.Sockets)
+}
+
+// RecordCompression records the size of a payload before and after compression for metrics
+// @param input the size of the payload before compression
+// @param output the size of the payload as sent
+func (socketManager *SocketManager) RecordCompression(input uint64, output uint64) {
+	socketManager.metricsMutex.Lock()
+	defer socketManager.metricsMutex.Unlock()
+
+	socketManager.CompressionInputBytes += input
+	socketManager.CompressionOutputBytes += output
+}
+
+// CompressionRatio returns the ratio of uncompressed to sent bytes on compressed socket channels.
+// 0 if nothing has been compressed yet
+func (socketManager *SocketManager) CompressionRatio() float64 {
+	socketManager.metricsMutex.Lock()
+	defer socketManager.metricsMutex.Unlock()
+
+	if socketManager.CompressionOutputBytes == 0 {
+		return 0
+	}
+	return float64(socketManager.CompressionInputBytes) / float64(socketManager.CompressionOutputBytes)
+}
+
 // RecordBytesReceived records the number of bytes received for metrics
 // @param received the number of bytes received
 func (socketManager *SocketManager) RecordBytesReceived(received uint64) {
@@ -253,6 +388,70 @@ func (socketManager *SocketManager) RecordBytesReceived(received uint64) {
 	socketManager.BytesReceivedAccumulator += received
 }
 
+// reportSocketChannelError tells the source of a socket channel that we could not set up our end
+// @param createPacket the create packet of the socket channel
+// @param code what went wrong
+// @param message human readable description
+func (socketManager *SocketManager) reportSocketChannelError(createPacket proxcom.CreateSocketChannelPacket, code proxy.ErrorCode, message string) {
+	errorPacket := proxy.NewErrorPacket(code, message)
+	errorPacket.ChannelId = createPacket.Id
+	errorPacket.RequestId = createPacket.RequestId
+	socketManager.ClientManager.Client.Write(*errorPacket.ToPacket(proxy.Error))
+}
+
+// checkExposure checks the target of a socket channel another member opened against our exposure policy.
+// Rejections are reported back to the source
+// @return true if we may connect to the target
+func (socketManager *SocketManager) checkExposure(createPacket proxcom.CreateSocketChannelPacket) bool {
+	policy := socketManager.ClientManager.Settings.Exposure
+	rule := createPacket.ForwardingRule
+	if !policy.Enforced() || policy.Allows(createPacket.Source.Name, rule) {
+		return true
+	}
+
+	if !policy.Strict {
+		logging.Get().Warnw("Allowed socket channel to a target that is not exposed. Use --expose-strict to deny it",
+			"source", createPacket.Source.Name,
+			"target", rule.RemoteAddress())
+		socketManager.ClientManager.NotificationString = createPacket.Source.Name + " reached " + rule.RemoteAddress() + ", which is not exposed"
+		return true
+	}
+
+	logging.Get().Warnw("Denied socket channel to a target that is not exposed",
+		"source", createPacket.Source.Name,
+		"target", rule.RemoteAddress())
+	socketManager.ClientManager.NotificationString = "Denied " + createPacket.Source.Name + " access to " + rule.RemoteAddress()
+	socketManager.reportSocketChannelError(createPacket, proxy.ErrorExposureDenied, rule.RemoteAddress()+" is not exposed to "+createPacket.Source.Name)
+	return false
+}
+
+// checkEncryption refuses socket channels that cannot be end to end encrypted if encryption is required.
+// Checked before dialing the target, so a refused socket channel never opens a connection
+// @return true if the socket channel may be set up
+func (socketManager *SocketManager) checkEncryption(createPacket proxcom.CreateSocketChannelPacket) bool {
+	if createPacket.CanEncrypt() || !socketManager.ClientManager.Settings.RequireEncryption {
+		return true
+	}
+
+	logging.Get().Warnw("Refused socket channel that cannot be end to end encrypted",
+		"source", createPacket.Source.Name,
+		"target", createPacket.ForwardingRule.RemoteAddress())
+	socketManager.ClientManager.NotificationString = "Refused socket channel: the remote channel member does not support end to end encryption"
+	socketManager.reportSocketChannelError(createPacket, proxy.ErrorSocketChannelRefused, "the remote channel member does not support end to end encryption")
+	return false
+}
+
+// dialErrorCode picks the error code describing why an outbound connection failed
+func dialErrorCode(err error) proxy.ErrorCode {
+	var netError net.Error
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return proxy.ErrorDialRefused
+	} else if errors.As(err, &netError) && netError.Timeout() {
+		return proxy.ErrorDialTimeout
+	}
+	return proxy.ErrorDialFailed
+}
+
 // ============================================
 // Event Handlers
 // ============================================
@@ -274,7 +473,52 @@ func (socketManager *SocketManager) handleSocketConnect(_ *proxy.ProxyClient, pa
 		socketManager.ConnectOutbound(createPacket)
 	} else {
 		logging.Get().Debugw("Server reports socket channel created!", "packet", packet)
-		socketManager.socketChannelCreated <- createPacket
+
+		socketManager.pendingMutex.Lock()
+		defer socketManager.pendingMutex.Unlock()
+
+		pending := socketManager.pendingChannels[createPacket.RequestId]
+		if pending == nil {
+			logging.Get().Debugw("Socket channel created for unknown or timed out request", "requestId", createPacket.RequestId)
+			socketManager.DisconnectSocketChannel(createPacket.Id)
+			return
+		}
+		delete(socketManager.pendingChannels, createPacket.RequestId)
+
+		// register the socket channel right away, the sink may start sending data immediately
+		channel, err := NewSocketChannel(createPacket, pending.conn, socketManager)
+		if err != nil {
+			logging.Get().Debugw("Error setting up socket channel", "error", err)
+			socketManager.ClientManager.NotificationString = "Refused socket channel: " + err.Error()
+			socketManager.DisconnectSocketChannel(createPacket.Id)
+			pending.created <- nil
+			return
+		}
+		socketManager.AddChannelSocket(channel)
+		pending.created <- channel
+	}
+}
+
+// handleSocketHalfClose sent by the remote end of a socket channel once it will send no more data
+func (socketManager *SocketManager) handleSocketHalfClose(_ *proxy.ProxyClient, packet proxy.Packet) {
+	channel := socketManager.GetSocketChannel(packet.Chan.Id)
+	if channel != nil {
+		logging.Get().Debugw("Remote end half closed socket channel", "channelId", packet.Chan.Id)
+		channel.ReceiveFin()
+	}
+}
+
+// handleWindowUpdate sent by the remote end of a socket channel to grant us more send credit
+func (socketManager *SocketManager) handleWindowUpdate(_ *proxy.ProxyClient, packet proxy.Packet) {
+	credit, err := proxcom.DecodeWindowUpdatePacket(&packet)
+	if err != nil {
+		logging.Get().Debugw("Error decoding window update packet", "error", err)
+		return
+	}
+
+	channel := socketManager.GetSocketChannel(packet.Chan.Id)
+	if channel != nil {
+		channel.GrantSendCredit(int(credit))
 	}
 }
 
@@ -282,51 +526,67 @@ func (socketManager *SocketManager) handleSocketConnect(_ *proxy.ProxyClient, pa
 // Go Routines
 // ============================================
 
-// listenLoop listens on the specified listener
-func (socketManager *SocketManager) listenLoop(listener *net.TCPListener, rule *proxcom.ForwardingRule) {
+// listenLoop listens on the specified tcp or unix socket listener
+func (socketManager *SocketManager) listenLoop(listener net.Listener, rule *proxcom.ForwardingRule) {
 	for {
-		conn, err := listener.AcceptTCP()
+		conn, err := listener.Accept()
 		if err != nil {
-			logging.Get().Warn("Error in TCP listener. Could not accept incoming connection")
+			logging.Get().Warn("Error in listener. Could not accept incoming connection")
 			if !socketManager.Closed {
-				logging.Get().Warn("Error in TCP listener. Trying to continue")
+				logging.Get().Warn("Error in listener. Trying to continue")
 			} else {
 				return // listener closed
 			}
 		} else {
 
 			// establish the socket channel on server
-			channelId, err := socketManager.EstablishSocketChannel(rule)
+			channel, err := socketManager.EstablishSocketChannel(rule, conn)
 			if err != nil {
 				logging.Get().Debugw("Error establishing socket channel", "error", err)
-				socketManager.ClientManager.NotificationString = "Error establishing socket channel"
+				socketManager.ClientManager.NotificationString = "Error establishing socket channel: " + err.Error()
 				conn.Close()
 				continue
 			}
 
-			socketManager.AddChannelSocket(channelId, conn)
-
-			logging.Get().Debugw("Established socket channel to proxy server", "channelId", channelId)
-			go socketManager.packetPump(conn, channelId)
+			logging.Get().Debugw("Established socket channel to proxy server", "channelId", channel.Id)
+			go socketManager.packetPump(channel)
 		}
 	}
 }
 
 // packetPump reads packets from the socket and forwards them to the server via the socket channel
-// @param socket the socket to read packets from
-// @param socketChannelId the id of the socket channel to forward packets to
-func (socketManager *SocketManager) packetPump(socket *net.TCPConn, socketChannelId string) {
+// If the socket channel is flow controlled, reading stops while we are out of send credit.
+// @param channel the socket channel to pump
+func (socketManager *SocketManager) packetPump(channel *SocketChannel) {
+	socket := channel.Conn
+	socketChannelId := channel.Id
+	maxReadSize := PACKET_READ_SIZE
+	if channel.Datagram {
+		maxReadSize = MAX_DATAGRAM_SIZE
+	}
+
 	for {
+		readSize, open := channel.AcquireSendCredit(maxReadSize)
+		if !open {
+			break
+		}
+
 		// read the packet
-		buffer := make([]byte, PACKET_READ_SIZE)
+		buffer := make([]byte, readSize)
 		bytesRead, err := socket.Read(buffer)
-		if err != nil {
+		if err == io.EOF && channel.HalfClose {
+			// the local application is done sending, but may still want a response. Only close our direction
+			logging.Get().Debugw("Local socket closed its write side. Half closing socket channel", "channelId", socketChannelId)
+			socketManager.ClientManager.Client.Write(*proxcom.NewSocketHalfClosePacket(socketChannelId))
+			channel.FinishRead()
+			break
+		} else if err != nil {
 			// debug because this is a normal operation
 			logging.Get().Debugw("Error reading from socket. Closing connection", "error", err)
 			socketManager.DisconnectSocketChannel(socketChannelId)
-			socket.Close()
 			break
 		}
+		channel.ConsumeSendCredit(bytesRead)
 
 		if socketManager.debugPackets {
 			logging.Get().Infow("Received packet from socket", "port", socket.LocalAddr().String(), "channelId", socketChannelId, "packet", string(buffer[:bytesRead]))
@@ -335,10 +595,14 @@ func (socketManager *SocketManager) packetPump(socket *net.TCPConn, socketChanne
 		// update metrics
 		socketManager.RecordBytesReceived(uint64(bytesRead))
 
+		data := buffer[:bytesRead]
+		if channel.Datagram {
+			// datagrams are usually small, do not hold on to the whole buffer
+			data = append([]byte{}, data...)
+		}
+
 		// proxy the packet.
-		packet := proxy.NewPacketOfBytes(buffer[:bytesRead], proxy.Data)
-		packet.Chan = proxy.SocketChannel{Id: socketChannelId}
-		socketManager.ClientManager.Client.Write(*packet)
+		socketManager.ClientManager.Client.Write(*channel.SealPayload(data))
 	}
 }
 
@@ -63,6 +63,7 @@ func (manager *stateManager) handleChannelState(client *proxy.ProxyClient, packe
 
 	client.Id = channelState.YourId
 	manager.ChannelMembers = channelState.CurrentMembers
+	manager.updateAssignedName(client)
 	manager.updateForwardingRuleValidity()
 
 	logging.Get().Infow("Channel state updated", "channel", client.Settings.Channel, "members", len(manager.ChannelMembers))
@@ -87,6 +88,17 @@ func (stateMan *stateManager) getChannelMemberForRule(rule *proxcom.ForwardingRu
 	return nil
 }
 
+// updateAssignedName adopts the name the server assigned us. It differs from the requested one if that was taken
+func (stateMan *stateManager) updateAssignedName(client *proxy.ProxyClient) {
+	for _, member := range stateMan.ChannelMembers {
+		if member.Id == client.Id && member.Name != client.Settings.Name {
+			logging.Get().Warnw("Name taken, joined the channel under another name", "name", client.Settings.Name, "assignedName", member.Name)
+			stateMan.ClientManager.NotificationString = "The name " + client.Settings.Name + " is taken, joined as " + member.Name
+			client.Settings.Name = member.Name
+		}
+	}
+}
+
 func (stateMan *stateManager) updateForwardingRuleValidity() {
 	stateChange := false
 	for _, rule := range stateMan.ClientManager.ForwardingRules {
@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// udpFlow is one flow through a udp forwarding rule, the datagrams exchanged with one local source address.
+// It implements net.Conn so the socket channel carrying the flow can treat it like a connected socket.
+// Each Read returns one datagram and each Write sends one.
+type udpFlow struct {
+	listener   *udpListener
+	remoteAddr *net.UDPAddr
+	// datagrams received from the source address, waiting to be read
+	datagrams chan []byte
+	closed    chan bool
+	closeOnce sync.Once
+	// unix nano time of the last datagram in either direction
+	lastActive atomic.Int64
+}
+
+// number of datagrams buffered per flow. Further datagrams are dropped, as a congested network would
+const UDP_FLOW_QUEUE_SIZE = 256
+
+// ============================================
+// Constructors
+// ============================================
+
+// newUdpFlow creates a new flow for the given source address
+func newUdpFlow(listener *udpListener, remoteAddr *net.UDPAddr) *udpFlow {
+	flow := &udpFlow{
+		listener:   listener,
+		remoteAddr: remoteAddr,
+		datagrams:  make(chan []byte, UDP_FLOW_QUEUE_SIZE),
+		closed:     make(chan bool),
+	}
+	flow.touch()
+	return flow
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// Read reads the next datagram from the source address
+func (flow *udpFlow) Read(buffer []byte) (int, error) {
+	select {
+	case datagram := <-flow.datagrams:
+		return copy(buffer, datagram), nil
+	case <-flow.closed:
+		return 0, net.ErrClosed
+	}
+}
+
+// Write sends a datagram to the source address
+func (flow *udpFlow) Write(datagram []byte) (int, error) {
+	flow.touch()
+	return flow.listener.conn.WriteToUDP(datagram, flow.remoteAddr)
+}
+
+// Close ends the flow. The next datagram from the source address starts a new one
+func (flow *udpFlow) Close() error {
+	flow.closeOnce.Do(func() {
+		close(flow.closed)
+		flow.listener.removeFlow(flow)
+	})
+	return nil
+}
+
+func (flow *udpFlow) LocalAddr() net.Addr {
+	return flow.listener.conn.LocalAddr()
+}
+
+func (flow *udpFlow) RemoteAddr() net.Addr {
+	return flow.remoteAddr
+}
+
+// deadlines are not supported, flows are closed by the idle timeout instead
+func (flow *udpFlow) SetDeadline(t time.Time) error      { return nil }
+func (flow *udpFlow) SetReadDeadline(t time.Time) error  { return nil }
+func (flow *udpFlow) SetWriteDeadline(t time.Time) error { return nil }
+
+// ============================================
+// Private Methods
+// ============================================
+
+// deliver queues a datagram received from the source address. Dropped if the queue is full
+func (flow *udpFlow) deliver(datagram []byte) {
+	flow.touch()
+	select {
+	case flow.datagrams <- datagram:
+	default:
+	}
+}
+
+func (flow *udpFlow) touch() {
+	flow.lastActive.Store(time.Now().UnixNano())
+}
+
+// idleFor returns how long it has been since the last datagram in either direction
+func (flow *udpFlow) idleFor() time.Duration {
+	return time.Since(time.Unix(0, flow.lastActive.Load()))
+}
@@ -0,0 +1,184 @@
+package proxy
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/CanadianCommander/gopherproxy/internal/logging"
+	"github.com/CanadianCommander/gopherproxy/internal/proxcom"
+)
+
+// udpListener is the local socket of a udp forwarding rule. Datagrams are grouped in to flows by
+// source address, and each flow is carried by its own socket channel.
+type udpListener struct {
+	socketManager *SocketManager
+	conn          *net.UDPConn
+	rule          *proxcom.ForwardingRule
+	// map, source address -> flow
+	flows map[string]*udpFlow
+	// datagrams from new source addresses are being dropped because there are MAX_UDP_FLOWS flows
+	full  bool
+	mutex sync.Mutex
+}
+
+// largest possible udp datagram
+const MAX_DATAGRAM_SIZE = 64 * 1024
+
+// flows without a datagram in either direction for this long are closed
+const UDP_FLOW_IDLE_TIMEOUT = 60 * time.Second
+
+// most flows a udp listener carries at once. Each flow holds a socket channel on the proxy server
+const MAX_UDP_FLOWS = 256
+
+// ============================================
+// Constructors
+// ============================================
+
+// newUdpListener creates a udp listener for the rule and starts serving it
+// @param socketManager the socket manager that owns the listener
+// @param port the local port to listen on
+// @param rule the forwarding rule
+func newUdpListener(socketManager *SocketManager, port int, rule *proxcom.ForwardingRule) (*udpListener, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("0.0.0.0"), Port: port})
+	if err != nil {
+		return nil, err
+	}
+
+	listener := &udpListener{
+		socketManager: socketManager,
+		conn:          conn,
+		rule:          rule,
+		flows:         make(map[string]*udpFlow),
+	}
+
+	go listener.listenLoop()
+	go listener.idleLoop()
+	return listener, nil
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// Close closes the local socket and all flows
+func (listener *udpListener) Close() error {
+	err := listener.conn.Close()
+
+	listener.mutex.Lock()
+	flows := make([]*udpFlow, 0, len(listener.flows))
+	for _, flow := range listener.flows {
+		flows = append(flows, flow)
+	}
+	listener.mutex.Unlock()
+
+	for _, flow := range flows {
+		flow.Close()
+	}
+	return err
+}
+
+// ============================================
+// Private Methods
+// ============================================
+
+// removeFlow forgets a closed flow
+func (listener *udpListener) removeFlow(flow *udpFlow) {
+	listener.mutex.Lock()
+	defer listener.mutex.Unlock()
+
+	if listener.flows[flow.remoteAddr.String()] == flow {
+		delete(listener.flows, flow.remoteAddr.String())
+	}
+}
+
+// flowFor returns the flow for a source address, creating it if this is the first datagram from that address
+// @return the flow and true if it was just created. nil if the listener already has MAX_UDP_FLOWS flows
+func (listener *udpListener) flowFor(remoteAddr *net.UDPAddr) (*udpFlow, bool) {
+	listener.mutex.Lock()
+	defer listener.mutex.Unlock()
+
+	flow := listener.flows[remoteAddr.String()]
+	if flow != nil {
+		return flow, false
+	}
+	if len(listener.flows) >= MAX_UDP_FLOWS {
+		if !listener.full {
+			// logged once each time the listener fills up, a flood of new senders would flood the log too
+			logging.Get().Warnw("Too many udp flows, dropping datagrams from new source addresses", "limit", MAX_UDP_FLOWS, "port", listener.rule.LocalPort)
+		}
+		listener.full = true
+		return nil, false
+	}
+	listener.full = false
+	flow = newUdpFlow(listener, remoteAddr)
+	listener.flows[remoteAddr.String()] = flow
+	return flow, true
+}
+
+// ============================================
+// Go Routines
+// ============================================
+
+// listenLoop reads datagrams from the local socket and hands them to their flow
+func (listener *udpListener) listenLoop() {
+	buffer := make([]byte, MAX_DATAGRAM_SIZE)
+	for {
+		size, remoteAddr, err := listener.conn.ReadFromUDP(buffer)
+		if err != nil {
+			if listener.socketManager.Closed {
+				return // listener closed
+			}
+			logging.Get().Warn("Error in UDP listener. Trying to continue")
+			continue
+		}
+
+		flow, created := listener.flowFor(remoteAddr)
+		if flow == nil {
+			logging.Get().Debugw("Dropped datagram, too many udp flows", "source", remoteAddr)
+			continue
+		}
+		flow.deliver(append([]byte{}, buffer[:size]...))
+		if created {
+			go listener.establishFlow(flow)
+		}
+	}
+}
+
+// establishFlow creates the socket channel carrying a new flow. Datagrams queue up in the flow meanwhile
+func (listener *udpListener) establishFlow(flow *udpFlow) {
+	channel, err := listener.socketManager.EstablishSocketChannel(listener.rule, flow)
+	if err != nil {
+		logging.Get().Debugw("Error establishing socket channel for udp flow", "error", err)
+		listener.socketManager.ClientManager.NotificationString = "Error establishing socket channel: " + err.Error()
+		flow.Close()
+		return
+	}
+
+	logging.Get().Debugw("Established udp socket channel to proxy server", "channelId", channel.Id, "source", flow.remoteAddr)
+	listener.socketManager.packetPump(channel)
+}
+
+// idleLoop closes flows that have gone quiet
+func (listener *udpListener) idleLoop() {
+	for {
+		<-time.After(UDP_FLOW_IDLE_TIMEOUT / 4)
+		if listener.socketManager.Closed {
+			return
+		}
+
+		listener.mutex.Lock()
+		idle := make([]*udpFlow, 0)
+		for _, flow := range listener.flows {
+			if flow.idleFor() > UDP_FLOW_IDLE_TIMEOUT {
+				idle = append(idle, flow)
+			}
+		}
+		listener.mutex.Unlock()
+
+		for _, flow := range idle {
+			logging.Get().Debugw("Closing idle udp flow", "source", flow.remoteAddr)
+			flow.Close()
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/CanadianCommander/gopherproxy/internal/logging"
+)
+
+// how long to wait for an existing unix socket to answer before it is considered stale
+const STALE_UNIX_SOCKET_DIAL_TIMEOUT = 1 * time.Second
+
+// unixSocketListener is a unix socket listener whose socket file was moved in to place after it was created
+type unixSocketListener struct {
+	*net.UnixListener
+	// where the socket file is now
+	path string
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// Addr returns the path the socket file was moved to
+func (listener *unixSocketListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: listener.path, Net: "unix"}
+}
+
+// Close stops listening and removes the socket file
+func (listener *unixSocketListener) Close() error {
+	err := listener.UnixListener.Close()
+	removeErr := os.Remove(listener.path)
+	if errors.Is(removeErr, os.ErrNotExist) {
+		removeErr = nil
+	}
+	return errors.Join(err, removeErr)
+}
+
+// ============================================
+// Private Methods
+// ============================================
+
+// listenUnixSocket listens on a unix socket for a forwarding rule, replacing a stale socket left behind by a crashed client.
+// The socket file is removed again when the listener is closed.
+// @param path the path of the socket file
+// @param mode the permissions of the socket file
+func listenUnixSocket(path string, mode os.FileMode) (net.Listener, error) {
+	err := removeStaleUnixSocket(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// the socket is created according to the umask, which is usually far too permissive for a tunnel.
+	// Create it in a private directory and only move it into place once it has the right permissions
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".gopherproxy-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tempPath := filepath.Join(dir, "socket")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: tempPath, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// the socket file is moved away from where the listener created it, unixSocketListener removes it instead
+	listener.SetUnlinkOnClose(false)
+
+	err = os.Chmod(tempPath, mode)
+	if err == nil {
+		err = os.Rename(tempPath, path)
+	}
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return &unixSocketListener{UnixListener: listener, path: path}, nil
+}
+
+// removeStaleUnixSocket removes a unix socket file nobody is listening on anymore.
+// @param path the path of the socket file
+// @return an error if the path is in use, or is not a socket
+func removeStaleUnixSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if info.Mode().Type() != os.ModeSocket {
+		return fmt.Errorf("cannot listen on %s, the file exists and is not a unix socket", path)
+	}
+
+	conn, err := net.DialTimeout("unix", path, STALE_UNIX_SOCKET_DIAL_TIMEOUT)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("cannot listen on %s, another process is already listening on it", path)
+	}
+
+	logging.Get().Infow("Removing stale unix socket", "path", path)
+	return os.Remove(path)
+}
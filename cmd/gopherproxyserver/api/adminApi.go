@@ -0,0 +1,156 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/CanadianCommander/gopherproxy/cmd/gopherproxyserver/proxy"
+	"github.com/CanadianCommander/gopherproxy/internal/logging"
+	proxylib "github.com/CanadianCommander/gopherproxy/internal/proxy"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	AdminRoute               = "/admin"
+	AdminChannelsRoute       = "/channels"
+	AdminChannelRoute        = "/channels/:channel"
+	AdminMembersRoute        = "/channels/:channel/members"
+	AdminMemberRoute         = "/channels/:channel/members/:member"
+	AdminSocketChannelsRoute = "/channels/:channel/socket-channels"
+	AdminSocketChannelRoute  = "/channels/:channel/socket-channels/:id"
+	AdminLockRoute           = "/channels/:channel/lock"
+)
+
+// AdminToken authenticates requests to the admin api, sent as a bearer token. The admin api is disabled while it is empty
+var AdminToken []byte
+
+// channelDetails is the response of the channel endpoint
+type channelDetails struct {
+	proxy.ChannelSummary
+	MemberList        []proxy.MemberSummary        `json:"memberList"`
+	SocketChannelList []proxy.SocketChannelSummary `json:"socketChannelList"`
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// CreateAdminApi adds the admin endpoints, which inspect and manage channels, under the admin route
+func CreateAdminApi(routeBuilder *gin.RouterGroup) *gin.RouterGroup {
+	adminGroup := routeBuilder.Group(AdminRoute, requireAdminToken)
+
+	adminGroup.GET(AdminChannelsRoute, ListChannels)
+	adminGroup.GET(AdminChannelRoute, GetChannel)
+	adminGroup.GET(AdminMembersRoute, ListMembers)
+	adminGroup.DELETE(AdminMemberRoute, KickMember)
+	adminGroup.GET(AdminSocketChannelsRoute, ListSocketChannels)
+	adminGroup.DELETE(AdminSocketChannelRoute, CloseSocketChannel)
+	adminGroup.PUT(AdminLockRoute, LockChannel)
+	adminGroup.DELETE(AdminLockRoute, UnlockChannel)
+
+	return adminGroup
+}
+
+// ============================================
+// Endpoints
+// ============================================
+
+// ListChannels lists every known channel
+func ListChannels(context *gin.Context) {
+	context.JSON(http.StatusOK, proxy.Manager.ListChannels())
+}
+
+// GetChannel describes one channel, with its members and socket channels
+func GetChannel(context *gin.Context) {
+	name := context.Param("channel")
+	for _, summary := range proxy.Manager.ListChannels() {
+		if summary.Name == name {
+			context.JSON(http.StatusOK, channelDetails{
+				ChannelSummary:    summary,
+				MemberList:        proxy.Manager.ListMembers(name),
+				SocketChannelList: proxy.Manager.ListSocketChannels(name),
+			})
+			return
+		}
+	}
+	adminError(context, http.StatusNotFound, "Unknown channel: "+name)
+}
+
+// ListMembers lists the members of a channel and their forwarding rules
+func ListMembers(context *gin.Context) {
+	context.JSON(http.StatusOK, proxy.Manager.ListMembers(context.Param("channel")))
+}
+
+// KickMember disconnects a member, given by id or name, from a channel
+func KickMember(context *gin.Context) {
+	channel := context.Param("channel")
+	member := context.Param("member")
+	if !proxy.Manager.KickMember(channel, member) {
+		adminError(context, http.StatusNotFound, "Channel "+channel+" has no member "+member)
+		return
+	}
+	context.Status(http.StatusNoContent)
+}
+
+// ListSocketChannels lists the socket channels open in a channel
+func ListSocketChannels(context *gin.Context) {
+	context.JSON(http.StatusOK, proxy.Manager.ListSocketChannels(context.Param("channel")))
+}
+
+// CloseSocketChannel closes a socket channel of a channel
+func CloseSocketChannel(context *gin.Context) {
+	channel := context.Param("channel")
+	id, err := strconv.ParseUint(context.Param("id"), 10, 32)
+	if err != nil {
+		adminError(context, http.StatusBadRequest, "Socket channel ids are numbers")
+		return
+	}
+	if !proxy.Manager.CloseSocketChannel(channel, uint32(id)) {
+		adminError(context, http.StatusNotFound, "Channel "+channel+" has no socket channel "+context.Param("id"))
+		return
+	}
+	context.Status(http.StatusNoContent)
+}
+
+// LockChannel stops a channel from accepting new members
+func LockChannel(context *gin.Context) {
+	proxy.Manager.SetChannelLocked(context.Param("channel"), true)
+	context.Status(http.StatusNoContent)
+}
+
+// UnlockChannel lets a locked channel accept new members again
+func UnlockChannel(context *gin.Context) {
+	proxy.Manager.SetChannelLocked(context.Param("channel"), false)
+	context.Status(http.StatusNoContent)
+}
+
+// ============================================
+// Private Methods
+// ============================================
+
+// requireAdminToken rejects requests that do not carry the admin token
+func requireAdminToken(context *gin.Context) {
+	token, found := strings.CutPrefix(context.GetHeader(proxylib.AuthorizationHeader), proxylib.BearerAuthorization)
+	if !found || len(AdminToken) == 0 || subtle.ConstantTimeCompare([]byte(token), AdminToken) != 1 {
+		logging.Get().Warnw("Rejected admin api request",
+			"remoteAddr", context.Request.RemoteAddr,
+			"method", context.Request.Method,
+			"path", context.Request.URL.Path)
+		context.Header("WWW-Authenticate", "Bearer")
+		adminError(context, http.StatusUnauthorized, "A valid admin token is required")
+		context.Abort()
+		return
+	}
+	logging.Get().Infow("Admin api request",
+		"remoteAddr", context.Request.RemoteAddr,
+		"method", context.Request.Method,
+		"path", context.Request.URL.Path)
+	context.Next()
+}
+
+// adminError responds with an error message
+func adminError(context *gin.Context, status int, message string) {
+	context.JSON(status, gin.H{"error": message})
+}
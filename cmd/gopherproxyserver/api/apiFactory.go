@@ -6,6 +6,9 @@ import (
 
 func CreateApi(routeBuilder *gin.RouterGroup) *gin.RouterGroup {
 	routeBuilder.GET(ConnectionListenerRoute, ConnectionListen)
+	routeBuilder.POST(PollConnectRoute, PollConnect)
+	routeBuilder.POST(PollSendRoute, PollSend)
+	routeBuilder.GET(PollReceiveRoute, PollReceive)
 
 	return routeBuilder
 }
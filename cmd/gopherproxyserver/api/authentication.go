@@ -0,0 +1,78 @@
+package api
+
+import (
+	"crypto/tls"
+	"strings"
+
+	"github.com/CanadianCommander/gopherproxy/cmd/gopherproxyserver/auth"
+	"github.com/CanadianCommander/gopherproxy/internal/metrics"
+	proxylib "github.com/CanadianCommander/gopherproxy/internal/proxy"
+)
+
+// TokenSecret signs and verifies access tokens. Clients cannot use access tokens while it is empty
+var TokenSecret []byte
+
+// Oidc verifies bearer tokens that are JWTs from an identity provider. nil if the server does not accept them
+var Oidc *auth.OidcAuthenticator
+
+// CertificateRules authorize clients that present a certificate signed by the client CA
+var CertificateRules []auth.CertificateRule
+
+var authFailures = metrics.NewCounterVec("gopherproxy_auth_failures_total",
+	"Clients refused because their credentials were invalid or did not allow the channel and name, by authentication method.",
+	"method")
+
+// ============================================
+// Private Methods
+// ============================================
+
+// authenticateCertificate authorizes the verified client certificate of a connection for the channel and name it requested
+// @param state: the tls state of the connection. nil for plain connections
+// @return the identity of the client, or nil if it did not present a certificate
+func authenticateCertificate(state *tls.ConnectionState, channel string, clientName string) (*auth.Identity, error) {
+	// the tls handshake already verified the chain against the client CA
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil, nil
+	}
+	identity, err := auth.AuthorizeCertificate(state.PeerCertificates[0], CertificateRules, channel, clientName)
+	if err != nil {
+		authFailures.Inc(auth.MethodCertificate)
+	}
+	return identity, err
+}
+
+// credentialMethod names the authentication method of the credentials in the client settings, for metrics
+func credentialMethod(settings proxylib.ProxyClientSettings) string {
+	if settings.Token == "" {
+		return auth.MethodPassword
+	}
+	if strings.HasPrefix(settings.Token, auth.AccessTokenPrefix) {
+		return auth.MethodToken
+	}
+	return auth.MethodOidc
+}
+
+// authenticate checks the credentials of a client that do not depend on the channel state
+// @return the identity of the client, or nil if it authenticates with the channel password, which the manager checks
+func authenticate(settings proxylib.ProxyClientSettings) (*auth.Identity, error) {
+	if settings.Token == "" {
+		return nil, nil
+	}
+	// bearer tokens are either our own access tokens or JWTs from the identity provider
+	if !strings.HasPrefix(settings.Token, auth.AccessTokenPrefix) {
+		if Oidc == nil {
+			return nil, proxylib.NewAuthenticationError("This server does not accept identity provider tokens")
+		}
+		return Oidc.Authorize(settings.Token, settings.Channel, settings.Name)
+	}
+
+	if len(TokenSecret) == 0 {
+		return nil, proxylib.NewAuthenticationError("This server does not accept access tokens")
+	}
+
+	accessToken, err := auth.ParseAccessToken(settings.Token, TokenSecret)
+	if err != nil {
+		return nil, err
+	}
+	return accessToken.Authorize(settings.Channel, settings.Name)
+}
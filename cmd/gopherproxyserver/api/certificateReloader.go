@@ -0,0 +1,149 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/CanadianCommander/gopherproxy/internal/logging"
+)
+
+// how often the certificate files are checked for changes
+const certificateWatchInterval = 5 * time.Second
+
+// CertificateReloader serves a certificate / key pair to tls listeners and reloads it when the files change
+// or the server receives SIGHUP. Established connections are not affected by a reload.
+type CertificateReloader struct {
+	certFile string
+	keyFile  string
+
+	mutex       sync.Mutex
+	certificate *tls.Certificate
+	// modification times of the files the current certificate was loaded from
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+// ============================================
+// Constructors
+// ============================================
+
+// NewCertificateReloader loads the certificate. Call Watch to start reloading it
+// @param certFile: PEM encoded certificate chain
+// @param keyFile: PEM encoded private key of the certificate
+func NewCertificateReloader(certFile string, keyFile string) (*CertificateReloader, error) {
+	reloader := &CertificateReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	err := reloader.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// GetCertificate returns the current certificate. Use as tls.Config.GetCertificate
+func (reloader *CertificateReloader) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+
+	return reloader.certificate, nil
+}
+
+// Reload loads the certificate from disk. The current certificate is kept if the files are invalid
+func (reloader *CertificateReloader) Reload() error {
+	certModTime, keyModTime := reloader.modTimes()
+
+	certificate, err := tls.LoadX509KeyPair(reloader.certFile, reloader.keyFile)
+	if err != nil {
+		return err
+	}
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		return err
+	}
+	certificate.Leaf = leaf
+
+	reloader.mutex.Lock()
+	reloader.certificate = &certificate
+	reloader.certModTime = certModTime
+	reloader.keyModTime = keyModTime
+	reloader.mutex.Unlock()
+
+	logging.Get().Infow("Loaded tls certificate",
+		"certFile", reloader.certFile,
+		"subject", leaf.Subject.String(),
+		"notAfter", leaf.NotAfter)
+	return nil
+}
+
+// Watch starts reloading the certificate whenever its files change or the server receives SIGHUP
+func (reloader *CertificateReloader) Watch() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go reloader.watchLoop(signals)
+}
+
+// ============================================
+// Private Methods
+// ============================================
+
+// modTimes returns the modification times of the certificate and key files. Zero if they cannot be read
+func (reloader *CertificateReloader) modTimes() (time.Time, time.Time) {
+	var certModTime, keyModTime time.Time
+	if info, err := os.Stat(reloader.certFile); err == nil {
+		certModTime = info.ModTime()
+	}
+	if info, err := os.Stat(reloader.keyFile); err == nil {
+		keyModTime = info.ModTime()
+	}
+	return certModTime, keyModTime
+}
+
+// changed returns true if the files have been modified since the certificate was loaded
+func (reloader *CertificateReloader) changed() bool {
+	certModTime, keyModTime := reloader.modTimes()
+
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+
+	return !certModTime.Equal(reloader.certModTime) || !keyModTime.Equal(reloader.keyModTime)
+}
+
+// ============================================
+// Go Routines
+// ============================================
+
+func (reloader *CertificateReloader) watchLoop(signals chan os.Signal) {
+	ticker := time.NewTicker(certificateWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-signals:
+			logging.Get().Infow("Received SIGHUP. Reloading tls certificate", "certFile", reloader.certFile)
+		case <-ticker.C:
+			if !reloader.changed() {
+				continue
+			}
+		}
+
+		err := reloader.Reload()
+		if err != nil {
+			// often the cert has been written but the key not yet. The next change or tick retries
+			logging.Get().Warnw("Failed to reload tls certificate. Keeping the current one",
+				"certFile", reloader.certFile,
+				"error", err)
+		}
+	}
+}
@@ -1,8 +1,12 @@
 package api
 
 import (
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/CanadianCommander/gopherproxy/cmd/gopherproxyserver/auth"
 	"github.com/CanadianCommander/gopherproxy/cmd/gopherproxyserver/proxy"
 	"github.com/CanadianCommander/gopherproxy/internal/logging"
 	"github.com/CanadianCommander/gopherproxy/internal/proxcom"
@@ -11,9 +15,23 @@ import (
 )
 
 const (
-	ConnectionListenerRoute = "ws/connect"
+	ConnectionListenerRoute = proxylib.WebsocketRoute
 )
 
+// AllowLegacyEncoding enables the legacy gob packet encoding for clients that request it,
+// or that are too old to request an encoding at all.
+var AllowLegacyEncoding = false
+
+// HeartbeatInterval and HeartbeatTimeout control how the server detects dead clients. Zero values use the defaults.
+var HeartbeatInterval time.Duration = 0
+var HeartbeatTimeout time.Duration = 0
+
+// ResumeGracePeriod is how long a client that lost its websocket keeps its socket channels. Zero uses the default.
+var ResumeGracePeriod time.Duration = 0
+
+// how long a rejected client has to receive its error before the connection is closed
+const rejectCloseDelay = 5 * time.Second
+
 // ============================================
 // Endpoints
 // ============================================
@@ -27,42 +45,146 @@ func ConnectionListen(context *gin.Context) {
 			"isWebSocket", context.IsWebsocket(),
 		)
 
-		channelName := context.Query(proxylib.ChannelParam)
-		if channelName == "" {
-			logging.Get().Warn("Incoming connection did not specify a channel")
+		settings, err := newClientSettings(
+			context.Query(proxylib.ChannelParam),
+			context.Query(proxylib.ClientName),
+			context.Query(proxylib.EncodingParam),
+			context.GetHeader(proxylib.AuthorizationHeader))
+		if err != nil {
+			logging.Get().Warnw("Rejected incoming connection",
+				"remoteAddr", context.Request.RemoteAddr,
+				"error", err)
 			context.Status(http.StatusBadRequest)
 			return
 		}
-
-		clientName := context.Query(proxylib.ClientName)
-		if clientName == "" {
-			logging.Get().Warn("Incoming connection did not specify a client name")
-			context.Status(http.StatusBadRequest)
+		identity, err := authenticateCertificate(context.Request.TLS, settings.Channel, settings.Name)
+		if err != nil {
+			logging.Get().Warnw("Rejected incoming connection. Client certificate not authorized",
+				"remoteAddr", context.Request.RemoteAddr,
+				"error", err)
+			context.Status(http.StatusForbidden)
 			return
 		}
 
-		client, err := proxylib.UpgradeConnection(context, proxylib.ProxyClientSettings{
-			Name:     clientName,
-			Channel:  channelName,
-			Password: context.GetHeader(proxylib.AuthorizationHeader),
-		})
-
-		if err != nil {
-			logging.Get().Errorw("Failed to upgrade connection to websocket",
-				"error", err)
+		client, resumed, err := proxylib.UpgradeConnection(context, settings)
+		if !registerClient(client, resumed, identity, err, context.Request.RemoteAddr) {
 			context.Status(http.StatusInternalServerError)
-		} else {
-			err = proxy.Manager.AddEndpoint(client)
-			switch err.(type) {
-			case *proxylib.AuthenticationError:
-				logging.Get().Warnw("Failed to add endpoint to manager. Authentication Error", "error", err.Error())
-				client.Write(*proxcom.NewCriticalErrorPacket(err))
-			case nil: // no error
-			default:
-				logging.Get().Errorw("Failed to add endpoint to manager. Unexpected Error ", "error", err.Error())
-			}
 		}
 	} else {
 		context.Status(http.StatusBadRequest)
 	}
 }
+
+// ============================================
+// Private Methods
+// ============================================
+
+// newClientSettings validates the connection parameters of an incoming client
+// @param channelName: the channel the client wants to join
+// @param clientName: the user friendly name of the client
+// @param encodingName: the packet encoding the client requested
+// @param authorization: the Authorization header. "Basic <channel password>" or "Bearer <access token>"
+func newClientSettings(channelName string, clientName string, encodingName string, authorization string) (proxylib.ProxyClientSettings, error) {
+	if channelName == "" {
+		return proxylib.ProxyClientSettings{}, errors.New("incoming connection did not specify a channel")
+	}
+	if clientName == "" {
+		return proxylib.ProxyClientSettings{}, errors.New("incoming connection did not specify a client name")
+	}
+
+	encoding, err := proxylib.ParsePacketEncoding(encodingName)
+	if err != nil {
+		return proxylib.ProxyClientSettings{}, err
+	}
+	if encoding == proxylib.GobEncoding && !AllowLegacyEncoding {
+		return proxylib.ProxyClientSettings{}, errors.New("incoming connection requested the legacy gob encoding, which is disabled")
+	}
+
+	settings := proxylib.ProxyClientSettings{
+		Name:     clientName,
+		Channel:  channelName,
+		Encoding: encoding,
+		// heartbeat
+		HeartbeatInterval: HeartbeatInterval,
+		HeartbeatTimeout:  HeartbeatTimeout,
+		// session resumption
+		ResumeGracePeriod: ResumeGracePeriod,
+	}
+	if strings.HasPrefix(authorization, proxylib.BearerAuthorization) {
+		settings.Token = strings.TrimPrefix(authorization, proxylib.BearerAuthorization)
+	} else {
+		settings.Password = strings.TrimPrefix(authorization, proxylib.BasicAuthorization)
+	}
+	return settings, nil
+}
+
+// registerClient adds a client that completed the protocol handshake to the proxy manager
+// @param client, resumed, err: the result of the protocol handshake
+// @param identity: the identity from the client certificate, or nil to authenticate with the client settings
+// @param remoteAddr: address of the client, for logging
+// @return false if the connection failed unexpectedly
+func registerClient(client *proxylib.ProxyClient, resumed bool, identity *auth.Identity, err error, remoteAddr string) bool {
+	var protocolError *proxylib.ProtocolError
+	var errorPacket *proxylib.ErrorPacket
+	if errors.As(err, &protocolError) || errors.As(err, &errorPacket) {
+		logging.Get().Warnw("Rejected incoming connection. Protocol handshake failed",
+			"remoteAddr", remoteAddr,
+			"error", err)
+	} else if err != nil {
+		logging.Get().Errorw("Failed to accept incoming connection",
+			"remoteAddr", remoteAddr,
+			"error", err)
+		return false
+	} else if resumed {
+		// the endpoint and its socket channels are still registered from before the connection dropped.
+		// The credentials may have expired or been revoked since, check them again
+		if identity == nil {
+			_, err = authenticate(client.Settings)
+		}
+		if err != nil {
+			authFailures.Inc(credentialMethod(client.Settings))
+			logging.Get().Warnw("Refused to resume session. Authentication Error",
+				"channel", client.Settings.Channel,
+				"name", client.Settings.Name,
+				"id", client.Id,
+				"error", err.Error())
+			rejectClient(client, err)
+			return true
+		}
+		logging.Get().Infow("Client resumed its session",
+			"channel", client.Settings.Channel,
+			"name", client.Settings.Name,
+			"id", client.Id)
+	} else {
+		if identity == nil {
+			identity, err = authenticate(client.Settings)
+		}
+		if err == nil {
+			err = proxy.Manager.AddEndpoint(client, identity)
+		}
+		if _, ok := err.(*proxylib.AuthenticationError); ok {
+			authFailures.Inc(credentialMethod(client.Settings))
+		}
+		switch err.(type) {
+		case *proxylib.AuthenticationError, *proxylib.ErrorPacket:
+			logging.Get().Warnw("Failed to add endpoint to manager. Authentication Error", "error", err.Error())
+			rejectClient(client, err)
+		case nil:
+			// admitted, only now may the client resume its session or join more lanes
+			client.RegisterSession()
+		default:
+			logging.Get().Errorw("Failed to add endpoint to manager. Unexpected Error ", "error", err.Error())
+			rejectClient(client, err)
+		}
+	}
+	return true
+}
+
+// rejectClient tells a client why it was turned away, then closes its connection
+func rejectClient(client *proxylib.ProxyClient, err error) {
+	client.Write(*proxcom.NewCriticalErrorPacket(err))
+	// the client exits when it gets the error. Close the connection in case it never reads it
+	time.AfterFunc(rejectCloseDelay, func() {
+		client.Close()
+	})
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/CanadianCommander/gopherproxy/internal/logging"
+	"github.com/CanadianCommander/gopherproxy/internal/metrics"
+)
+
+const MetricsRoute = "/metrics"
+
+// ============================================
+// Public Methods
+// ============================================
+
+// ListenMetrics serves the Prometheus metrics on their own address, so they can stay off the public listener
+// @param address: the address to listen on, e.g. 127.0.0.1:9090
+func ListenMetrics(address string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	logging.Get().Infow("Serving metrics", "address", address, "route", MetricsRoute)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+MetricsRoute, serveMetrics)
+	go func() {
+		err := http.Serve(listener, mux)
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			logging.Get().Errorw("Metrics listener stopped", "error", err)
+		}
+	}()
+	return listener, nil
+}
+
+// ============================================
+// Endpoints
+// ============================================
+
+// serveMetrics writes every metric in the Prometheus text format
+func serveMetrics(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", metrics.ContentType)
+	err := metrics.Write(writer)
+	if err != nil {
+		logging.Get().Debugw("Failed to write metrics", "remoteAddr", request.RemoteAddr, "error", err)
+	}
+}
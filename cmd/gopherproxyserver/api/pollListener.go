@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/CanadianCommander/gopherproxy/internal/logging"
+	proxylib "github.com/CanadianCommander/gopherproxy/internal/proxy"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	PollConnectRoute = proxylib.PollConnectRoute
+	PollSendRoute    = proxylib.PollSendRoute
+	PollReceiveRoute = proxylib.PollReceiveRoute
+)
+
+// ============================================
+// Endpoints
+// ============================================
+
+// Http long polling connect. Fallback for clients whose network blocks websockets
+func PollConnect(context *gin.Context) {
+	remoteAddr := context.Request.RemoteAddr
+	logging.Get().Infow("Incoming poll transport connection", "remoteAddr", remoteAddr)
+
+	settings, err := newClientSettings(
+		context.Query(proxylib.ChannelParam),
+		context.Query(proxylib.ClientName),
+		context.Query(proxylib.EncodingParam),
+		context.GetHeader(proxylib.AuthorizationHeader))
+	if err != nil {
+		logging.Get().Warnw("Rejected incoming connection",
+			"remoteAddr", remoteAddr,
+			"error", err)
+		context.Status(http.StatusBadRequest)
+		return
+	}
+	identity, err := authenticateCertificate(context.Request.TLS, settings.Channel, settings.Name)
+	if err != nil {
+		logging.Get().Warnw("Rejected incoming connection. Client certificate not authorized",
+			"remoteAddr", remoteAddr,
+			"error", err)
+		context.Status(http.StatusForbidden)
+		return
+	}
+
+	transport, pollId, err := proxylib.NewPollTransport(remoteAddr)
+	if err != nil {
+		logging.Get().Errorw("Failed to open poll transport", "error", err)
+		context.Status(http.StatusInternalServerError)
+		return
+	}
+
+	// the handshake runs over the poll transport itself, once the client starts polling
+	go func() {
+		client, resumed, err := proxylib.AcceptTransport(transport, settings)
+		registerClient(client, resumed, identity, err, remoteAddr)
+	}()
+
+	context.JSON(http.StatusOK, proxylib.PollConnectResponse{PollId: pollId})
+}
+
+// Http long polling, client to server messages
+func PollSend(context *gin.Context) {
+	proxylib.HandlePollSend(context)
+}
+
+// Http long polling, server to client messages
+func PollReceive(context *gin.Context) {
+	proxylib.HandlePollReceive(context)
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+
+	"github.com/CanadianCommander/gopherproxy/internal/logging"
+	proxylib "github.com/CanadianCommander/gopherproxy/internal/proxy"
+)
+
+// ============================================
+// Public Methods
+// ============================================
+
+// ListenTls accepts clients on the raw tls transport (gopher+tls:// urls), skipping HTTP and websocket framing
+// @param address: the address to listen on, e.g. 0.0.0.0:8443
+// @param tlsConfig: the server certificate and tls settings
+func ListenTls(address string, tlsConfig *tls.Config) (net.Listener, error) {
+	listener, err := tls.Listen("tcp", address, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	logging.Get().Infow("Listening for tls transport connections", "address", address)
+
+	go tlsAcceptLoop(listener)
+	return listener, nil
+}
+
+// ============================================
+// Go Routines
+// ============================================
+
+func tlsAcceptLoop(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		} else if err != nil {
+			logging.Get().Warnw("Error accepting tls transport connection. Trying to continue", "error", err)
+			continue
+		}
+
+		go acceptTlsClient(conn)
+	}
+}
+
+// acceptTlsClient validates the connect request of a raw tls client and performs the protocol handshake
+func acceptTlsClient(conn net.Conn) {
+	remoteAddr := conn.RemoteAddr().String()
+	logging.Get().Infow("Incoming tls transport connection", "remoteAddr", remoteAddr)
+
+	transport, request, err := proxylib.AcceptTlsConnection(conn)
+	if err != nil {
+		logging.Get().Warnw("Rejected incoming connection. Could not read connect request",
+			"remoteAddr", remoteAddr,
+			"error", err)
+		conn.Close()
+		return
+	}
+
+	settings, err := newClientSettings(request.Channel, request.ClientName, request.Encoding, request.Authorization)
+	if err != nil {
+		logging.Get().Warnw("Rejected incoming connection",
+			"remoteAddr", remoteAddr,
+			"error", err)
+		proxylib.RejectTransport(transport, proxylib.NewProtocolError(err.Error()))
+		return
+	}
+	// the tls handshake completed while reading the connect request
+	state := conn.(*tls.Conn).ConnectionState()
+	identity, err := authenticateCertificate(&state, settings.Channel, settings.Name)
+	if err != nil {
+		logging.Get().Warnw("Rejected incoming connection. Client certificate not authorized",
+			"remoteAddr", remoteAddr,
+			"error", err)
+		proxylib.RejectTransport(transport, err)
+		return
+	}
+
+	client, resumed, err := proxylib.AcceptTransport(transport, settings)
+	registerClient(client, resumed, identity, err, remoteAddr)
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	proxylib "github.com/CanadianCommander/gopherproxy/internal/proxy"
+)
+
+// access tokens look like gpt1.<base64url JSON claims>.<base64url HMAC-SHA256 of everything before the last dot>
+const AccessTokenPrefix = "gpt1."
+
+// shortest token secret accepted, in bytes
+const MinTokenSecretSize = 32
+
+// AccessToken lets a client join a channel without the channel password. The server signs it with its token secret
+type AccessToken struct {
+	Channel string
+	// client names the token may join as. Empty allows any name
+	Clients []string `json:",omitempty"`
+	// what the client may do in the channel. Empty allows everything
+	Actions []Action `json:",omitempty"`
+	// unix seconds
+	IssuedAt  int64
+	ExpiresAt int64
+}
+
+// ============================================
+// Constructors
+// ============================================
+
+// NewAccessToken creates the claims of a token valid from now for the given time
+func NewAccessToken(channel string, clients []string, actions []Action, validFor time.Duration) AccessToken {
+	now := time.Now()
+	return AccessToken{
+		Channel:   channel,
+		Clients:   clients,
+		Actions:   actions,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(validFor).Unix(),
+	}
+}
+
+// ParseAccessToken verifies the signature and expiry of a token
+// @param token: the token, as sent by the client
+// @param secret: the server token secret
+// @return the claims, or an AuthenticationError
+func ParseAccessToken(token string, secret []byte) (*AccessToken, error) {
+	dot := strings.LastIndexByte(token, '.')
+	if !strings.HasPrefix(token, AccessTokenPrefix) || dot < len(AccessTokenPrefix) {
+		return nil, proxylib.NewAuthenticationError("Invalid access token")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(token[dot+1:])
+	if err != nil || !hmac.Equal(signature, sign(token[:dot], secret)) {
+		return nil, proxylib.NewAuthenticationError("Invalid access token")
+	}
+
+	claims, err := base64.RawURLEncoding.DecodeString(token[len(AccessTokenPrefix):dot])
+	if err != nil {
+		return nil, proxylib.NewAuthenticationError("Invalid access token")
+	}
+	var accessToken AccessToken
+	err = json.Unmarshal(claims, &accessToken)
+	if err != nil {
+		return nil, proxylib.NewAuthenticationError("Invalid access token")
+	}
+
+	if time.Now().Unix() >= accessToken.ExpiresAt {
+		return nil, proxylib.NewAuthenticationError("Access token expired")
+	}
+	return &accessToken, nil
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// Sign encodes and signs the token
+// @param secret: the server token secret
+func (accessToken AccessToken) Sign(secret []byte) (string, error) {
+	if len(secret) < MinTokenSecretSize {
+		return "", fmt.Errorf("the token secret must be at least %d bytes", MinTokenSecretSize)
+	}
+	claims, err := json.Marshal(accessToken)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := AccessTokenPrefix + base64.RawURLEncoding.EncodeToString(claims)
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sign(unsigned, secret)), nil
+}
+
+// Authorize checks that the token lets the client join the channel under the given name
+// @return the identity of the client, or an AuthenticationError
+func (accessToken AccessToken) Authorize(channel string, clientName string) (*Identity, error) {
+	if accessToken.Channel != channel {
+		return nil, proxylib.NewAuthenticationError("Access token is not valid for channel: " + channel)
+	}
+	if len(accessToken.Clients) > 0 && !slices.Contains(accessToken.Clients, clientName) {
+		return nil, proxylib.NewAuthenticationError("Access token does not allow joining as: " + clientName)
+	}
+
+	identity := &Identity{
+		Method:         MethodToken,
+		Subject:        clientName,
+		RestrictsNames: len(accessToken.Clients) > 0,
+	}
+	if len(accessToken.Actions) > 0 {
+		identity.Actions = accessToken.Actions
+	}
+	return identity, nil
+}
+
+// ============================================
+// Private Methods
+// ============================================
+
+func sign(message string, secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	proxylib "github.com/CanadianCommander/gopherproxy/internal/proxy"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func signed(t *testing.T, token AccessToken, secret []byte) string {
+	t.Helper()
+	value, err := token.Sign(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+// tamper replaces the claims of a signed token, keeping its signature
+func tamper(token string, claims string) string {
+	dot := strings.LastIndexByte(token, '.')
+	return AccessTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(claims)) + token[dot:]
+}
+
+func TestParseAccessToken(t *testing.T) {
+	valid := signed(t, NewAccessToken("ops", nil, nil, time.Hour), testSecret)
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"valid", valid, false},
+		{"wrong secret", signed(t, NewAccessToken("ops", nil, nil, time.Hour), []byte("another secret of at least 32 bytes")), true},
+		{"tampered claims", tamper(valid, `{"Channel":"admin","ExpiresAt":99999999999}`), true},
+		{"tampered signature", valid[:len(valid)-2] + "AA", true},
+		{"expired", signed(t, NewAccessToken("ops", nil, nil, -time.Second), testSecret), true},
+		{"missing prefix", strings.TrimPrefix(valid, AccessTokenPrefix), true},
+		{"missing signature", valid[:strings.LastIndexByte(valid, '.')], true},
+		{"empty", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token, err := ParseAccessToken(test.token, testSecret)
+			if test.wantErr {
+				var authenticationError *proxylib.AuthenticationError
+				if !errors.As(err, &authenticationError) {
+					t.Errorf("ParseAccessToken() error = %v, want an AuthenticationError", err)
+				}
+				return
+			}
+			if err != nil || token.Channel != "ops" {
+				t.Errorf("ParseAccessToken() = %+v, %v", token, err)
+			}
+		})
+	}
+}
+
+func TestAccessTokenAuthorize(t *testing.T) {
+	tests := []struct {
+		name         string
+		token        AccessToken
+		channel      string
+		client       string
+		wantErr      bool
+		wantRestrict bool
+	}{
+		{"any name", NewAccessToken("ops", nil, nil, time.Hour), "ops", "laptop", false, false},
+		{"listed name", NewAccessToken("ops", []string{"laptop", "bastion"}, nil, time.Hour), "ops", "bastion", false, true},
+		{"unlisted name", NewAccessToken("ops", []string{"laptop"}, nil, time.Hour), "ops", "bastion", true, false},
+		{"wrong channel", NewAccessToken("ops", nil, nil, time.Hour), "dev", "laptop", true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token, err := ParseAccessToken(signed(t, test.token, testSecret), testSecret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			identity, err := token.Authorize(test.channel, test.client)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("Authorize(%q, %q) allowed the client", test.channel, test.client)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authorize(%q, %q) error = %v", test.channel, test.client, err)
+			}
+			if identity.Method != MethodToken || identity.Subject != test.client || identity.RestrictsNames != test.wantRestrict {
+				t.Errorf("Authorize() = %+v", identity)
+			}
+		})
+	}
+}
+
+func TestAccessTokenActions(t *testing.T) {
+	token, err := ParseAccessToken(signed(t, NewAccessToken("ops", nil, []Action{ActionForward}, time.Hour), testSecret), testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := token.Authorize("ops", "laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !identity.Permits(ActionForward) || identity.Permits(ActionExpose) {
+		t.Errorf("identity actions = %v, want only forward", identity.Actions)
+	}
+}
+
+func TestSignRejectsShortSecret(t *testing.T) {
+	if _, err := NewAccessToken("ops", nil, nil, time.Hour).Sign([]byte("short")); err == nil {
+		t.Error("Sign() accepted a secret shorter than MinTokenSecretSize")
+	}
+}
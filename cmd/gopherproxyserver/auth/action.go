@@ -0,0 +1,30 @@
+package auth
+
+import "fmt"
+
+// Action is something a channel member can be allowed to do in its channel
+type Action string
+
+const (
+	// open socket channels to other members, i.e. be the source of forwarding rules
+	ActionForward Action = "forward"
+	// accept socket channels from other members, i.e. be the sink of their forwarding rules
+	ActionExpose Action = "expose"
+)
+
+// AllActions lists every action. An identity without explicit actions may do all of them
+var AllActions = []Action{ActionForward, ActionExpose}
+
+// ============================================
+// Constructors
+// ============================================
+
+// ParseAction validates an action name
+func ParseAction(name string) (Action, error) {
+	for _, action := range AllActions {
+		if string(action) == name {
+			return action, nil
+		}
+	}
+	return "", fmt.Errorf("unknown action %q, expected one of %v", name, AllActions)
+}
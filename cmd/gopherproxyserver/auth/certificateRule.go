@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"crypto/x509"
+	"slices"
+
+	proxylib "github.com/CanadianCommander/gopherproxy/internal/proxy"
+)
+
+// matches any channel in CertificateRule.Channels
+const AnyChannel = "*"
+
+// CertificateRule maps client certificates to the client names and channels they may use
+type CertificateRule struct {
+	// the certificate subject common name, or one of its DNS, email or URI SANs
+	Match string
+	// names the client may join as. Only Match itself if empty
+	ClientNames []string
+	// channels the client may join. AnyChannel allows all of them
+	Channels []string
+	// what the client may do in the channel. nil allows everything
+	Actions []Action
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// AuthorizeCertificate finds a rule that lets the certificate join the channel under the given name
+// @param certificate: the verified client certificate
+// @return the identity of the client, or an AuthenticationError if no rule allows it
+func AuthorizeCertificate(certificate *x509.Certificate, rules []CertificateRule, channel string, clientName string) (*Identity, error) {
+	names := certificateNames(certificate)
+	for _, rule := range rules {
+		if !slices.Contains(names, rule.Match) {
+			continue
+		}
+		if rule.allows(channel, clientName) {
+			return &Identity{
+				Method:         MethodCertificate,
+				Subject:        rule.Match,
+				Actions:        rule.Actions,
+				RestrictsNames: true,
+			}, nil
+		}
+	}
+	return nil, proxylib.NewAuthenticationError("Client certificate does not allow joining channel " + channel + " as " + clientName)
+}
+
+// ============================================
+// Private Methods
+// ============================================
+
+// allows returns true if the rule lets a matching certificate join the channel under the given name
+func (rule CertificateRule) allows(channel string, clientName string) bool {
+	clientNames := rule.ClientNames
+	if len(clientNames) == 0 {
+		clientNames = []string{rule.Match}
+	}
+	return slices.Contains(clientNames, clientName) &&
+		(slices.Contains(rule.Channels, channel) || slices.Contains(rule.Channels, AnyChannel))
+}
+
+// certificateNames lists every name a certificate rule can match
+func certificateNames(certificate *x509.Certificate) []string {
+	names := []string{certificate.Subject.CommonName}
+	names = append(names, certificate.DNSNames...)
+	names = append(names, certificate.EmailAddresses...)
+	for _, uri := range certificate.URIs {
+		names = append(names, uri.String())
+	}
+	return names
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+)
+
+// ClaimRule maps identity provider tokens with a given claim value to the channels and names they may use
+type ClaimRule struct {
+	// name of the claim, e.g. groups or email
+	Claim string
+	// the claim must equal this value, or contain it if the claim is a list
+	Value string
+	// channels the client may join. AnyChannel allows all of them
+	Channels []string
+	// names the client may join as. Empty allows any name
+	ClientNames []string
+	// what the client may do in the channel. nil allows everything
+	Actions []Action
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// Matches returns true if the token claims have the value the rule looks for
+func (rule ClaimRule) Matches(claims map[string]any) bool {
+	switch value := claims[rule.Claim].(type) {
+	case []any:
+		for _, item := range value {
+			if claimString(item) == rule.Value {
+				return true
+			}
+		}
+		return false
+	case nil:
+		return false
+	default:
+		return claimString(value) == rule.Value
+	}
+}
+
+// Allows returns true if the rule lets a matching token join the channel under the given name
+func (rule ClaimRule) Allows(channel string, clientName string) bool {
+	return (len(rule.ClientNames) == 0 || slices.Contains(rule.ClientNames, clientName)) &&
+		(slices.Contains(rule.Channels, channel) || slices.Contains(rule.Channels, AnyChannel))
+}
+
+// ============================================
+// Private Methods
+// ============================================
+
+// claimString formats a JSON claim value so rules can compare it, e.g. email_verified: true becomes "true"
+func claimString(value any) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,51 @@
+package auth
+
+import "slices"
+
+// authentication methods, see Identity.Method
+const (
+	MethodPassword    = "password"
+	MethodToken       = "token"
+	MethodCertificate = "certificate"
+	MethodOidc        = "oidc"
+)
+
+// Identity is who a client authenticated as, and what it may do
+type Identity struct {
+	// how the client authenticated. MethodPassword, MethodToken, ...
+	Method string
+	// who the client is, as far as the authentication method can tell. Empty for channel passwords
+	Subject string
+	// what the client may do in its channel. nil allows everything
+	Actions []Action
+	// true if the credential only allows joining under specific client names. Such clients are never renamed
+	RestrictsNames bool
+}
+
+// ============================================
+// Constructors
+// ============================================
+
+// NewPasswordIdentity is the identity of a client that only proved it knows the channel password
+func NewPasswordIdentity() *Identity {
+	return &Identity{
+		Method: MethodPassword,
+	}
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// String describes the identity for logs and the channel state, e.g. oidc:alice@example.com
+func (identity *Identity) String() string {
+	if identity.Subject == "" {
+		return identity.Method
+	}
+	return identity.Method + ":" + identity.Subject
+}
+
+// Permits returns true if the identity may perform the action
+func (identity *Identity) Permits(action Action) bool {
+	return identity.Actions == nil || slices.Contains(identity.Actions, action)
+}
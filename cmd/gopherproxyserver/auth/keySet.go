@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CanadianCommander/gopherproxy/internal/logging"
+)
+
+// how long fetched keys are trusted before the key set is fetched again
+const keySetMaxAge = time.Hour
+
+// a token signed with an unknown key fetches the key set again, but at most this often
+const keySetMinRefreshInterval = time.Minute
+
+// largest JWKS document accepted, in bytes
+const maxKeySetSize = 1024 * 1024
+
+// KeySet holds the public keys of a JSON Web Key Set (JWKS), fetched from a URL or read from a file.
+// Keys are fetched again when they get old, or when a token names a key the set does not have, so the identity provider can rotate them
+type KeySet struct {
+	// https:// URL or file path of the JWKS document
+	source string
+	client *http.Client
+
+	mutex     sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// jsonWebKey is the subset of RFC 7517 needed to verify signatures
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC and OKP
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ============================================
+// Constructors
+// ============================================
+
+// NewKeySet creates a key set. Nothing is fetched until Refresh or the first Key lookup
+// @param source: http(s) URL or file path of the JWKS document
+func NewKeySet(source string) *KeySet {
+	return &KeySet{
+		source: source,
+		client: &http.Client{Timeout: 10 * time.Second},
+		keys:   make(map[string]crypto.PublicKey),
+	}
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// Key looks up the key a token was signed with, fetching the key set again if the key is unknown
+// @param kid: the key id from the token header. May be empty if the set only has one key
+func (keySet *KeySet) Key(kid string) (crypto.PublicKey, error) {
+	keySet.mutex.Lock()
+	defer keySet.mutex.Unlock()
+
+	key, ok := keySet.lookup(kid)
+	stale := time.Since(keySet.fetchedAt) > keySetMaxAge
+	if (!ok || stale) && time.Since(keySet.fetchedAt) > keySetMinRefreshInterval {
+		err := keySet.refresh()
+		if err != nil {
+			// keep using the keys we have, the identity provider may be briefly unavailable
+			logging.Get().Warnw("Failed to refresh the JWKS key set", "source", keySet.source, "error", err)
+		}
+		key, ok = keySet.lookup(kid)
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("no key with id %q in the key set", kid)
+	}
+	return key, nil
+}
+
+// Refresh fetches the key set now
+func (keySet *KeySet) Refresh() error {
+	keySet.mutex.Lock()
+	defer keySet.mutex.Unlock()
+	return keySet.refresh()
+}
+
+// ============================================
+// Private Methods
+// ============================================
+
+// lookup finds a key by id. A token without a key id uses the only key in the set
+func (keySet *KeySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(keySet.keys) == 1 {
+		for _, key := range keySet.keys {
+			return key, true
+		}
+	}
+	key, ok := keySet.keys[kid]
+	return key, ok
+}
+
+// refresh replaces the keys with those of the JWKS document. Must hold the mutex
+func (keySet *KeySet) refresh() error {
+	// failed attempts count too, so an unavailable identity provider is not asked on every connection
+	keySet.fetchedAt = time.Now()
+
+	document, err := keySet.read()
+	if err != nil {
+		return err
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	err = json.Unmarshal(document, &jwks)
+	if err != nil {
+		return fmt.Errorf("invalid JWKS document: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			logging.Get().Warnw("Skipping unusable key in the JWKS key set", "kid", jwk.Kid, "error", err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return errors.New("the JWKS document has no usable signing keys")
+	}
+
+	keySet.keys = keys
+	logging.Get().Infow("Loaded JWKS key set", "source", keySet.source, "keys", len(keys))
+	return nil
+}
+
+// read returns the JWKS document from the URL or file
+func (keySet *KeySet) read() ([]byte, error) {
+	if !strings.HasPrefix(keySet.source, "https://") && !strings.HasPrefix(keySet.source, "http://") {
+		return os.ReadFile(keySet.source)
+	}
+
+	response, err := keySet.client.Get(keySet.source)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s returned %s", keySet.source, response.Status)
+	}
+	return io.ReadAll(io.LimitReader(response.Body, maxKeySetSize))
+}
+
+// publicKey decodes the key material of an RSA, EC or Ed25519 key
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("RSA exponent too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		// rejects points that are not on the curve
+		_, err = key.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		return key, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(bytes) == 0 {
+		return nil, errors.New("invalid base64url key parameter")
+	}
+	return new(big.Int).SetBytes(bytes), nil
+}
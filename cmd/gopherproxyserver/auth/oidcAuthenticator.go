@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	proxylib "github.com/CanadianCommander/gopherproxy/internal/proxy"
+)
+
+// clock skew tolerated when checking the exp and nbf claims
+const jwtLeeway = time.Minute
+
+// OidcAuthenticator verifies JWTs issued by an OpenID Connect identity provider and maps their claims to channels
+type OidcAuthenticator struct {
+	// the iss claim tokens must have
+	Issuer string
+	// a value the aud claim must have
+	Audience string
+	// verifies token signatures
+	Keys *KeySet
+	// claim recorded as the identity subject, e.g. email. sub if empty
+	SubjectClaim string
+	// the first rule that matches the token and allows the channel and name grants access
+	Rules []ClaimRule
+}
+
+// the header of a JWT. Only the fields needed to pick the key
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// Authorize verifies a JWT and checks that its claims allow joining the channel under the given name
+// @param token: the JWT, as sent by the client
+// @return the identity of the client, or an AuthenticationError
+func (authenticator *OidcAuthenticator) Authorize(token string, channel string, clientName string) (*Identity, error) {
+	claims, err := authenticator.verify(token)
+	if err != nil {
+		return nil, proxylib.NewAuthenticationError("Invalid identity provider token: " + err.Error())
+	}
+
+	subjectClaim := authenticator.SubjectClaim
+	if subjectClaim == "" {
+		subjectClaim = "sub"
+	}
+	subject := claimString(claims[subjectClaim])
+
+	for _, rule := range authenticator.Rules {
+		if rule.Matches(claims) && rule.Allows(channel, clientName) {
+			return &Identity{
+				Method:         MethodOidc,
+				Subject:        subject,
+				Actions:        rule.Actions,
+				RestrictsNames: len(rule.ClientNames) > 0,
+			}, nil
+		}
+	}
+	return nil, proxylib.NewAuthenticationError("Identity " + subject + " may not join channel " + channel + " as " + clientName)
+}
+
+// ============================================
+// Private Methods
+// ============================================
+
+// verify checks the signature, issuer, audience and lifetime of a JWT
+// @return the token claims
+func (authenticator *OidcAuthenticator) verify(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("not a signed JWT")
+	}
+
+	var header jwtHeader
+	err := decodeJwtSegment(parts[0], &header)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("invalid signature encoding")
+	}
+	key, err := authenticator.Keys.Key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	err = verifyJwtSignature(header.Alg, key, parts[0]+"."+parts[1], signature)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	err = decodeJwtSegment(parts[1], &claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims["iss"] != authenticator.Issuer {
+		return nil, fmt.Errorf("issued by %v, not %s", claims["iss"], authenticator.Issuer)
+	}
+	if !(ClaimRule{Claim: "aud", Value: authenticator.Audience}).Matches(claims) {
+		return nil, fmt.Errorf("not issued for audience %s", authenticator.Audience)
+	}
+	now := time.Now()
+	expiresAt, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, errors.New("missing exp claim")
+	}
+	if now.Add(-jwtLeeway).After(time.Unix(int64(expiresAt), 0)) {
+		return nil, errors.New("expired")
+	}
+	notBefore, ok := claims["nbf"].(float64)
+	if ok && now.Add(jwtLeeway).Before(time.Unix(int64(notBefore), 0)) {
+		return nil, errors.New("not valid yet")
+	}
+	return claims, nil
+}
+
+// verifyJwtSignature checks a JWS signature. Only asymmetric algorithms are accepted, so a public key can never be used as an HMAC secret
+// @param alg: the alg header of the token
+// @param signingInput: the encoded header and claims, joined by a dot
+func verifyJwtSignature(alg string, key crypto.PublicKey, signingInput string, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		hash = crypto.SHA512
+	case "EdDSA":
+	default:
+		return fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+
+	var digest []byte
+	if hash != 0 {
+		hasher := hash.New()
+		hasher.Write([]byte(signingInput))
+		digest = hasher.Sum(nil)
+	}
+
+	valid := false
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if strings.HasPrefix(alg, "RS") {
+			valid = rsa.VerifyPKCS1v15(key, hash, digest, signature) == nil
+		} else if strings.HasPrefix(alg, "PS") {
+			valid = rsa.VerifyPSS(key, hash, digest, signature, nil) == nil
+		}
+	case *ecdsa.PublicKey:
+		bits := key.Curve.Params().BitSize
+		size := (bits + 7) / 8
+		if ecdsaCurveBits[alg] == bits && len(signature) == 2*size {
+			r := new(big.Int).SetBytes(signature[:size])
+			s := new(big.Int).SetBytes(signature[size:])
+			valid = ecdsa.Verify(key, digest, r, s)
+		}
+	case ed25519.PublicKey:
+		valid = alg == "EdDSA" && ed25519.Verify(key, []byte(signingInput), signature)
+	}
+
+	if !valid {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// the curve size each ECDSA algorithm must be used with
+var ecdsaCurveBits = map[string]int{
+	"ES256": 256,
+	"ES384": 384,
+	"ES512": 521,
+}
+
+// decodeJwtSegment decodes a base64url JSON segment of a JWT
+func decodeJwtSegment(segment string, value any) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return errors.New("invalid JWT encoding")
+	}
+	err = json.Unmarshal(decoded, value)
+	if err != nil {
+		return errors.New("invalid JWT encoding")
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+)
+
+const testSigningInput = "eyJhbGciOiJub25lIn0.eyJzdWIiOiJ0ZXN0In0"
+
+func digest(hash crypto.Hash, input string) []byte {
+	hasher := hash.New()
+	hasher.Write([]byte(input))
+	return hasher.Sum(nil)
+}
+
+// signEcdsa produces a JWS ECDSA signature, r and s as fixed size big endian integers
+func signEcdsa(t *testing.T, key *ecdsa.PrivateKey, hash crypto.Hash, input string) []byte {
+	t.Helper()
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest(hash, input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := (key.Curve.Params().BitSize + 7) / 8
+	signature := make([]byte, 2*size)
+	r.FillBytes(signature[:size])
+	s.FillBytes(signature[size:])
+	return signature
+}
+
+func TestVerifyJwtSignature(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs256, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest(crypto.SHA256, testSigningInput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps256, err := rsa.SignPSS(rand.Reader, rsaKey, crypto.SHA256, digest(crypto.SHA256, testSigningInput), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	es256 := signEcdsa(t, p256Key, crypto.SHA256, testSigningInput)
+	es384 := signEcdsa(t, p384Key, crypto.SHA384, testSigningInput)
+	edDsa := ed25519.Sign(edPrivate, []byte(testSigningInput))
+
+	tests := []struct {
+		name         string
+		alg          string
+		key          crypto.PublicKey
+		signingInput string
+		signature    []byte
+		wantErr      bool
+	}{
+		{"RS256", "RS256", &rsaKey.PublicKey, testSigningInput, rs256, false},
+		{"PS256", "PS256", &rsaKey.PublicKey, testSigningInput, ps256, false},
+		{"ES256", "ES256", &p256Key.PublicKey, testSigningInput, es256, false},
+		{"ES384", "ES384", &p384Key.PublicKey, testSigningInput, es384, false},
+		{"EdDSA", "EdDSA", edPublic, testSigningInput, edDsa, false},
+
+		{"tampered input", "RS256", &rsaKey.PublicKey, testSigningInput + "x", rs256, true},
+		{"tampered signature", "ES256", &p256Key.PublicKey, testSigningInput, append([]byte{es256[0] ^ 1}, es256[1:]...), true},
+		{"other key", "RS256", &otherRsaKey.PublicKey, testSigningInput, rs256, true},
+		{"empty signature", "EdDSA", edPublic, testSigningInput, nil, true},
+
+		// the alg header must agree with the key and the signature
+		{"RS256 signature as PS256", "PS256", &rsaKey.PublicKey, testSigningInput, rs256, true},
+		{"PS256 signature as RS256", "RS256", &rsaKey.PublicKey, testSigningInput, ps256, true},
+		{"RS256 with an EC key", "RS256", &p256Key.PublicKey, testSigningInput, rs256, true},
+		{"ES256 with an RSA key", "ES256", &rsaKey.PublicKey, testSigningInput, es256, true},
+		{"ES256 with a P-384 key", "ES256", &p384Key.PublicKey, testSigningInput, es384, true},
+		{"ES384 with a P-256 key", "ES384", &p256Key.PublicKey, testSigningInput, es256, true},
+		{"EdDSA with an RSA key", "EdDSA", &rsaKey.PublicKey, testSigningInput, edDsa, true},
+		{"RS256 with an Ed25519 key", "RS256", edPublic, testSigningInput, edDsa, true},
+
+		// symmetric and unsigned tokens are never accepted
+		{"HS256", "HS256", &rsaKey.PublicKey, testSigningInput, rs256, true},
+		{"none", "none", &rsaKey.PublicKey, testSigningInput, nil, true},
+		{"empty alg", "", edPublic, testSigningInput, edDsa, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := verifyJwtSignature(test.alg, test.key, test.signingInput, test.signature)
+			if (err != nil) != test.wantErr {
+				t.Errorf("verifyJwtSignature() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ChannelConfig declares a channel clients can join. Only clients with the matching password are accepted
+type ChannelConfig struct {
+	Name string `yaml:"name"`
+	// bcrypt hash of the channel password. Generate one with gopherproxyserver hash-password
+	PasswordHash string `yaml:"passwordHash"`
+	// which socket channels members may open. Every socket channel is allowed if nil
+	Policy *ChannelPolicyConfig `yaml:"policy"`
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// Validate checks that the channel has a name and a usable password hash
+func (channel ChannelConfig) Validate() error {
+	if channel.Name == "" {
+		return errors.New("every channel needs a name")
+	}
+	_, err := bcrypt.Cost([]byte(channel.PasswordHash))
+	if err != nil {
+		return fmt.Errorf("password hash of channel %q is not a bcrypt hash, generate one with gopherproxyserver hash-password", channel.Name)
+	}
+	if channel.Policy != nil {
+		_, err = channel.Policy.Policy()
+		if err != nil {
+			return fmt.Errorf("policy of channel %q: %w", channel.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/CanadianCommander/gopherproxy/cmd/gopherproxyserver/proxy"
+)
+
+// ChannelPolicyConfig decides which socket channels members of a channel may open. The first matching rule wins
+type ChannelPolicyConfig struct {
+	// allow or deny, when no rule matches. Defaults to deny
+	Default string             `yaml:"default"`
+	Rules   []PolicyRuleConfig `yaml:"rules"`
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// Policy validates the config and converts it to the policy the manager evaluates
+func (policy ChannelPolicyConfig) Policy() (*proxy.ChannelPolicy, error) {
+	if policy.Default != "" && policy.Default != PolicyAllow && policy.Default != PolicyDeny {
+		return nil, fmt.Errorf("default %q is not one of %s or %s", policy.Default, PolicyAllow, PolicyDeny)
+	}
+
+	channelPolicy := &proxy.ChannelPolicy{
+		DefaultAllow: policy.Default == PolicyAllow,
+	}
+	for index, ruleConfig := range policy.Rules {
+		rule, err := ruleConfig.Rule()
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", index, err)
+		}
+		channelPolicy.Rules = append(channelPolicy.Rules, rule)
+	}
+	return channelPolicy, nil
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/CanadianCommander/gopherproxy/cmd/gopherproxyserver/auth"
+)
+
+// ClaimRuleConfig maps identity provider tokens with a claim value, e.g. a group, to the channels they may join
+type ClaimRuleConfig struct {
+	// name of the claim, e.g. groups or email
+	Claim string `yaml:"claim"`
+	// the claim must equal this value, or contain it if the claim is a list
+	Value string `yaml:"value"`
+	// channels the client may join, "*" for all of them
+	Channels []string `yaml:"channels"`
+	// names the client may join as. Any name if empty
+	ClientNames []string `yaml:"clientNames"`
+	// forward and/or expose. Everything if empty
+	Actions []string `yaml:"actions"`
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// Validate checks that the rule matches a claim and grants access to at least one channel
+func (claimRule ClaimRuleConfig) Validate() error {
+	if claimRule.Claim == "" || claimRule.Value == "" {
+		return errors.New("every oidc rule needs a claim and a value to match")
+	}
+	if len(claimRule.Channels) == 0 {
+		return fmt.Errorf("oidc rule %s=%s does not allow any channels", claimRule.Claim, claimRule.Value)
+	}
+	_, err := claimRule.Rule()
+	if err != nil {
+		return fmt.Errorf("oidc rule %s=%s: %w", claimRule.Claim, claimRule.Value, err)
+	}
+	return nil
+}
+
+// Rule converts the config to the rule the api authorizes tokens with
+func (claimRule ClaimRuleConfig) Rule() (auth.ClaimRule, error) {
+	var actions []auth.Action
+	for _, name := range claimRule.Actions {
+		action, err := auth.ParseAction(name)
+		if err != nil {
+			return auth.ClaimRule{}, err
+		}
+		actions = append(actions, action)
+	}
+
+	return auth.ClaimRule{
+		Claim:       claimRule.Claim,
+		Value:       claimRule.Value,
+		Channels:    claimRule.Channels,
+		ClientNames: claimRule.ClientNames,
+		Actions:     actions,
+	}, nil
+}
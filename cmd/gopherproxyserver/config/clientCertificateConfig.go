@@ -0,0 +1,58 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/CanadianCommander/gopherproxy/cmd/gopherproxyserver/auth"
+)
+
+// ClientCertificateConfig maps client certificates signed by the client CA to the names and channels they may use
+type ClientCertificateConfig struct {
+	// the certificate subject common name, or one of its DNS, email or URI SANs
+	Match string `yaml:"match"`
+	// names the client may join as. Only the matched name if empty
+	ClientNames []string `yaml:"clientNames"`
+	// channels the client may join, "*" for all of them
+	Channels []string `yaml:"channels"`
+	// forward and/or expose. Everything if empty
+	Actions []string `yaml:"actions"`
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// Validate checks that the rule matches something and grants access to at least one channel
+func (certificate ClientCertificateConfig) Validate() error {
+	if certificate.Match == "" {
+		return errors.New("every client certificate rule needs a name to match")
+	}
+	if len(certificate.Channels) == 0 {
+		return fmt.Errorf("client certificate rule %q does not allow any channels", certificate.Match)
+	}
+	_, err := certificate.Rule()
+	if err != nil {
+		return fmt.Errorf("client certificate rule %q: %w", certificate.Match, err)
+	}
+	return nil
+}
+
+// Rule converts the config to the rule the api authorizes certificates with
+func (certificate ClientCertificateConfig) Rule() (auth.CertificateRule, error) {
+	var actions []auth.Action
+	for _, name := range certificate.Actions {
+		action, err := auth.ParseAction(name)
+		if err != nil {
+			return auth.CertificateRule{}, err
+		}
+		actions = append(actions, action)
+	}
+
+	return auth.CertificateRule{
+		Match:       certificate.Match,
+		ClientNames: certificate.ClientNames,
+		Channels:    certificate.Channels,
+		Actions:     actions,
+	}, nil
+}
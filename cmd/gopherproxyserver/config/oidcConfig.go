@@ -0,0 +1,79 @@
+package config
+
+import (
+	"errors"
+	"net/url"
+
+	"github.com/CanadianCommander/gopherproxy/cmd/gopherproxyserver/auth"
+)
+
+// OidcConfig lets clients authenticate with JWTs from an OpenID Connect identity provider. Disabled unless the issuer is set
+type OidcConfig struct {
+	// the iss claim tokens must have
+	Issuer string `yaml:"issuer"`
+	// a value the aud claim must have, usually the client id registered with the identity provider
+	Audience string `yaml:"audience"`
+	// URL or file path of the JSON Web Key Set that signs the tokens
+	Jwks string `yaml:"jwks"`
+	// claim recorded as the identity of the client, e.g. email. Defaults to sub
+	SubjectClaim string `yaml:"subjectClaim"`
+	// which tokens may join which channels. Config file only
+	Rules []ClaimRuleConfig `yaml:"rules"`
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// Enabled returns true if the server accepts identity provider tokens
+func (oidc OidcConfig) Enabled() bool {
+	return oidc.Issuer != ""
+}
+
+// Validate checks that an enabled identity provider can be verified against
+func (oidc OidcConfig) Validate() error {
+	if !oidc.Enabled() {
+		if oidc.Audience != "" || oidc.Jwks != "" || len(oidc.Rules) > 0 {
+			return errors.New("oidc settings need an issuer")
+		}
+		return nil
+	}
+	if oidc.Audience == "" {
+		return errors.New("oidc needs an audience, so tokens issued for other applications are refused")
+	}
+	if oidc.Jwks == "" {
+		return errors.New("oidc needs a JWKS URL or file")
+	}
+	jwksUrl, err := url.Parse(oidc.Jwks)
+	if err == nil && jwksUrl.Scheme == "http" {
+		return errors.New("the oidc JWKS must be fetched over https")
+	}
+	for _, rule := range oidc.Rules {
+		err = rule.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Authenticator creates the verifier of identity provider tokens. Only valid after Validate
+// @return nil if oidc is disabled
+func (oidc OidcConfig) Authenticator() *auth.OidcAuthenticator {
+	if !oidc.Enabled() {
+		return nil
+	}
+
+	rules := make([]auth.ClaimRule, 0, len(oidc.Rules))
+	for _, ruleConfig := range oidc.Rules {
+		rule, _ := ruleConfig.Rule()
+		rules = append(rules, rule)
+	}
+	return &auth.OidcAuthenticator{
+		Issuer:       oidc.Issuer,
+		Audience:     oidc.Audience,
+		Keys:         auth.NewKeySet(oidc.Jwks),
+		SubjectClaim: oidc.SubjectClaim,
+		Rules:        rules,
+	}
+}
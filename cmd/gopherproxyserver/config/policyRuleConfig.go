@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/CanadianCommander/gopherproxy/cmd/gopherproxyserver/proxy"
+	"github.com/CanadianCommander/gopherproxy/internal/proxcom"
+)
+
+// decisions of a policy rule or a policy default
+const (
+	PolicyAllow = "allow"
+	PolicyDeny  = "deny"
+)
+
+// PolicyRuleConfig allows or denies socket channels that match all of its lists. An empty list matches anything
+type PolicyRuleConfig struct {
+	// allow or deny
+	Decision string `yaml:"decision"`
+	// names of the members that open the socket channel
+	Sources []string `yaml:"sources"`
+	// names of the members that connect to the target
+	Sinks []string `yaml:"sinks"`
+	// a hostname, *.domain, an IP, a CIDR, or unix:<path glob> for unix socket targets
+	Hosts []string `yaml:"hosts"`
+	// ports, e.g. 22, or ranges, e.g. 8000-8999
+	Ports []string `yaml:"ports"`
+	// tcp and/or udp
+	Protocols []string `yaml:"protocols"`
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// Rule validates the config and converts it to the rule the manager evaluates
+func (policyRule PolicyRuleConfig) Rule() (proxy.PolicyRule, error) {
+	if policyRule.Decision != PolicyAllow && policyRule.Decision != PolicyDeny {
+		return proxy.PolicyRule{}, fmt.Errorf("decision %q is not one of %s or %s", policyRule.Decision, PolicyAllow, PolicyDeny)
+	}
+	for _, host := range policyRule.Hosts {
+		err := proxcom.ValidateHostPattern(host)
+		if err != nil {
+			return proxy.PolicyRule{}, err
+		}
+	}
+	for _, protocol := range policyRule.Protocols {
+		if protocol != proxcom.ProtocolTcp && protocol != proxcom.ProtocolUdp {
+			return proxy.PolicyRule{}, fmt.Errorf("protocol %q is not one of tcp or udp", protocol)
+		}
+	}
+	var ports []proxcom.PortRange
+	for _, port := range policyRule.Ports {
+		portRange, err := proxcom.ParsePortRange(port)
+		if err != nil {
+			return proxy.PolicyRule{}, err
+		}
+		ports = append(ports, portRange)
+	}
+
+	return proxy.PolicyRule{
+		Allow:     policyRule.Decision == PolicyAllow,
+		Sources:   policyRule.Sources,
+		Sinks:     policyRule.Sinks,
+		Hosts:     slices.Clone(policyRule.Hosts),
+		Ports:     ports,
+		Protocols: policyRule.Protocols,
+	}, nil
+}
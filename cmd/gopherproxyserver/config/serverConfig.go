@@ -0,0 +1,317 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/CanadianCommander/gopherproxy/cmd/gopherproxyserver/auth"
+	"github.com/CanadianCommander/gopherproxy/cmd/gopherproxyserver/proxy"
+	"github.com/CanadianCommander/gopherproxy/internal/logging"
+	proxylib "github.com/CanadianCommander/gopherproxy/internal/proxy"
+	"go.uber.org/zap/zapcore"
+)
+
+// ServerConfig is everything the proxy server can be configured with.
+// Each setting can come from the config file, an environment variable or a flag. See settings.go
+type ServerConfig struct {
+	// where the http api (websockets and long polling) listens
+	ListenAddress string `yaml:"listenAddress"`
+	// path prefix of the http api
+	BasePath string `yaml:"basePath"`
+	// serve the http api over https. Plain http if empty. Reloaded when the files change or on SIGHUP
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+	// "1.2" or "1.3". Applies to https and the raw tls transport
+	TlsMinVersion string `yaml:"tlsMinVersion"`
+	// names of the TLS 1.2 cipher suites to allow, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. Empty allows Go's defaults
+	TlsCipherSuites []string `yaml:"tlsCipherSuites"`
+	// PEM bundle of the CAs that sign client certificates. Clients cannot authenticate with certificates while it is empty
+	ClientCaFile string `yaml:"clientCaFile"`
+	// refuse clients without a valid certificate during the tls handshake, instead of falling back to passwords and tokens
+	RequireClientCerts bool `yaml:"requireClientCerts"`
+	// which client certificates may join which channels, and under which names. Config file only
+	ClientCertificates []ClientCertificateConfig `yaml:"clientCertificates"`
+
+	LogLevel  string `yaml:"logLevel"`
+	LogFormat string `yaml:"logFormat"`
+
+	// channels declared up front, each with its own password. Config file only
+	Channels []ChannelConfig `yaml:"channels"`
+	// accept clients joining channels that are not declared, the first client to join sets the password.
+	// nil allows them only if no channels are declared. See AllowsAdHocChannels
+	AdHocChannels *bool `yaml:"adHocChannels"`
+	// what happens when a client joins a channel under a name another member has: reject, kick or suffix
+	DuplicateNames string `yaml:"duplicateNames"`
+
+	// signs access tokens, see gopherproxyserver token create. Clients cannot use tokens while it is empty
+	TokenSecret string `yaml:"tokenSecret"`
+	// accept JWTs from an OpenID Connect identity provider as bearer tokens
+	Oidc OidcConfig `yaml:"oidc"`
+	// bearer token of the admin api, which inspects and manages channels. The admin api is disabled while it is empty
+	AdminToken string `yaml:"adminToken"`
+
+	// accept clients that use the legacy gob packet encoding
+	LegacyEncoding bool `yaml:"legacyEncoding"`
+	// zero values use the protocol defaults
+	HeartbeatInterval time.Duration `yaml:"heartbeatInterval"`
+	HeartbeatTimeout  time.Duration `yaml:"heartbeatTimeout"`
+	ResumeGracePeriod time.Duration `yaml:"resumeGracePeriod"`
+
+	// where Prometheus metrics are served, at /metrics. Disabled if empty
+	MetricsListenAddress string `yaml:"metricsListenAddress"`
+
+	// optional raw tls transport. Disabled unless the listen address is set.
+	// Uses the https certificate unless it has its own
+	TlsListenAddress string `yaml:"tlsListenAddress"`
+	TlsCertFile      string `yaml:"tlsCertFile"`
+	TlsKeyFile       string `yaml:"tlsKeyFile"`
+
+	// see proxylib.Config
+	WebsocketReadBufferSize  int           `yaml:"websocketReadBufferSize"`
+	WebsocketWriteBufferSize int           `yaml:"websocketWriteBufferSize"`
+	MaxPacketSize            int           `yaml:"maxPacketSize"`
+	ChannelBufferSize        int           `yaml:"channelBufferSize"`
+	PollQueueSize            int           `yaml:"pollQueueSize"`
+	ReplayBufferSize         int           `yaml:"replayBufferSize"`
+	HandshakeTimeout         time.Duration `yaml:"handshakeTimeout"`
+	PollWaitTimeout          time.Duration `yaml:"pollWaitTimeout"`
+	PollIdleTimeout          time.Duration `yaml:"pollIdleTimeout"`
+}
+
+// ============================================
+// Constructors
+// ============================================
+
+// DefaultServerConfig returns the configuration used for anything that is not configured
+func DefaultServerConfig() ServerConfig {
+	proxyConfig := proxylib.DefaultConfig()
+
+	return ServerConfig{
+		ListenAddress:  "0.0.0.0:8080",
+		BasePath:       "/api",
+		LogLevel:       "info",
+		LogFormat:      logging.JsonFormat,
+		TlsMinVersion:  "1.2",
+		DuplicateNames: string(proxy.SuffixDuplicateNames),
+
+		WebsocketReadBufferSize:  proxyConfig.WebsocketReadBufferSize,
+		WebsocketWriteBufferSize: proxyConfig.WebsocketWriteBufferSize,
+		MaxPacketSize:            proxyConfig.MaxPacketSize,
+		ChannelBufferSize:        proxyConfig.ChannelBufferSize,
+		PollQueueSize:            proxyConfig.PollQueueSize,
+		ReplayBufferSize:         proxyConfig.ReplayBufferSize,
+		HandshakeTimeout:         proxyConfig.HandshakeTimeout,
+		PollWaitTimeout:          proxyConfig.PollWaitTimeout,
+		PollIdleTimeout:          proxyConfig.PollIdleTimeout,
+	}
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// Validate checks the configuration, so the server refuses to start rather than misbehave later
+// @return an error describing the first invalid setting
+func (config ServerConfig) Validate() error {
+	_, _, err := net.SplitHostPort(config.ListenAddress)
+	if err != nil {
+		return fmt.Errorf("listen address %q is not a host:port address", config.ListenAddress)
+	}
+	if !strings.HasPrefix(config.BasePath, "/") {
+		return fmt.Errorf("base path %q must start with /", config.BasePath)
+	}
+	_, err = zapcore.ParseLevel(config.LogLevel)
+	if err != nil {
+		return fmt.Errorf("log level %q is not one of debug, info, warn or error", config.LogLevel)
+	}
+	if config.LogFormat != logging.JsonFormat && config.LogFormat != logging.ConsoleFormat {
+		return fmt.Errorf("log format %q is not one of %s or %s", config.LogFormat, logging.JsonFormat, logging.ConsoleFormat)
+	}
+
+	channelNames := make(map[string]bool)
+	for _, channel := range config.Channels {
+		err = channel.Validate()
+		if err != nil {
+			return err
+		}
+		if channelNames[channel.Name] {
+			return fmt.Errorf("channel %q is declared more than once", channel.Name)
+		}
+		channelNames[channel.Name] = true
+	}
+
+	if config.TokenSecret != "" && len(config.TokenSecret) < auth.MinTokenSecretSize {
+		return fmt.Errorf("the token secret must be at least %d bytes", auth.MinTokenSecretSize)
+	}
+
+	if config.AdminToken != "" && len(config.AdminToken) < auth.MinTokenSecretSize {
+		return fmt.Errorf("the admin token must be at least %d bytes", auth.MinTokenSecretSize)
+	}
+
+	_, err = proxy.ParseDuplicateNamePolicy(config.DuplicateNames)
+	if err != nil {
+		return err
+	}
+
+	err = config.Oidc.Validate()
+	if err != nil {
+		return err
+	}
+
+	for _, certificate := range config.ClientCertificates {
+		err = certificate.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	if config.ClientCaFile == "" && (config.RequireClientCerts || len(config.ClientCertificates) > 0) {
+		return errors.New("client certificates need a client CA file")
+	}
+	if config.ClientCaFile != "" && config.CertFile == "" && config.TlsListenAddress == "" {
+		return errors.New("client certificates need https or the tls transport")
+	}
+
+	if config.HeartbeatInterval < 0 || config.HeartbeatTimeout < 0 || config.ResumeGracePeriod < 0 {
+		return errors.New("heartbeat and resume durations cannot be negative")
+	}
+	if config.HeartbeatInterval > 0 && config.HeartbeatTimeout > 0 && config.HeartbeatTimeout <= config.HeartbeatInterval {
+		return errors.New("heartbeat timeout must be longer than the heartbeat interval")
+	}
+
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return errors.New("https needs both a certificate and a key file")
+	}
+	if (config.TlsCertFile == "") != (config.TlsKeyFile == "") {
+		return errors.New("the tls transport needs both a certificate and a key file")
+	}
+	if config.TlsListenAddress != "" {
+		_, _, err = net.SplitHostPort(config.TlsListenAddress)
+		if err != nil {
+			return fmt.Errorf("tls listen address %q is not a host:port address", config.TlsListenAddress)
+		}
+		certFile, _ := config.TlsTransportKeyPair()
+		if certFile == "" {
+			return errors.New("the tls transport needs a certificate and key file")
+		}
+	}
+	if config.MetricsListenAddress != "" {
+		_, _, err = net.SplitHostPort(config.MetricsListenAddress)
+		if err != nil {
+			return fmt.Errorf("metrics listen address %q is not a host:port address", config.MetricsListenAddress)
+		}
+	}
+	if _, ok := tlsVersions[config.TlsMinVersion]; !ok {
+		return fmt.Errorf("tls min version %q is not one of 1.2 or 1.3", config.TlsMinVersion)
+	}
+	if len(config.TlsCipherSuites) > 0 && config.TlsMinVersion == "1.3" {
+		return errors.New("tls cipher suites only apply to TLS 1.2, the TLS 1.3 suites cannot be configured")
+	}
+	for _, name := range config.TlsCipherSuites {
+		if cipherSuiteId(name) == 0 {
+			return fmt.Errorf("tls cipher suite %q is unknown or insecure", name)
+		}
+	}
+
+	return config.ProxyConfig().Validate()
+}
+
+// Level returns the parsed log level. Only valid after Validate
+func (config ServerConfig) Level() zapcore.Level {
+	level, _ := zapcore.ParseLevel(config.LogLevel)
+	return level
+}
+
+// AllowsAdHocChannels returns true if clients may join channels that are not declared in the config
+func (config ServerConfig) AllowsAdHocChannels() bool {
+	if config.AdHocChannels != nil {
+		return *config.AdHocChannels
+	}
+	return len(config.Channels) == 0
+}
+
+// TlsTransportKeyPair returns the certificate and key files of the raw tls transport.
+// Those of the http api when it does not have its own
+func (config ServerConfig) TlsTransportKeyPair() (string, string) {
+	if config.TlsCertFile != "" {
+		return config.TlsCertFile, config.TlsKeyFile
+	}
+	return config.CertFile, config.KeyFile
+}
+
+// TlsConfig returns the tls settings, without a certificate, shared by https and the raw tls transport.
+// Only valid after Validate
+// @return an error if the client CA file cannot be loaded
+func (config ServerConfig) TlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tlsVersions[config.TlsMinVersion],
+	}
+	for _, name := range config.TlsCipherSuites {
+		tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, cipherSuiteId(name))
+	}
+
+	if config.ClientCaFile != "" {
+		caPem, err := os.ReadFile(config.ClientCaFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		if !tlsConfig.ClientCAs.AppendCertsFromPEM(caPem) {
+			return nil, fmt.Errorf("client CA file %q does not contain any PEM certificates", config.ClientCaFile)
+		}
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if config.RequireClientCerts {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return tlsConfig, nil
+}
+
+// CertificateRules returns the rules client certificates are authorized with. Only valid after Validate
+func (config ServerConfig) CertificateRules() []auth.CertificateRule {
+	rules := make([]auth.CertificateRule, 0, len(config.ClientCertificates))
+	for _, certificate := range config.ClientCertificates {
+		rule, _ := certificate.Rule()
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// ProxyConfig returns the settings that apply to every proxy connection
+func (config ServerConfig) ProxyConfig() proxylib.Config {
+	return proxylib.Config{
+		WebsocketReadBufferSize:  config.WebsocketReadBufferSize,
+		WebsocketWriteBufferSize: config.WebsocketWriteBufferSize,
+		MaxPacketSize:            config.MaxPacketSize,
+		ChannelBufferSize:        config.ChannelBufferSize,
+		PollQueueSize:            config.PollQueueSize,
+		ReplayBufferSize:         config.ReplayBufferSize,
+		HandshakeTimeout:         config.HandshakeTimeout,
+		PollWaitTimeout:          config.PollWaitTimeout,
+		PollIdleTimeout:          config.PollIdleTimeout,
+	}
+}
+
+// ============================================
+// Private Methods
+// ============================================
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// cipherSuiteId looks up a secure cipher suite by name. 0 if there is none
+func cipherSuiteId(name string) uint16 {
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name == name {
+			return suite.ID
+		}
+	}
+	return 0
+}
@@ -0,0 +1,236 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// environment variable naming the config file, when --config is not given
+const ConfigFileEnv = "GOPHERPROXY_CONFIG_FILE"
+
+// setting is one ServerConfig field that can be set with a flag or an environment variable.
+// Precedence, lowest to highest: default, config file, environment variable, flag
+type setting struct {
+	flag   string
+	env    string
+	usage  string
+	isBool bool
+	// parses the value and stores it in the config
+	apply func(config *ServerConfig, value string) error
+}
+
+var settings = []setting{
+	stringSetting("listen", "GOPHERPROXY_LISTEN_ADDRESS", "Address the http api listens on.",
+		func(config *ServerConfig) *string { return &config.ListenAddress }),
+	stringSetting("base-path", "GOPHERPROXY_BASE_PATH", "Path prefix of the http api.",
+		func(config *ServerConfig) *string { return &config.BasePath }),
+	stringSetting("cert", "GOPHERPROXY_CERT_FILE", "PEM certificate to serve the http api over https with. Plain http if empty.",
+		func(config *ServerConfig) *string { return &config.CertFile }),
+	stringSetting("key", "GOPHERPROXY_KEY_FILE", "PEM private key of the https certificate.",
+		func(config *ServerConfig) *string { return &config.KeyFile }),
+	stringSetting("tls-min-version", "GOPHERPROXY_TLS_MIN_VERSION", "Oldest TLS version to accept, 1.2 or 1.3.",
+		func(config *ServerConfig) *string { return &config.TlsMinVersion }),
+	stringListSetting("tls-cipher-suites", "GOPHERPROXY_TLS_CIPHER_SUITES", "Comma separated TLS 1.2 cipher suites to allow. Go's defaults if empty.",
+		func(config *ServerConfig) *[]string { return &config.TlsCipherSuites }),
+	stringSetting("client-ca", "GOPHERPROXY_CLIENT_CA_FILE", "PEM bundle of the CAs that sign client certificates. Client certificates are not accepted if empty.",
+		func(config *ServerConfig) *string { return &config.ClientCaFile }),
+	boolSetting("require-client-certs", "GOPHERPROXY_REQUIRE_CLIENT_CERTS", "Refuse clients that do not present a certificate signed by the client CA.",
+		func(config *ServerConfig) *bool { return &config.RequireClientCerts }),
+	stringSetting("log-level", "GOPHERPROXY_LOG_LEVEL", "debug, info, warn or error.",
+		func(config *ServerConfig) *string { return &config.LogLevel }),
+	stringSetting("log-format", "GOPHERPROXY_LOG_FORMAT", "json or console.",
+		func(config *ServerConfig) *string { return &config.LogFormat }),
+	optionalBoolSetting("ad-hoc-channels", "GOPHERPROXY_AD_HOC_CHANNELS", "Accept clients joining channels that are not declared in the config file. Defaults to true only if no channels are declared.",
+		func(config *ServerConfig) **bool { return &config.AdHocChannels }),
+	stringSetting("duplicate-names", "GOPHERPROXY_DUPLICATE_NAMES", "What happens when a client joins a channel under a name that is taken: reject the newcomer, kick the old client, or suffix the new name.",
+		func(config *ServerConfig) *string { return &config.DuplicateNames }),
+	stringSetting("token-secret", "GOPHERPROXY_TOKEN_SECRET", "Secret of at least 32 bytes that signs access tokens. Prefer the environment variable.",
+		func(config *ServerConfig) *string { return &config.TokenSecret }),
+	stringSetting("admin-token", "GOPHERPROXY_ADMIN_TOKEN", "Bearer token of at least 32 bytes for the admin api. The admin api is disabled if empty. Prefer the environment variable.",
+		func(config *ServerConfig) *string { return &config.AdminToken }),
+	stringSetting("oidc-issuer", "GOPHERPROXY_OIDC_ISSUER", "Issuer of the identity provider tokens to accept. Identity provider tokens are not accepted if empty.",
+		func(config *ServerConfig) *string { return &config.Oidc.Issuer }),
+	stringSetting("oidc-audience", "GOPHERPROXY_OIDC_AUDIENCE", "Audience identity provider tokens must be issued for.",
+		func(config *ServerConfig) *string { return &config.Oidc.Audience }),
+	stringSetting("oidc-jwks", "GOPHERPROXY_OIDC_JWKS", "https URL or file path of the JSON Web Key Set that signs identity provider tokens.",
+		func(config *ServerConfig) *string { return &config.Oidc.Jwks }),
+	stringSetting("oidc-subject-claim", "GOPHERPROXY_OIDC_SUBJECT_CLAIM", "Token claim that identifies the client in logs and the channel state. Defaults to sub.",
+		func(config *ServerConfig) *string { return &config.Oidc.SubjectClaim }),
+	boolSetting("legacy-encoding", "GOPHERPROXY_LEGACY_ENCODING", "Accept clients that use the legacy gob packet encoding.",
+		func(config *ServerConfig) *bool { return &config.LegacyEncoding }),
+	durationSetting("heartbeat-interval", "GOPHERPROXY_HEARTBEAT_INTERVAL", "How often to ping clients. 0 uses the default of 10s.",
+		func(config *ServerConfig) *time.Duration { return &config.HeartbeatInterval }),
+	durationSetting("heartbeat-timeout", "GOPHERPROXY_HEARTBEAT_TIMEOUT", "How long a client may stay silent before it is dropped. 0 uses the default of 30s.",
+		func(config *ServerConfig) *time.Duration { return &config.HeartbeatTimeout }),
+	durationSetting("resume-grace-period", "GOPHERPROXY_RESUME_GRACE_PERIOD", "How long a disconnected client keeps its session. 0 uses the default of 60s.",
+		func(config *ServerConfig) *time.Duration { return &config.ResumeGracePeriod }),
+	stringSetting("metrics-listen", "GOPHERPROXY_METRICS_LISTEN_ADDRESS", "Address Prometheus metrics are served on, at /metrics. Disabled if empty.",
+		func(config *ServerConfig) *string { return &config.MetricsListenAddress }),
+	stringSetting("tls-listen", "GOPHERPROXY_TLS_LISTEN_ADDRESS", "Address the raw tls transport listens on. Disabled if empty.",
+		func(config *ServerConfig) *string { return &config.TlsListenAddress }),
+	stringSetting("tls-cert", "GOPHERPROXY_TLS_CERT_FILE", "PEM certificate of the raw tls transport. Defaults to the https certificate.",
+		func(config *ServerConfig) *string { return &config.TlsCertFile }),
+	stringSetting("tls-key", "GOPHERPROXY_TLS_KEY_FILE", "PEM private key of the raw tls transport.",
+		func(config *ServerConfig) *string { return &config.TlsKeyFile }),
+	intSetting("ws-read-buffer-size", "GOPHERPROXY_WS_READ_BUFFER_SIZE", "Websocket read buffer size in bytes.",
+		func(config *ServerConfig) *int { return &config.WebsocketReadBufferSize }),
+	intSetting("ws-write-buffer-size", "GOPHERPROXY_WS_WRITE_BUFFER_SIZE", "Websocket write buffer size in bytes.",
+		func(config *ServerConfig) *int { return &config.WebsocketWriteBufferSize }),
+	intSetting("max-packet-size", "GOPHERPROXY_MAX_PACKET_SIZE", "Largest packet payload accepted from clients, in bytes.",
+		func(config *ServerConfig) *int { return &config.MaxPacketSize }),
+	intSetting("channel-buffer-size", "GOPHERPROXY_CHANNEL_BUFFER_SIZE", "Packets queued per client connection before writers block.",
+		func(config *ServerConfig) *int { return &config.ChannelBufferSize }),
+	intSetting("poll-queue-size", "GOPHERPROXY_POLL_QUEUE_SIZE", "Messages queued per long polling client before writers block.",
+		func(config *ServerConfig) *int { return &config.PollQueueSize }),
+	intSetting("replay-buffer-size", "GOPHERPROXY_REPLAY_BUFFER_SIZE", "Unacknowledged bytes kept per client session so it can resume, shared by its parallel connections.",
+		func(config *ServerConfig) *int { return &config.ReplayBufferSize }),
+	durationSetting("handshake-timeout", "GOPHERPROXY_HANDSHAKE_TIMEOUT", "How long a client has to complete the protocol handshake.",
+		func(config *ServerConfig) *time.Duration { return &config.HandshakeTimeout }),
+	durationSetting("poll-wait-timeout", "GOPHERPROXY_POLL_WAIT_TIMEOUT", "How long a long poll is held open while there is nothing to send.",
+		func(config *ServerConfig) *time.Duration { return &config.PollWaitTimeout }),
+	durationSetting("poll-idle-timeout", "GOPHERPROXY_POLL_IDLE_TIMEOUT", "How long a long polling client may go without polling before it is dropped.",
+		func(config *ServerConfig) *time.Duration { return &config.PollIdleTimeout }),
+}
+
+// ============================================
+// Constructors
+// ============================================
+
+func stringSetting(flag string, env string, usage string, field func(config *ServerConfig) *string) setting {
+	return setting{flag: flag, env: env, usage: usage, apply: func(config *ServerConfig, value string) error {
+		*field(config) = value
+		return nil
+	}}
+}
+
+func stringListSetting(flag string, env string, usage string, field func(config *ServerConfig) *[]string) setting {
+	return setting{flag: flag, env: env, usage: usage, apply: func(config *ServerConfig, value string) error {
+		list := make([]string, 0)
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if item != "" {
+				list = append(list, item)
+			}
+		}
+		*field(config) = list
+		return nil
+	}}
+}
+
+func boolSetting(flag string, env string, usage string, field func(config *ServerConfig) *bool) setting {
+	return setting{flag: flag, env: env, usage: usage, isBool: true, apply: func(config *ServerConfig, value string) error {
+		parsed, err := strconv.ParseBool(value)
+		*field(config) = parsed
+		return err
+	}}
+}
+
+func optionalBoolSetting(flag string, env string, usage string, field func(config *ServerConfig) **bool) setting {
+	return setting{flag: flag, env: env, usage: usage, isBool: true, apply: func(config *ServerConfig, value string) error {
+		parsed, err := strconv.ParseBool(value)
+		*field(config) = &parsed
+		return err
+	}}
+}
+
+func intSetting(flag string, env string, usage string, field func(config *ServerConfig) *int) setting {
+	return setting{flag: flag, env: env, usage: usage, apply: func(config *ServerConfig, value string) error {
+		parsed, err := strconv.Atoi(value)
+		*field(config) = parsed
+		return err
+	}}
+}
+
+func durationSetting(flag string, env string, usage string, field func(config *ServerConfig) *time.Duration) setting {
+	return setting{flag: flag, env: env, usage: usage, apply: func(config *ServerConfig, value string) error {
+		parsed, err := time.ParseDuration(value)
+		*field(config) = parsed
+		return err
+	}}
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// Load builds the server configuration from the config file, the environment and the command line, and validates it
+// @param args: the command line arguments, without the program name
+// @return the configuration, flag.ErrHelp if the user asked for help, or an error describing the invalid setting
+func Load(args []string) (ServerConfig, error) {
+	flagSet := flag.NewFlagSet("gopherproxyserver", flag.ContinueOnError)
+	configFile := flagSet.String("config", os.Getenv(ConfigFileEnv), "YAML config file. Env: "+ConfigFileEnv)
+	flagValues := make(map[string]string)
+	for _, setting := range settings {
+		store := func(value string) error {
+			flagValues[setting.flag] = value
+			return nil
+		}
+		usage := setting.usage + " Env: " + setting.env
+		if setting.isBool {
+			flagSet.BoolFunc(setting.flag, usage, store)
+		} else {
+			flagSet.Func(setting.flag, usage, store)
+		}
+	}
+	err := flagSet.Parse(args)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	if flagSet.NArg() > 0 {
+		return ServerConfig{}, fmt.Errorf("unexpected argument %q", flagSet.Arg(0))
+	}
+
+	config := DefaultServerConfig()
+	if *configFile != "" {
+		err = readConfigFile(*configFile, &config)
+		if err != nil {
+			return ServerConfig{}, err
+		}
+	}
+
+	for _, setting := range settings {
+		if value, ok := os.LookupEnv(setting.env); ok && value != "" {
+			err = setting.apply(&config, value)
+			if err != nil {
+				return ServerConfig{}, fmt.Errorf("invalid value %q for %s: %w", value, setting.env, err)
+			}
+		}
+		if value, ok := flagValues[setting.flag]; ok {
+			err = setting.apply(&config, value)
+			if err != nil {
+				return ServerConfig{}, fmt.Errorf("invalid value %q for --%s: %w", value, setting.flag, err)
+			}
+		}
+	}
+
+	return config, config.Validate()
+}
+
+// ============================================
+// Private Methods
+// ============================================
+
+// readConfigFile decodes a YAML config file on top of the given configuration. Unknown keys are rejected
+func readConfigFile(path string, config *ServerConfig) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	err = decoder.Decode(config)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
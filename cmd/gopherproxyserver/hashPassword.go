@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/term"
+)
+
+// hashPasswordCommand prints the bcrypt hash of a channel password, for the channels section of the config file
+const hashPasswordCommand = "hash-password"
+
+// ============================================
+// Private Methods
+// ============================================
+
+// hashPassword reads a password from stdin and prints its bcrypt hash
+func hashPassword() error {
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+	if password == "" {
+		return errors.New("the password cannot be empty")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(hash))
+	return nil
+}
+
+// readPassword prompts for the password without echoing it, or reads the first line when stdin is not a terminal
+func readPassword() (string, error) {
+	stdin := int(os.Stdin.Fd())
+	if !term.IsTerminal(stdin) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Fprint(os.Stderr, "Channel password: ")
+	password, err := term.ReadPassword(stdin)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Fprint(os.Stderr, "Repeat password: ")
+	repeated, err := term.ReadPassword(stdin)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if string(password) != string(repeated) {
+		return "", errors.New("the passwords do not match")
+	}
+	return string(password), nil
+}
@@ -1,18 +1,158 @@
 package main
 
 import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
 	"github.com/CanadianCommander/gopherproxy/cmd/gopherproxyserver/api"
+	"github.com/CanadianCommander/gopherproxy/cmd/gopherproxyserver/config"
+	"github.com/CanadianCommander/gopherproxy/cmd/gopherproxyserver/proxy"
 	"github.com/CanadianCommander/gopherproxy/internal/logging"
+	proxylib "github.com/CanadianCommander/gopherproxy/internal/proxy"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
 func main() {
-	logging.CreateLogger(zap.InfoLevel)
+	if len(os.Args) > 1 && os.Args[1] == hashPasswordCommand {
+		err := hashPassword()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to hash the password: "+err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 2 && os.Args[1] == tokenCommand && os.Args[2] == tokenCreateCommand {
+		err := createToken(os.Args[3:])
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		} else if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to create the token: "+err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	serverConfig, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid configuration: "+err.Error())
+		os.Exit(2)
+	}
+
+	err = logging.CreateLoggerWithFormat(serverConfig.Level(), serverConfig.LogFormat)
+	if err != nil {
+		panic("Failed to create the logger: " + err.Error())
+	}
+	err = proxylib.Configure(serverConfig.ProxyConfig())
+	if err != nil {
+		panic("Invalid proxy configuration: " + err.Error())
+	}
+
+	for _, channel := range serverConfig.Channels {
+		err = proxy.Channels.Register(channel.Name, channel.PasswordHash)
+		if err != nil {
+			panic("Invalid channel configuration: " + err.Error())
+		}
+		if channel.Policy != nil {
+			policy, _ := channel.Policy.Policy()
+			proxy.Channels.SetPolicy(channel.Name, policy)
+		}
+	}
+	proxy.Channels.AllowAdHoc(serverConfig.AllowsAdHocChannels())
+	duplicateNames, _ := proxy.ParseDuplicateNamePolicy(serverConfig.DuplicateNames)
+	proxy.Manager.SetDuplicateNamePolicy(duplicateNames)
+	api.TokenSecret = []byte(serverConfig.TokenSecret)
+	api.AdminToken = []byte(serverConfig.AdminToken)
+	api.CertificateRules = serverConfig.CertificateRules()
+	api.Oidc = serverConfig.Oidc.Authenticator()
+	if api.Oidc != nil {
+		// fetched again on demand, so the server can start while the identity provider is down
+		err = api.Oidc.Keys.Refresh()
+		if err != nil {
+			logging.Get().Warnw("Failed to load the oidc key set", "source", serverConfig.Oidc.Jwks, "error", err)
+		}
+	}
+
+	// compatibility switch for clients that still speak the gob packet encoding
+	api.AllowLegacyEncoding = serverConfig.LegacyEncoding
+	api.HeartbeatInterval = serverConfig.HeartbeatInterval
+	api.HeartbeatTimeout = serverConfig.HeartbeatTimeout
+	api.ResumeGracePeriod = serverConfig.ResumeGracePeriod
+
+	// GIN_MODE still wins, otherwise gin only runs in debug mode when we log at debug level
+	if os.Getenv(gin.EnvGinMode) == "" && serverConfig.Level() != zap.DebugLevel {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
 	var gin = gin.Default()
-	var apiGroup = gin.Group("/api")
+	var apiGroup = gin.Group(serverConfig.BasePath)
 
 	api.CreateApi(apiGroup)
+	if serverConfig.AdminToken != "" {
+		api.CreateAdminApi(apiGroup)
+	}
+
+	if serverConfig.MetricsListenAddress != "" {
+		_, err = api.ListenMetrics(serverConfig.MetricsListenAddress)
+		if err != nil {
+			panic("Failed to start the metrics listener: " + err.Error())
+		}
+	}
+
+	// optional raw tls transport, for clients that connect with gopher+tls:// urls
+	if serverConfig.TlsListenAddress != "" {
+		certFile, keyFile := serverConfig.TlsTransportKeyPair()
+		tlsConfig, err := newTlsConfig(serverConfig, certFile, keyFile)
+		if err != nil {
+			panic("Failed to load the tls transport certificate: " + err.Error())
+		}
+		_, err = api.ListenTls(serverConfig.TlsListenAddress, tlsConfig)
+		if err != nil {
+			panic("Failed to start the tls transport listener: " + err.Error())
+		}
+	}
+
+	server := &http.Server{
+		Addr:    serverConfig.ListenAddress,
+		Handler: gin,
+	}
+	logging.Get().Infow("Starting proxy server",
+		"listenAddress", serverConfig.ListenAddress,
+		"basePath", serverConfig.BasePath,
+		"https", serverConfig.CertFile != "")
+	if serverConfig.CertFile != "" {
+		server.TLSConfig, err = newTlsConfig(serverConfig, serverConfig.CertFile, serverConfig.KeyFile)
+		if err != nil {
+			panic("Failed to load the https certificate: " + err.Error())
+		}
+		// the certificate comes from the tls config, so it can be reloaded
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil {
+		panic("Failed to start the http api: " + err.Error())
+	}
+}
+
+// newTlsConfig creates the server tls settings for a certificate that is reloaded when it changes
+func newTlsConfig(serverConfig config.ServerConfig, certFile string, keyFile string) (*tls.Config, error) {
+	tlsConfig, err := serverConfig.TlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	reloader, err := api.NewCertificateReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	reloader.Watch()
 
-	gin.Run("0.0.0.0:8080")
+	tlsConfig.GetCertificate = reloader.GetCertificate
+	return tlsConfig, nil
 }
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/CanadianCommander/gopherproxy/internal/logging"
+	"github.com/CanadianCommander/gopherproxy/internal/proxcom"
+)
+
+// ChannelPolicy decides which socket channels members of a channel may open. The first matching rule wins
+type ChannelPolicy struct {
+	// the decision when no rule matches
+	DefaultAllow bool
+	Rules        []PolicyRule
+}
+
+// how long the server waits for a target host to resolve before treating it as unresolvable
+const policyResolveTimeout = 2 * time.Second
+
+// ============================================
+// Public Methods
+// ============================================
+
+// Evaluate decides whether a socket channel is allowed
+// @param source, sink: names of the members the socket channel connects
+// @param forwardingRule: the forwarding rule the socket channel is created for
+// @param addresses: the addresses the target host resolves to, see resolveTarget. Empty if it could not be resolved
+// @return allowed, and the index of the rule that decided. -1 for the default
+func (policy *ChannelPolicy) Evaluate(source string, sink string, forwardingRule proxcom.ForwardingRule, addresses []netip.Addr) (bool, int) {
+	for index, rule := range policy.Rules {
+		if rule.Matches(source, sink, forwardingRule, addresses) {
+			return rule.Allow, index
+		}
+	}
+	return policy.DefaultAllow, -1
+}
+
+// MatchesAddresses returns true if any rule has an IP or CIDR host pattern, so targets have to be resolved
+func (policy *ChannelPolicy) MatchesAddresses() bool {
+	for _, rule := range policy.Rules {
+		if slices.ContainsFunc(rule.Hosts, proxcom.IsAddressPattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// ============================================
+// Private Methods
+// ============================================
+
+// resolveTarget looks up the addresses of the target host of a forwarding rule, so IP and CIDR rules can be
+// applied to hostnames. The sink resolves the name again when it dials, with its own DNS
+// @return the addresses, empty if the host could not be resolved or the target is a unix socket
+func resolveTarget(forwardingRule proxcom.ForwardingRule) []netip.Addr {
+	if forwardingRule.RemoteSocket != "" {
+		return nil
+	}
+	host := strings.TrimSuffix(forwardingRule.RemoteHost, ".")
+	address, err := netip.ParseAddr(host)
+	if err == nil {
+		return []netip.Addr{address.Unmap()}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), policyResolveTimeout)
+	defer cancel()
+	addresses, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		logging.Get().Warnw("Could not resolve socket channel target for the channel policy", "host", host, "error", err)
+		return nil
+	}
+	for index := range addresses {
+		addresses[index] = addresses[index].Unmap()
+	}
+	return addresses
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/CanadianCommander/gopherproxy/internal/proxcom"
+)
+
+func TestChannelPolicyEvaluate(t *testing.T) {
+	loopback := []netip.Addr{netip.MustParseAddr("127.0.0.1")}
+	mixed := []netip.Addr{netip.MustParseAddr("10.0.0.5"), netip.MustParseAddr("127.0.0.1")}
+	internal := []netip.Addr{netip.MustParseAddr("10.0.0.5")}
+
+	denyLoopback := &ChannelPolicy{
+		DefaultAllow: true,
+		Rules: []PolicyRule{
+			{Allow: false, Hosts: []string{"127.0.0.0/8"}},
+		},
+	}
+	bastionOnly := &ChannelPolicy{
+		DefaultAllow: false,
+		Rules: []PolicyRule{
+			{Allow: false, Sources: []string{"guest"}},
+			{Allow: true, Sources: []string{"laptop"}, Sinks: []string{"bastion"}, Hosts: []string{"10.0.0.0/8", "*.internal"}, Ports: []proxcom.PortRange{{From: 22, To: 22}, {From: 8000, To: 8999}}},
+			{Allow: true, Hosts: []string{"unix:/var/run/*.sock"}, Protocols: []string{proxcom.ProtocolTcp}},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		policy    *ChannelPolicy
+		source    string
+		sink      string
+		rule      proxcom.ForwardingRule
+		addresses []netip.Addr
+		want      bool
+		wantIndex int
+	}{
+		{"ip literal denied", denyLoopback, "laptop", "bastion", proxcom.ForwardingRule{RemoteHost: "127.0.0.1", RemotePort: 22}, loopback, false, 0},
+		{"hostname resolving to a denied address", denyLoopback, "laptop", "bastion", proxcom.ForwardingRule{RemoteHost: "localhost", RemotePort: 22}, loopback, false, 0},
+		{"hostname with one denied address", denyLoopback, "laptop", "bastion", proxcom.ForwardingRule{RemoteHost: "sneaky.example.com", RemotePort: 22}, mixed, false, 0},
+		{"unresolvable hostname fails closed", denyLoopback, "laptop", "bastion", proxcom.ForwardingRule{RemoteHost: "nowhere.invalid", RemotePort: 22}, nil, false, 0},
+		{"hostname resolving elsewhere", denyLoopback, "laptop", "bastion", proxcom.ForwardingRule{RemoteHost: "db.internal", RemotePort: 22}, internal, true, -1},
+		{"allowed ip literal", bastionOnly, "laptop", "bastion", proxcom.ForwardingRule{RemoteHost: "10.0.0.5", RemotePort: 8080}, internal, true, 1},
+		{"allowed hostname pattern", bastionOnly, "laptop", "bastion", proxcom.ForwardingRule{RemoteHost: "db.internal", RemotePort: 22}, nil, true, 1},
+		{"allow needs every address", bastionOnly, "laptop", "bastion", proxcom.ForwardingRule{RemoteHost: "sneaky.example.com", RemotePort: 22}, mixed, false, -1},
+		{"unresolvable hostname is not allowed by cidr", bastionOnly, "laptop", "bastion", proxcom.ForwardingRule{RemoteHost: "sneaky.example.com", RemotePort: 22}, nil, false, -1},
+		{"port outside the ranges", bastionOnly, "laptop", "bastion", proxcom.ForwardingRule{RemoteHost: "10.0.0.5", RemotePort: 443}, internal, false, -1},
+		{"other sink", bastionOnly, "laptop", "desktop", proxcom.ForwardingRule{RemoteHost: "10.0.0.5", RemotePort: 22}, internal, false, -1},
+		{"first match wins", bastionOnly, "guest", "bastion", proxcom.ForwardingRule{RemoteHost: "10.0.0.5", RemotePort: 22}, internal, false, 0},
+		{"unix socket", bastionOnly, "laptop", "desktop", proxcom.ForwardingRule{RemoteSocket: "/var/run/docker.sock"}, nil, true, 2},
+		{"protocol mismatch", bastionOnly, "laptop", "desktop", proxcom.ForwardingRule{Protocol: proxcom.ProtocolUdp, RemoteSocket: "/var/run/docker.sock"}, nil, false, -1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			allowed, index := test.policy.Evaluate(test.source, test.sink, test.rule, test.addresses)
+			if allowed != test.want || index != test.wantIndex {
+				t.Errorf("Evaluate() = %v, %d, want %v, %d", allowed, index, test.want, test.wantIndex)
+			}
+		})
+	}
+}
+
+func TestResolveTarget(t *testing.T) {
+	addresses := resolveTarget(proxcom.ForwardingRule{RemoteHost: "::ffff:10.0.0.1"})
+	if len(addresses) != 1 || addresses[0] != netip.MustParseAddr("10.0.0.1") {
+		t.Errorf("resolveTarget(ip literal) = %v, want [10.0.0.1]", addresses)
+	}
+	if addresses := resolveTarget(proxcom.ForwardingRule{RemoteSocket: "/var/run/docker.sock"}); len(addresses) != 0 {
+		t.Errorf("resolveTarget(unix socket) = %v, want none", addresses)
+	}
+}
+
+func TestChannelPolicyMatchesAddresses(t *testing.T) {
+	if (&ChannelPolicy{Rules: []PolicyRule{{Hosts: []string{"*.internal", "unix:/tmp/*"}}}}).MatchesAddresses() {
+		t.Error("MatchesAddresses() = true for a policy without IP or CIDR hosts")
+	}
+	if !(&ChannelPolicy{Rules: []PolicyRule{{Hosts: []string{"*.internal"}}, {Hosts: []string{"10.0.0.0/8"}}}}).MatchesAddresses() {
+		t.Error("MatchesAddresses() = false for a policy with a CIDR host")
+	}
+}
@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"errors"
+	"sync"
+
+	proxylib "github.com/CanadianCommander/gopherproxy/internal/proxy"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// channelRegistry holds the channels declared in the server config, with the bcrypt hash of their passwords.
+// Channels that are not registered are ad-hoc: the first client to join sets the password. See AllowAdHoc
+type channelRegistry struct {
+	channels map[string][]byte
+	// socket channel policies of registered channels. Channels without one allow every socket channel
+	policies map[string]*ChannelPolicy
+	// accept clients joining channels that are not registered
+	allowAdHoc bool
+	mutex      sync.RWMutex
+}
+
+var Channels = channelRegistry{
+	channels:   make(map[string][]byte),
+	policies:   make(map[string]*ChannelPolicy),
+	allowAdHoc: true,
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// Register declares a channel. Clients can only join it with the password matching the hash
+// @param name: the channel name
+// @param passwordHash: bcrypt hash of the channel password
+func (registry *channelRegistry) Register(name string, passwordHash string) error {
+	if name == "" {
+		return errors.New("channel name cannot be empty")
+	}
+	_, err := bcrypt.Cost([]byte(passwordHash))
+	if err != nil {
+		return errors.New("password hash of channel " + name + " is not a bcrypt hash: " + err.Error())
+	}
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	registry.channels[name] = []byte(passwordHash)
+	return nil
+}
+
+// SetPolicy sets the policy that decides which socket channels members of a channel may open
+// @param name: the channel name
+// @param policy: the policy, or nil to allow every socket channel
+func (registry *channelRegistry) SetPolicy(name string, policy *ChannelPolicy) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	registry.policies[name] = policy
+}
+
+// AllowAdHoc sets whether clients may join, and so create, channels that are not registered
+func (registry *channelRegistry) AllowAdHoc(allow bool) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	registry.allowAdHoc = allow
+}
+
+// ============================================
+// Private Methods
+// ============================================
+
+// names returns the names of the registered channels
+func (registry *channelRegistry) names() []string {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	names := make([]string, 0, len(registry.channels))
+	for name := range registry.channels {
+		names = append(names, name)
+	}
+	return names
+}
+
+// policy returns the socket channel policy of a channel, nil if it has none
+func (registry *channelRegistry) policy(channel string) *ChannelPolicy {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	return registry.policies[channel]
+}
+
+// authenticate checks the password of a client joining a channel
+// @return registered: true if the channel is registered. Ad-hoc channels are checked by the manager
+// @return an AuthenticationError for a wrong password, or an ErrorUnknownChannel ErrorPacket
+// if the channel is not registered and ad-hoc channels are not allowed
+func (registry *channelRegistry) authenticate(channel string, password string) (bool, error) {
+	registry.mutex.RLock()
+	hash, registered := registry.channels[channel]
+	allowAdHoc := registry.allowAdHoc
+	registry.mutex.RUnlock()
+
+	if !registered {
+		if !allowAdHoc {
+			return false, proxylib.NewErrorPacket(proxylib.ErrorUnknownChannel, "Unknown channel: "+channel)
+		}
+		return false, nil
+	}
+
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return true, proxylib.NewAuthenticationError("Invalid password for channel: " + channel)
+	}
+	return true, nil
+}
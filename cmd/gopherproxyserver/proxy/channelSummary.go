@@ -0,0 +1,12 @@
+package proxy
+
+// ChannelSummary describes a channel for the admin api
+type ChannelSummary struct {
+	Name string `json:"name"`
+	// declared in the server config, rather than created by the first client to join
+	Registered bool `json:"registered"`
+	// locked channels refuse new members
+	Locked         bool `json:"locked"`
+	Members        int  `json:"members"`
+	SocketChannels int  `json:"socketChannels"`
+}
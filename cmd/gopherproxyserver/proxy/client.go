@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"github.com/CanadianCommander/gopherproxy/cmd/gopherproxyserver/auth"
 	"github.com/CanadianCommander/gopherproxy/internal/proxcom"
 	proxylib "github.com/CanadianCommander/gopherproxy/internal/proxy"
 	"github.com/google/uuid"
@@ -10,6 +11,8 @@ type Client struct {
 	Id          uuid.UUID
 	ProxyClient *proxylib.ProxyClient
 	MemberInfo  *proxcom.ChannelMember
+	// who the client authenticated as, and what it may do
+	Identity *auth.Identity
 }
 
 // ============================================
@@ -0,0 +1,31 @@
+package proxy
+
+import "fmt"
+
+// DuplicateNamePolicy decides what happens when a client joins a channel under a name another member already has.
+// Names must be unique, forwarding rules find their remote client by name
+type DuplicateNamePolicy string
+
+const (
+	// refuse the newcomer with an ErrorNameTaken error
+	RejectDuplicateNames DuplicateNamePolicy = "reject"
+	// disconnect the member that has the name, the newcomer takes over.
+	// Only if both authenticated as the same identity, otherwise the newcomer is rejected
+	KickDuplicateNames DuplicateNamePolicy = "kick"
+	// the newcomer joins as name-2, name-3, ... Newcomers whose credential restricts their names are rejected
+	SuffixDuplicateNames DuplicateNamePolicy = "suffix"
+)
+
+// ============================================
+// Constructors
+// ============================================
+
+// ParseDuplicateNamePolicy validates a duplicate name policy name
+func ParseDuplicateNamePolicy(name string) (DuplicateNamePolicy, error) {
+	switch policy := DuplicateNamePolicy(name); policy {
+	case RejectDuplicateNames, KickDuplicateNames, SuffixDuplicateNames:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("duplicate name policy %q is not one of %s, %s or %s", name, RejectDuplicateNames, KickDuplicateNames, SuffixDuplicateNames)
+	}
+}
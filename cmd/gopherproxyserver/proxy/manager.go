@@ -2,9 +2,17 @@ package proxy
 
 import (
 	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/CanadianCommander/gopherproxy/cmd/gopherproxyserver/auth"
 	"github.com/CanadianCommander/gopherproxy/internal/logging"
+	"github.com/CanadianCommander/gopherproxy/internal/metrics"
 	"github.com/CanadianCommander/gopherproxy/internal/proxcom"
 	"github.com/CanadianCommander/gopherproxy/internal/proxy"
 	proxylib "github.com/CanadianCommander/gopherproxy/internal/proxy"
@@ -16,29 +24,78 @@ type manager struct {
 	clientsMutex   sync.Mutex
 	socketChannels map[string][]*SocketChannel
 	socketMutex    sync.Mutex
+	// last socket channel id handed out. Used to assign compact stream ids
+	lastSocketChannelId atomic.Uint32
+	// what to do when a client joins under a name that is taken. Guarded by clientsMutex
+	duplicateNames DuplicateNamePolicy
+	// channels that do not accept new members. Guarded by clientsMutex
+	locked map[string]bool
 }
 
 var Manager = manager{
 	clients:        make(map[string][]*Client),
 	socketChannels: make(map[string][]*SocketChannel),
+	duplicateNames: SuffixDuplicateNames,
+	locked:         make(map[string]bool),
 }
 
+// how long a kicked client has to receive its error before the server closes the connection
+const kickCloseDelay = 5 * time.Second
+
 // ============================================
 // Public Methods
 // ============================================
 
+// SetDuplicateNamePolicy sets what happens when a client joins a channel under a name another member already has
+func (manager *manager) SetDuplicateNamePolicy(policy DuplicateNamePolicy) {
+	manager.clientsMutex.Lock()
+	defer manager.clientsMutex.Unlock()
+
+	manager.duplicateNames = policy
+}
+
 // AddEndpoint adds a new endpoint to the proxy manager
-func (manager *manager) AddEndpoint(endpoint *proxylib.ProxyClient) error {
+// @param endpoint: the connected client
+// @param identity: who the client authenticated as, or nil if it has to prove it knows the channel password
+func (manager *manager) AddEndpoint(endpoint *proxylib.ProxyClient, identity *auth.Identity) error {
+	registered := false
+	if identity == nil {
+		// bcrypt is slow on purpose, check before taking the lock
+		var err error
+		registered, err = Channels.authenticate(endpoint.Settings.Channel, endpoint.Settings.Password)
+		if err != nil {
+			return err
+		}
+	}
+
 	manager.clientsMutex.Lock()
 	defer manager.clientsMutex.Unlock()
 
 	newClient := NewClient(endpoint, nil)
 
-	if !manager.checkChannelPasswords(endpoint.Settings.Channel, endpoint.Settings.Password) {
-		return proxylib.NewAuthenticationError("Invalid password for channel: " + endpoint.Settings.Channel)
+	if identity == nil {
+		if !registered && !manager.checkChannelPasswords(endpoint.Settings.Channel, endpoint.Settings.Password) {
+			return proxylib.NewAuthenticationError("Invalid password for channel: " + endpoint.Settings.Channel)
+		}
+		identity = auth.NewPasswordIdentity()
+	}
+	newClient.Identity = identity
+
+	if manager.locked[endpoint.Settings.Channel] {
+		logging.Get().Warnw("Rejected client joining a locked channel", "channel", endpoint.Settings.Channel, "name", endpoint.Settings.Name, "id", endpoint.Id)
+		return proxylib.NewErrorPacket(proxylib.ErrorChannelLocked, "Channel "+endpoint.Settings.Channel+" is locked")
 	}
 
-	logging.Get().Infow("Adding new endpoint to manager", "channel", endpoint.Settings.Channel, "name", endpoint.Settings.Name, "id", endpoint.Id)
+	err := manager.resolveDuplicateName(endpoint, identity)
+	if err != nil {
+		return err
+	}
+
+	logging.Get().Infow("Adding new endpoint to manager",
+		"channel", endpoint.Settings.Channel,
+		"name", endpoint.Settings.Name,
+		"id", endpoint.Id,
+		"identity", identity.String())
 
 	if manager.clients[endpoint.Settings.Channel] == nil {
 		manager.clients[endpoint.Settings.Channel] = make([]*Client, 0)
@@ -66,6 +123,8 @@ func (manager *manager) RemoveEndpoint(channel string, id uuid.UUID) error {
 		if endpoint.Id == id {
 			logging.Get().Infow("Removing endpoint from manager", "channel", channel, "id", id)
 			manager.clients[channel] = append(manager.clients[channel][:i], manager.clients[channel][i+1:]...)
+			manager.dropSocketChannelsOf(endpoint)
+			break
 		}
 	}
 
@@ -77,22 +136,21 @@ func (manager *manager) RemoveEndpoint(channel string, id uuid.UUID) error {
 // @param client: the client that is establishing the channel
 // @param chanCreatePacket: the packet containing the channel information
 func (manager *manager) EstablishNewChannel(client *Client, chanCreatePacket *proxcom.CreateSocketChannelPacket) {
+	// resolved before taking the lock, a slow DNS server must not hold up every other socket channel
+	var addresses []netip.Addr
+	policy := Channels.policy(client.ProxyClient.Settings.Channel)
+	if policy != nil && policy.MatchesAddresses() {
+		addresses = resolveTarget(chanCreatePacket.ForwardingRule)
+	}
+
 	manager.socketMutex.Lock()
 	defer manager.socketMutex.Unlock()
 	logging.Get().Infow("Establishing new channel", "client", client.Id, "packet", chanCreatePacket)
 
-	// assign the channel id and repack
-	chanCreatePacket.Id = uuid.NewString()
-	newPacket, err := proxy.NewPacketFromStruct(&chanCreatePacket, proxy.SocketConnect)
-	if err != nil {
-		logging.Get().Errorw("Failed to repack socket connect packet", "error", err)
-		return
-	}
-
 	// find the sink client
 	var sinkClient *Client = nil
 	for _, chanClient := range manager.clients[client.ProxyClient.Settings.Channel] {
-		if chanClient.MemberInfo.Id == chanCreatePacket.Sink.Id {
+		if chanClient.MemberInfo != nil && chanClient.MemberInfo.Id == chanCreatePacket.Sink.Id {
 			sinkClient = chanClient
 			break
 		}
@@ -101,12 +159,55 @@ func (manager *manager) EstablishNewChannel(client *Client, chanCreatePacket *pr
 	// find the source client
 	var sourceClient *Client = nil
 	for _, chanClient := range manager.clients[client.ProxyClient.Settings.Channel] {
-		if chanClient.MemberInfo.Id == chanCreatePacket.Source.Id {
+		if chanClient.MemberInfo != nil && chanClient.MemberInfo.Id == chanCreatePacket.Source.Id {
 			sourceClient = chanClient
 			break
 		}
 	}
 
+	if sinkClient == nil || sourceClient == nil {
+		logging.Get().Warnw("Socket channel requested between unknown channel members", "client", client.Id, "requestId", chanCreatePacket.RequestId)
+		errorPacket := proxylib.NewErrorPacket(proxylib.ErrorUnknownMember, "The remote client is not connected to the channel")
+		errorPacket.RequestId = chanCreatePacket.RequestId
+		client.ProxyClient.Write(*errorPacket.ToPacket(proxylib.Error))
+		return
+	}
+	if sourceClient != client {
+		// a member may only open socket channels for itself, sinks rely on the source being who it says
+		logging.Get().Warnw("Socket channel requested on behalf of another member", "client", client.Id, "requestId", chanCreatePacket.RequestId)
+		errorPacket := proxylib.NewErrorPacket(proxylib.ErrorForbidden, "Socket channels can only be opened by their source")
+		errorPacket.RequestId = chanCreatePacket.RequestId
+		client.ProxyClient.Write(*errorPacket.ToPacket(proxylib.Error))
+		return
+	}
+	if !sourceClient.Identity.Permits(auth.ActionForward) || !sinkClient.Identity.Permits(auth.ActionExpose) {
+		logging.Get().Warnw("Socket channel refused. A member is not allowed to take part",
+			"source", sourceClient.ProxyClient.Settings.Name,
+			"sink", sinkClient.ProxyClient.Settings.Name,
+			"sourceIdentity", sourceClient.Identity.String(),
+			"sinkIdentity", sinkClient.Identity.String(),
+			"requestId", chanCreatePacket.RequestId)
+		errorPacket := proxylib.NewErrorPacket(proxylib.ErrorForbidden, "Forwarding between "+sourceClient.ProxyClient.Settings.Name+" and "+sinkClient.ProxyClient.Settings.Name+" is not allowed")
+		errorPacket.RequestId = chanCreatePacket.RequestId
+		client.ProxyClient.Write(*errorPacket.ToPacket(proxylib.Error))
+		return
+	}
+	if !manager.checkChannelPolicy(client, sourceClient, sinkClient, chanCreatePacket, policy, addresses) {
+		return
+	}
+
+	// the member info the server holds, not what the source claims. Assign the channel id and repack
+	chanCreatePacket.Source = *sourceClient.MemberInfo
+	chanCreatePacket.Sink = *sinkClient.MemberInfo
+	chanCreatePacket.Id = manager.nextSocketChannelId()
+	newPacket, err := proxy.NewPacketFromStruct(&chanCreatePacket, proxy.SocketConnect)
+	if err != nil {
+		logging.Get().Errorw("Failed to repack socket connect packet", "error", err)
+		return
+	}
+	// keeps the packet on the same lane as the data that follows it
+	newPacket.Chan.Id = chanCreatePacket.Id
+
 	// save the new channel
 	if manager.socketChannels[client.ProxyClient.Settings.Channel] == nil {
 		manager.socketChannels[client.ProxyClient.Settings.Channel] = make([]*SocketChannel, 0)
@@ -116,66 +217,199 @@ func (manager *manager) EstablishNewChannel(client *Client, chanCreatePacket *pr
 		Source:      sourceClient,
 		Sink:        sinkClient,
 		Initialized: false,
+		Rule:        chanCreatePacket.ForwardingRule,
+		Request:     *chanCreatePacket,
+		OpenedAt:    time.Now(),
 	})
+	socketChannelsOpened.Inc(client.ProxyClient.Settings.Channel)
 
 	// send the new channel to the sink
 	sinkClient.ProxyClient.Write(*newPacket)
 }
 
 // FinalizeChannel finalizes the channel creation process
-// @param client: the client that is finalizing the channel
-// @param channel: the channel that is being finalized
-// @param chanCreatePacket: the packet that was used to create the channel
-func (manager *manager) FinalizeChannel(client *Client, channel *SocketChannel, chanCreatePacket *proxcom.CreateSocketChannelPacket) {
+// @param client: the sink of the channel, which reported creation success
+// @param channel: the channel that is being finalized. Already marked initialized under socketMutex
+func (manager *manager) FinalizeChannel(client *Client, channel *SocketChannel) {
 	logging.Get().Infow("Finalizing Channel! sink reports channel creation success", "client", client.Id, "channel", channel.Id)
-	channel.Initialized = true
 
-	// send the channel creation success to the source
-	sourcePacket, err := proxy.NewPacketFromStruct(&chanCreatePacket, proxy.SocketConnect)
+	// send the channel creation success to the source. Only the success is taken from the sink,
+	// the source gets the same member info, rule and key salt the server sent to the sink
+	sourcePacket, err := proxy.NewPacketFromStruct(&channel.Request, proxy.SocketConnect)
 	if err != nil {
 		logging.Get().Errorw("Failed to repack socket connect packet", "error", err)
 		return
 	}
+	sourcePacket.Chan.Id = channel.Id
 	channel.Source.ProxyClient.Write(*sourcePacket)
 }
 
+// ListChannels describes the registered channels, the channels with members and the locked channels
+// @return the channels, sorted by name
+func (manager *manager) ListChannels() []ChannelSummary {
+	manager.clientsMutex.Lock()
+	defer manager.clientsMutex.Unlock()
+	manager.socketMutex.Lock()
+	defer manager.socketMutex.Unlock()
+
+	registered := make(map[string]bool)
+	for _, name := range Channels.names() {
+		registered[name] = true
+	}
+	names := make(map[string]bool)
+	for name := range registered {
+		names[name] = true
+	}
+	for name, clients := range manager.clients {
+		if len(clients) > 0 {
+			names[name] = true
+		}
+	}
+	for name := range manager.locked {
+		names[name] = true
+	}
+
+	summaries := make([]ChannelSummary, 0, len(names))
+	for name := range names {
+		summaries = append(summaries, ChannelSummary{
+			Name:           name,
+			Registered:     registered[name],
+			Locked:         manager.locked[name],
+			Members:        len(manager.clients[name]),
+			SocketChannels: len(manager.socketChannels[name]),
+		})
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Name < summaries[j].Name
+	})
+	return summaries
+}
+
+// ListMembers describes the members of a channel and their forwarding rules
+// @param channel: the channel name
+func (manager *manager) ListMembers(channel string) []MemberSummary {
+	manager.clientsMutex.Lock()
+	defer manager.clientsMutex.Unlock()
+
+	summaries := make([]MemberSummary, 0, len(manager.clients[channel]))
+	for _, client := range manager.clients[channel] {
+		summaries = append(summaries, newMemberSummary(client))
+	}
+	return summaries
+}
+
+// ListSocketChannels describes the socket channels open in a channel, with the bytes relayed through them
+// @param channel: the channel name
+func (manager *manager) ListSocketChannels(channel string) []SocketChannelSummary {
+	manager.socketMutex.Lock()
+	defer manager.socketMutex.Unlock()
+
+	summaries := make([]SocketChannelSummary, 0, len(manager.socketChannels[channel]))
+	for _, socketChannel := range manager.socketChannels[channel] {
+		summaries = append(summaries, newSocketChannelSummary(socketChannel))
+	}
+	return summaries
+}
+
+// KickMember disconnects a member from a channel. Its socket channels are closed
+// @param channel: the channel name
+// @param member: the id or name of the member
+// @return false if the channel has no such member
+func (manager *manager) KickMember(channel string, member string) bool {
+	manager.clientsMutex.Lock()
+	defer manager.clientsMutex.Unlock()
+
+	for _, client := range manager.clients[channel] {
+		if client.Id.String() == member || client.ProxyClient.Settings.Name == member {
+			logging.Get().Warnw("Kicking client on behalf of an administrator", "channel", channel, "name", client.ProxyClient.Settings.Name, "id", client.Id)
+			manager.kick(client, proxylib.NewErrorPacket(proxylib.ErrorKicked, "An administrator removed you from channel "+channel))
+			sendStatusUpdateToChannel(manager.clients[channel])
+			return true
+		}
+	}
+	return false
+}
+
+// CloseSocketChannel closes a socket channel, disconnecting both of its ends
+// @param channel: the channel name
+// @param id: the socket channel id
+// @return false if the channel has no such socket channel
+func (manager *manager) CloseSocketChannel(channel string, id uint32) bool {
+	manager.socketMutex.Lock()
+	defer manager.socketMutex.Unlock()
+
+	for idx, socketChannel := range manager.socketChannels[channel] {
+		if socketChannel.Id == id {
+			logging.Get().Infow("Closing socket channel on behalf of an administrator", "channel", channel, "socketChannel", id)
+			writeSocketDisconnect(socketChannel.Source, id)
+			writeSocketDisconnect(socketChannel.Sink, id)
+			manager.socketChannels[channel] = append(manager.socketChannels[channel][:idx], manager.socketChannels[channel][idx+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// SetChannelLocked locks or unlocks a channel. A locked channel refuses new members, those already in it stay
+// @param channel: the channel name. It does not have to exist yet
+func (manager *manager) SetChannelLocked(channel string, locked bool) {
+	manager.clientsMutex.Lock()
+	defer manager.clientsMutex.Unlock()
+
+	logging.Get().Infow("Channel lock changed", "channel", channel, "locked", locked)
+	if locked {
+		manager.locked[channel] = true
+	} else {
+		delete(manager.locked, channel)
+	}
+}
+
 // ============================================
 // Event Handlers
 // ============================================
 
-// handleData handles data packets received from clients
+// handleData handles data and datagram packets received from clients
 func (manager *manager) HandleData(client *Client, packet *proxylib.Packet) {
-	manager.clientsMutex.Lock()
-	defer manager.clientsMutex.Unlock()
+	if !manager.relayToSocketChannelPeer(client, packet) {
+		droppedPackets.Inc(client.ProxyClient.Settings.Channel)
+		logging.Get().Warnw("Server received data packet for unknown channel", "client", client.Id, "channel", packet.Chan.Id)
+		errorPacket := proxylib.NewErrorPacket(proxylib.ErrorUnknownSocketChannel, "Socket channel does not exist")
+		errorPacket.ChannelId = packet.Chan.Id
+		client.ProxyClient.Write(*errorPacket.ToPacket(proxylib.Error))
+	}
+}
 
-	for _, channel := range manager.socketChannels[client.ProxyClient.Settings.Channel] {
-		if channel.Id == packet.Chan.Id && channel.Initialized {
-			if client.Id == channel.Source.MemberInfo.Id {
-				channel.Sink.ProxyClient.Write(*packet)
-			} else {
-				channel.Source.ProxyClient.Write(*packet)
-			}
-			return
-		}
+// HandleWindowUpdate handles flow control credit packets received from clients
+func (manager *manager) HandleWindowUpdate(client *Client, packet *proxylib.Packet) {
+	if !manager.relayToSocketChannelPeer(client, packet) {
+		logging.Get().Debugw("Server received window update for unknown channel", "client", client.Id, "channel", packet.Chan.Id)
 	}
+}
 
-	logging.Get().Warnw("Server received data packet for unknown channel", "client", client.Id, "packet", packet)
+// HandleSocketHalfClose handles a client closing its sending direction of a socket channel
+func (manager *manager) HandleSocketHalfClose(client *Client, packet *proxylib.Packet) {
+	if !manager.relayToSocketChannelPeer(client, packet) {
+		logging.Get().Debugw("Server received half close for unknown channel", "client", client.Id, "channel", packet.Chan.Id)
+	} else {
+		logging.Get().Infow("Socket channel half closed", "client", client.Id, "channel", packet.Chan.Id)
+	}
 }
 
-// handleError handles error packets received from clients
+// handleError handles error packets received from clients.
+// Errors about a socket channel are passed on to the other end and the socket channel is dropped.
 func (manager *manager) HandleError(client *Client, packet *proxylib.Packet) {
-	var err error
-	packet.DecodeJsonData(&err)
+	errorPacket := proxylib.DecodeErrorPacket(packet)
+	logging.Get().Errorw("Server received error from client", "client", client.Id, "code", errorPacket.Code, "error", errorPacket.Message)
 
-	logging.Get().Errorw("Server received error from client", "client", client.Id, "error", err.Error())
+	if errorPacket.ChannelId != 0 {
+		manager.failSocketChannel(client, errorPacket)
+	}
 }
 
 // handleCriticalError handles critical error packets received from clients
 func (manager *manager) HandleCriticalError(client *Client, packet *proxylib.Packet) {
-	var err error
-	packet.DecodeJsonData(&err)
-
-	logging.Get().Errorw("Server received critical error from client", "client", client.Id, "error", err.Error())
+	errorPacket := proxylib.DecodeErrorPacket(packet)
+	logging.Get().Errorw("Server received critical error from client", "client", client.Id, "code", errorPacket.Code, "error", errorPacket.Message)
 }
 
 // handleChannelState handles channel state packets received from clients
@@ -191,6 +425,12 @@ func (manager *manager) HandleMemberInfo(client *Client, packet *proxylib.Packet
 		logging.Get().Errorw("Failed to decode member info packet", "error", err)
 	} else {
 		logging.Get().Infow("Received new member info!", "client", client.Id)
+		// identity and protocol info are taken from the connection, not what the client claims
+		channelMember.Id = client.Id
+		channelMember.Name = client.ProxyClient.Settings.Name
+		channelMember.ProtocolVersion = client.ProxyClient.ProtocolVersion
+		channelMember.Capabilities = client.ProxyClient.Capabilities
+		channelMember.Identity = client.Identity.String()
 		client.MemberInfo = &channelMember
 		sendStatusUpdateToChannel(manager.clients[client.ProxyClient.Settings.Channel])
 	}
@@ -214,8 +454,14 @@ func (manager *manager) HandleSocketConnect(client *Client, packet *proxylib.Pac
 	if manager.socketChannels[client.ProxyClient.Settings.Channel] != nil {
 		for _, channel := range manager.socketChannels[client.ProxyClient.Settings.Channel] {
 			if channel.Id == chanCreatePacket.Id && !channel.Initialized {
+				if client != channel.Sink {
+					logging.Get().Warnw("Socket connect for a socket channel the client is not the sink of", "client", client.Id, "channel", channel.Id)
+					manager.socketMutex.Unlock()
+					return
+				}
+				channel.Initialized = true
 				manager.socketMutex.Unlock()
-				manager.FinalizeChannel(client, channel, &chanCreatePacket)
+				manager.FinalizeChannel(client, channel)
 				return
 			}
 		}
@@ -243,10 +489,14 @@ func (manager *manager) HandleSocketDisconnect(client *Client, packet *proxylib.
 	if manager.socketChannels[client.ProxyClient.Settings.Channel] != nil {
 		for idx, channel := range manager.socketChannels[client.ProxyClient.Settings.Channel] {
 			if channel.Id == disconnectPacket.Id {
+				if !channel.HasEnd(client) {
+					logging.Get().Warnw("Dropped socket disconnect from a client that is not an end of the socket channel", "channel", channel.Id, "client", client.Id)
+					return
+				}
 				logging.Get().Infow("Closing socket channel", "channel", channel.Id, "client", client.Id)
 
 				// notify the other client that the channel is closing
-				if client.Id == channel.Source.MemberInfo.Id {
+				if client == channel.Source {
 					channel.Sink.ProxyClient.Write(*packet)
 				} else {
 					channel.Source.ProxyClient.Write(*packet)
@@ -274,17 +524,273 @@ func (manager *manager) watchForClientClose(proxyClient *proxylib.ProxyClient) {
 // Private Methods
 // ============================================
 
+// relayToSocketChannelPeer sends the packet to the other end of the socket channel it belongs to
+// @param client: the client the packet came from
+// @param packet: the packet to relay
+// @return: false if the socket channel does not exist or the client is not one of its ends
+func (manager *manager) relayToSocketChannelPeer(client *Client, packet *proxylib.Packet) bool {
+	peer := manager.findSocketChannelPeer(client, packet)
+	if peer == nil {
+		return false
+	}
+	// written without the lock, a peer with a full queue must not hold up every other socket channel
+	peer.ProxyClient.Write(*packet)
+	return true
+}
+
+// findSocketChannelPeer looks up the other end of the socket channel a packet belongs to and counts the relayed bytes
+// @param client: the client the packet came from
+// @param packet: the packet to relay
+// @return: the client to relay the packet to, nil if the socket channel does not exist or the client is not one of its ends
+func (manager *manager) findSocketChannelPeer(client *Client, packet *proxylib.Packet) *Client {
+	manager.socketMutex.Lock()
+	defer manager.socketMutex.Unlock()
+
+	channelName := client.ProxyClient.Settings.Channel
+	isPayload := packet.Type == proxylib.Data || packet.Type == proxylib.Datagram
+	for _, channel := range manager.socketChannels[channelName] {
+		if channel.Id == packet.Chan.Id && channel.Initialized {
+			if !channel.HasEnd(client) {
+				logging.Get().Warnw("Dropped packet from a client that is not an end of the socket channel", "client", client.Id, "channel", channel.Id, "type", packet.Type)
+				return nil
+			}
+			if client == channel.Source {
+				if isPayload {
+					channel.BytesFromSource.Add(uint64(len(packet.Data)))
+					relayedBytes.Add(uint64(len(packet.Data)), channelName, sourceToSink)
+					relayedPackets.Inc(channelName, sourceToSink)
+				}
+				return channel.Sink
+			}
+			if isPayload {
+				channel.BytesFromSink.Add(uint64(len(packet.Data)))
+				relayedBytes.Add(uint64(len(packet.Data)), channelName, sinkToSource)
+				relayedPackets.Inc(channelName, sinkToSource)
+			}
+			return channel.Source
+		}
+	}
+	return nil
+}
+
+// failSocketChannel forwards a socket channel error to the other end of the socket channel and removes it
+// @param client: the client that reported the error. Ignored unless it is an end of the socket channel
+// @param errorPacket: the error. Its ChannelId identifies the socket channel
+func (manager *manager) failSocketChannel(client *Client, errorPacket *proxylib.ErrorPacket) {
+	manager.socketMutex.Lock()
+	defer manager.socketMutex.Unlock()
+
+	channelName := client.ProxyClient.Settings.Channel
+	for idx, channel := range manager.socketChannels[channelName] {
+		if channel.Id == errorPacket.ChannelId {
+			if !channel.HasEnd(client) {
+				logging.Get().Warnw("Ignored socket channel error from a client that is not an end of the socket channel", "channel", channel.Id, "client", client.Id, "code", errorPacket.Code)
+				return
+			}
+			logging.Get().Infow("Dropping failed socket channel", "channel", channel.Id, "client", client.Id, "code", errorPacket.Code)
+
+			if client == channel.Source {
+				channel.Sink.ProxyClient.Write(*errorPacket.ToPacket(proxylib.Error))
+			} else {
+				channel.Source.ProxyClient.Write(*errorPacket.ToPacket(proxylib.Error))
+			}
+
+			manager.socketChannels[channelName] = append(manager.socketChannels[channelName][:idx], manager.socketChannels[channelName][idx+1:]...)
+			return
+		}
+	}
+}
+
+// resolveDuplicateName applies the duplicate name policy to a client joining a channel. Must hold clientsMutex
+// @param endpoint: the joining client. Renamed if the policy suffixes names
+// @param identity: who the joining client authenticated as. It may only take over a name from the same identity,
+// and is not renamed if its credential restricts its client names
+// @return an ErrorNameTaken ErrorPacket if the client cannot join under its name
+func (manager *manager) resolveDuplicateName(endpoint *proxylib.ProxyClient, identity *auth.Identity) error {
+	channel := endpoint.Settings.Channel
+	name := endpoint.Settings.Name
+	existing := manager.findClientByName(channel, name)
+	if existing == nil {
+		return nil
+	}
+
+	policy := manager.duplicateNames
+	if policy == KickDuplicateNames && existing.Identity.String() != identity.String() {
+		logging.Get().Warnw("Not kicking client, the client joining under its name authenticated as someone else",
+			"channel", channel, "name", name, "identity", existing.Identity.String(), "newIdentity", identity.String())
+		policy = RejectDuplicateNames
+	}
+	if policy == SuffixDuplicateNames && identity.RestrictsNames {
+		logging.Get().Warnw("Not renaming client, its credential restricts its client names", "channel", channel, "name", name, "identity", identity.String())
+		policy = RejectDuplicateNames
+	}
+
+	switch policy {
+	case RejectDuplicateNames:
+		logging.Get().Warnw("Rejected client joining under a name that is taken", "channel", channel, "name", name, "id", endpoint.Id)
+		return proxylib.NewErrorPacket(proxylib.ErrorNameTaken, "Another client already joined channel "+channel+" as "+name)
+	case KickDuplicateNames:
+		logging.Get().Warnw("Kicking client, a new client joined under its name", "channel", channel, "name", name, "id", existing.Id, "newId", endpoint.Id)
+		manager.kick(existing, proxylib.NewErrorPacket(proxylib.ErrorSessionReplaced, "Another client joined channel "+channel+" as "+name))
+	default:
+		for suffix := 2; existing != nil; suffix++ {
+			endpoint.Settings.Name = fmt.Sprintf("%s-%d", name, suffix)
+			existing = manager.findClientByName(channel, endpoint.Settings.Name)
+		}
+		logging.Get().Infow("Renamed client joining under a name that is taken", "channel", channel, "name", name, "assignedName", endpoint.Settings.Name)
+	}
+	return nil
+}
+
+// kick removes a client from its channel, tells it why and closes its connection. Must hold clientsMutex
+// @param reason: the critical error sent to the client
+func (manager *manager) kick(client *Client, reason *proxylib.ErrorPacket) {
+	channel := client.ProxyClient.Settings.Channel
+	manager.clients[channel] = slices.DeleteFunc(manager.clients[channel], func(member *Client) bool {
+		return member == client
+	})
+	manager.dropSocketChannelsOf(client)
+
+	client.ProxyClient.Write(*proxcom.NewCriticalErrorPacket(reason))
+	// the kicked client exits when it gets the error. Close the connection in case it never reads it
+	time.AfterFunc(kickCloseDelay, func() {
+		client.ProxyClient.Close()
+	})
+}
+
+// dropSocketChannelsOf removes the socket channels a client is an end of and disconnects the other end
+func (manager *manager) dropSocketChannelsOf(client *Client) {
+	manager.socketMutex.Lock()
+	defer manager.socketMutex.Unlock()
+
+	channelName := client.ProxyClient.Settings.Channel
+	manager.socketChannels[channelName] = slices.DeleteFunc(manager.socketChannels[channelName], func(channel *SocketChannel) bool {
+		if channel.Source != client && channel.Sink != client {
+			return false
+		}
+		logging.Get().Infow("Dropping socket channel of departed member", "channel", channel.Id, "client", client.Id)
+		peer := channel.Source
+		if peer == client {
+			peer = channel.Sink
+		}
+		writeSocketDisconnect(peer, channel.Id)
+		return true
+	})
+}
+
+// writeSocketDisconnect tells a client that one of its socket channels is gone
+func writeSocketDisconnect(client *Client, id uint32) {
+	packet, err := proxcom.NewDisconnectSocketChannelPacket(id)
+	if err != nil {
+		logging.Get().Errorw("Failed to create socket disconnect packet", "error", err)
+		return
+	}
+	client.ProxyClient.Write(*packet)
+}
+
+// findClientByName returns the member of a channel with the given name, nil if there is none. Must hold clientsMutex
+func (manager *manager) findClientByName(channel string, name string) *Client {
+	for _, client := range manager.clients[channel] {
+		if client.ProxyClient.Settings.Name == name {
+			return client
+		}
+	}
+	return nil
+}
+
+// checkChannelPolicy evaluates the channel policy for a socket channel, logs the decision and refuses denied requests
+// @param client: the client that requested the socket channel
+// @param policy: the policy of the channel, nil if it has none
+// @param addresses: the addresses the target resolves to, see resolveTarget
+// @return true if the socket channel is allowed
+func (manager *manager) checkChannelPolicy(client *Client, sourceClient *Client, sinkClient *Client, chanCreatePacket *proxcom.CreateSocketChannelPacket, policy *ChannelPolicy, addresses []netip.Addr) bool {
+	channel := client.ProxyClient.Settings.Channel
+	source := sourceClient.ProxyClient.Settings.Name
+	sink := sinkClient.ProxyClient.Settings.Name
+	rule := chanCreatePacket.ForwardingRule
+
+	allowed, ruleIndex := true, -1
+	if policy != nil {
+		allowed, ruleIndex = policy.Evaluate(source, sink, rule, addresses)
+	}
+
+	decisionFields := []any{
+		"channel", channel,
+		"source", source,
+		"sink", sink,
+		"sourceIdentity", sourceClient.Identity.String(),
+		"protocol", rule.Protocol,
+		"target", rule.RemoteAddress(),
+		"targetAddresses", addresses,
+		"hasPolicy", policy != nil,
+		"policyRule", ruleIndex,
+		"requestId", chanCreatePacket.RequestId,
+	}
+	if allowed {
+		logging.Get().Infow("Channel policy allowed socket channel", decisionFields...)
+		return true
+	}
+	logging.Get().Warnw("Channel policy denied socket channel", decisionFields...)
+
+	errorPacket := proxylib.NewErrorPacket(proxylib.ErrorPolicyDenied, "The channel policy does not allow "+source+" to reach "+rule.RemoteAddress()+" through "+sink)
+	errorPacket.RequestId = chanCreatePacket.RequestId
+	client.ProxyClient.Write(*errorPacket.ToPacket(proxylib.Error))
+	return false
+}
+
 // checkChannelPasswords checks if the given password is valid for the given channel
-// a password is valid if all other clients in that channel have the same password
+// a password is valid if all other clients in that channel that joined with a password have the same password
 // @param channel: the channel to check the password for
 // @param password: the password to check
 func (manager *manager) checkChannelPasswords(channel string, password string) bool {
 	if manager.clients[channel] != nil {
 		for _, client := range manager.clients[channel] {
-			if client.ProxyClient.Settings.Password != password {
+			if client.Identity.Method == auth.MethodPassword && client.ProxyClient.Settings.Password != password {
 				return false
 			}
 		}
 	}
 	return true
 }
+
+// channelSamples counts the clients, or the open socket channels, of every channel for metrics
+func (manager *manager) channelSamples(socketChannels bool) []metrics.Sample {
+	summaries := manager.ListChannels()
+	samples := make([]metrics.Sample, 0, len(summaries))
+	for _, summary := range summaries {
+		value := summary.Members
+		if socketChannels {
+			value = summary.SocketChannels
+		}
+		samples = append(samples, metrics.Sample{LabelValues: []string{summary.Name}, Value: float64(value)})
+	}
+	return samples
+}
+
+// queueDepthSamples reports how many packets are queued for each client for metrics
+func (manager *manager) queueDepthSamples() []metrics.Sample {
+	manager.clientsMutex.Lock()
+	defer manager.clientsMutex.Unlock()
+
+	samples := make([]metrics.Sample, 0)
+	for channel, clients := range manager.clients {
+		for _, client := range clients {
+			received, sending := client.ProxyClient.QueueDepth()
+			name := client.ProxyClient.Settings.Name
+			samples = append(samples,
+				metrics.Sample{LabelValues: []string{channel, name, "received"}, Value: float64(received)},
+				metrics.Sample{LabelValues: []string{channel, name, "sending"}, Value: float64(sending)})
+		}
+	}
+	return samples
+}
+
+// nextSocketChannelId returns a new socket channel id. 0 is reserved for "no socket channel"
+func (manager *manager) nextSocketChannelId() uint32 {
+	for {
+		id := manager.lastSocketChannelId.Add(1)
+		if id != 0 {
+			return id
+		}
+	}
+}
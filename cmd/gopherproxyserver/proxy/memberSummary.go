@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"time"
+
+	"github.com/CanadianCommander/gopherproxy/internal/proxcom"
+	"github.com/google/uuid"
+)
+
+// MemberSummary describes a member of a channel for the admin api
+type MemberSummary struct {
+	Id   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	// who the member authenticated as, e.g. oidc:alice@example.com
+	Identity        string `json:"identity"`
+	ProtocolVersion int    `json:"protocolVersion"`
+	Lanes           int    `json:"lanes"`
+	// true while the member lost its connection and may still resume its session
+	Suspended bool `json:"suspended"`
+	// last heartbeat round trip, in nanoseconds. 0 until one was measured
+	RoundTripTime time.Duration `json:"roundTripTime"`
+	// empty until the member sends its member info
+	ForwardingRules []*proxcom.ForwardingRule `json:"forwardingRules"`
+}
+
+// ============================================
+// Constructors
+// ============================================
+
+// newMemberSummary describes a client. The caller must hold the manager clientsMutex
+func newMemberSummary(client *Client) MemberSummary {
+	summary := MemberSummary{
+		Id:              client.Id,
+		Name:            client.ProxyClient.Settings.Name,
+		Identity:        client.Identity.String(),
+		ProtocolVersion: client.ProxyClient.ProtocolVersion,
+		Lanes:           client.ProxyClient.Lanes(),
+		Suspended:       client.ProxyClient.Suspended(),
+		RoundTripTime:   client.ProxyClient.RoundTripTime(),
+		ForwardingRules: make([]*proxcom.ForwardingRule, 0),
+	}
+	if client.MemberInfo != nil {
+		summary.ForwardingRules = client.MemberInfo.ForwardingRules
+	}
+	return summary
+}
@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"github.com/CanadianCommander/gopherproxy/internal/metrics"
+)
+
+// direction label values of the relay metrics
+const (
+	sourceToSink = "source_to_sink"
+	sinkToSource = "sink_to_source"
+)
+
+var (
+	socketChannelsOpened = metrics.NewCounterVec("gopherproxy_socket_channels_opened_total",
+		"Socket channels opened, by channel.",
+		"channel")
+	relayedBytes = metrics.NewCounterVec("gopherproxy_relayed_bytes_total",
+		"Data bytes relayed between the ends of socket channels, by channel and direction.",
+		"channel", "direction")
+	relayedPackets = metrics.NewCounterVec("gopherproxy_relayed_packets_total",
+		"Data and datagram packets relayed between the ends of socket channels, by channel and direction.",
+		"channel", "direction")
+	droppedPackets = metrics.NewCounterVec("gopherproxy_dropped_packets_total",
+		"Data and datagram packets dropped because their socket channel does not exist, by channel.",
+		"channel")
+
+	_ = metrics.NewGaugeFunc("gopherproxy_channel_clients",
+		"Clients connected to each channel.",
+		func() []metrics.Sample { return Manager.channelSamples(false) },
+		"channel")
+	_ = metrics.NewGaugeFunc("gopherproxy_socket_channels_active",
+		"Socket channels open in each channel.",
+		func() []metrics.Sample { return Manager.channelSamples(true) },
+		"channel")
+	_ = metrics.NewGaugeFunc("gopherproxy_client_queue_depth",
+		"Packets queued for each client. received: read from the client, waiting for the server. sending: waiting to be written to the client.",
+		func() []metrics.Sample { return Manager.queueDepthSamples() },
+		"channel", "client", "queue")
+)
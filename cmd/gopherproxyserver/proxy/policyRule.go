@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"net/netip"
+	"slices"
+
+	"github.com/CanadianCommander/gopherproxy/internal/proxcom"
+)
+
+// matches anything in the lists of a PolicyRule
+const policyWildcard = "*"
+
+// PolicyRule allows or denies socket channels that match all of its lists. An empty list matches anything
+type PolicyRule struct {
+	Allow bool
+	// names of the members that open the socket channel
+	Sources []string
+	// names of the members that connect to the target
+	Sinks []string
+	// target hosts, see proxcom.MatchHostPattern. IPs and CIDRs are matched against the addresses the target resolves to
+	Hosts []string
+	// target ports. Never matches unix socket targets
+	Ports []proxcom.PortRange
+	// tcp and/or udp
+	Protocols []string
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// Matches returns true if the rule applies to a socket channel
+// @param source, sink: names of the members the socket channel connects
+// @param forwardingRule: the forwarding rule the socket channel is created for
+// @param addresses: the addresses the target host resolves to. Empty if it could not be resolved
+func (rule PolicyRule) Matches(source string, sink string, forwardingRule proxcom.ForwardingRule, addresses []netip.Addr) bool {
+	protocol := forwardingRule.Protocol
+	if protocol == "" {
+		protocol = proxcom.ProtocolTcp
+	}
+
+	return matchesName(rule.Sources, source) &&
+		matchesName(rule.Sinks, sink) &&
+		(len(rule.Protocols) == 0 || slices.Contains(rule.Protocols, protocol)) &&
+		rule.matchesHost(forwardingRule, addresses) &&
+		rule.matchesPort(forwardingRule)
+}
+
+// ============================================
+// Private Methods
+// ============================================
+
+func matchesName(names []string, name string) bool {
+	return len(names) == 0 || slices.Contains(names, name) || slices.Contains(names, policyWildcard)
+}
+
+// matchesHost checks the target host, or unix socket path, against the host patterns
+func (rule PolicyRule) matchesHost(forwardingRule proxcom.ForwardingRule, addresses []netip.Addr) bool {
+	if len(rule.Hosts) == 0 {
+		return true
+	}
+	for _, pattern := range rule.Hosts {
+		if forwardingRule.RemoteSocket == "" && proxcom.IsAddressPattern(pattern) {
+			if rule.matchesAddresses(pattern, addresses) {
+				return true
+			}
+		} else if proxcom.MatchHostPattern(pattern, forwardingRule) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAddresses checks the addresses the target resolves to against an IP or CIDR pattern. Fails closed:
+// a deny rule matches if any address matches, or if the target could not be resolved.
+// An allow rule only matches if every address matches
+func (rule PolicyRule) matchesAddresses(pattern string, addresses []netip.Addr) bool {
+	if len(addresses) == 0 {
+		return !rule.Allow
+	}
+	matches := func(address netip.Addr) bool {
+		return proxcom.MatchAddressPattern(pattern, address)
+	}
+	if rule.Allow {
+		return !slices.ContainsFunc(addresses, func(address netip.Addr) bool { return !matches(address) })
+	}
+	return slices.ContainsFunc(addresses, matches)
+}
+
+// matchesPort checks the target port against the port ranges
+func (rule PolicyRule) matchesPort(forwardingRule proxcom.ForwardingRule) bool {
+	if len(rule.Ports) == 0 {
+		return true
+	}
+	if forwardingRule.RemoteSocket != "" {
+		return false
+	}
+	for _, portRange := range rule.Ports {
+		if portRange.Contains(forwardingRule.RemotePort) {
+			return true
+		}
+	}
+	return false
+}
@@ -12,7 +12,7 @@ import (
 // RoutePacket routes a incoming packet to the correct handler based on the packet type
 func RoutePacket(packet *proxy.Packet, client *Client) {
 	switch packet.Type {
-	case proxy.Data:
+	case proxy.Data, proxy.Datagram:
 		Manager.HandleData(client, packet)
 	case proxy.Error:
 		Manager.HandleError(client, packet)
@@ -26,6 +26,10 @@ func RoutePacket(packet *proxy.Packet, client *Client) {
 		Manager.HandleSocketConnect(client, packet)
 	case proxy.SocketDisconnect:
 		Manager.HandleSocketDisconnect(client, packet)
+	case proxy.WindowUpdate:
+		Manager.HandleWindowUpdate(client, packet)
+	case proxy.SocketHalfClose:
+		Manager.HandleSocketHalfClose(client, packet)
 	default:
 		logging.Get().Errorw("Unknown packet type", "type", packet.Type)
 	}
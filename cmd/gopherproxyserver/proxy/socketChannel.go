@@ -1,8 +1,28 @@
 package proxy
 
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/CanadianCommander/gopherproxy/internal/proxcom"
+)
+
 type SocketChannel struct {
-	Id          string
+	Id          uint32
 	Source      *Client
 	Sink        *Client
 	Initialized bool
+	// the forwarding rule the source opened the socket channel for
+	Rule proxcom.ForwardingRule
+	// the socket connect the server sent to the sink. Sent on to the source once the sink accepts
+	Request  proxcom.CreateSocketChannelPacket
+	OpenedAt time.Time
+	// data bytes relayed in each direction, including end to end encryption overhead
+	BytesFromSource atomic.Uint64
+	BytesFromSink   atomic.Uint64
+}
+
+// HasEnd reports whether the client is the source or the sink of the socket channel
+func (channel *SocketChannel) HasEnd(client *Client) bool {
+	return client == channel.Source || client == channel.Sink
 }
@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"time"
+
+	"github.com/CanadianCommander/gopherproxy/internal/proxcom"
+)
+
+// SocketChannelSummary describes a socket channel for the admin api
+type SocketChannelSummary struct {
+	Id uint32 `json:"id"`
+	// names of the members at either end
+	Source   string `json:"source"`
+	Sink     string `json:"sink"`
+	Protocol string `json:"protocol"`
+	// what the sink connects to, host:port or a unix socket path
+	Target string `json:"target"`
+	// false until the sink has connected to the target
+	Initialized     bool      `json:"initialized"`
+	OpenedAt        time.Time `json:"openedAt"`
+	BytesFromSource uint64    `json:"bytesFromSource"`
+	BytesFromSink   uint64    `json:"bytesFromSink"`
+}
+
+// ============================================
+// Constructors
+// ============================================
+
+// newSocketChannelSummary describes a socket channel. The caller must hold the manager socketMutex
+func newSocketChannelSummary(channel *SocketChannel) SocketChannelSummary {
+	protocol := channel.Rule.Protocol
+	if protocol == "" {
+		protocol = proxcom.ProtocolTcp
+	}
+	return SocketChannelSummary{
+		Id:              channel.Id,
+		Source:          channel.Source.ProxyClient.Settings.Name,
+		Sink:            channel.Sink.ProxyClient.Settings.Name,
+		Protocol:        protocol,
+		Target:          channel.Rule.RemoteAddress(),
+		Initialized:     channel.Initialized,
+		OpenedAt:        channel.OpenedAt,
+		BytesFromSource: channel.BytesFromSource.Load(),
+		BytesFromSink:   channel.BytesFromSink.Load(),
+	}
+}
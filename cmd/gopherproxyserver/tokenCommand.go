@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/CanadianCommander/gopherproxy/cmd/gopherproxyserver/auth"
+	"github.com/CanadianCommander/gopherproxy/cmd/gopherproxyserver/config"
+)
+
+// token create mints an access token with the token secret of the server configuration
+const tokenCommand = "token"
+const tokenCreateCommand = "create"
+
+// ============================================
+// Private Methods
+// ============================================
+
+// createToken prints a signed access token
+// @param args: the command line arguments after "token create"
+func createToken(args []string) error {
+	flagSet := flag.NewFlagSet("gopherproxyserver token create", flag.ContinueOnError)
+	configFile := flagSet.String("config", os.Getenv(config.ConfigFileEnv), "YAML config file holding the token secret. Env: "+config.ConfigFileEnv)
+	channel := flagSet.String("channel", "", "The channel the token lets the client join.")
+	validFor := flagSet.Duration("valid-for", 24*time.Hour, "How long the token is valid.")
+	actions := flagSet.String("actions", "", "Comma separated actions the client may take: forward, expose. All of them if empty.")
+	var clients []string
+	flagSet.Func("client", "Client name the token may join as. Repeat to allow several names. Any name if not given.", func(value string) error {
+		clients = append(clients, value)
+		return nil
+	})
+	err := flagSet.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *channel == "" {
+		return errors.New("--channel is required")
+	}
+	if *validFor <= 0 {
+		return errors.New("--valid-for must be positive")
+	}
+
+	var parsedActions []auth.Action
+	for _, name := range strings.Split(*actions, ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		action, err := auth.ParseAction(strings.TrimSpace(name))
+		if err != nil {
+			return err
+		}
+		parsedActions = append(parsedActions, action)
+	}
+
+	configArgs := []string{}
+	if *configFile != "" {
+		configArgs = append(configArgs, "--config", *configFile)
+	}
+	serverConfig, err := config.Load(configArgs)
+	if err != nil {
+		return err
+	}
+	if serverConfig.TokenSecret == "" {
+		return errors.New("the server has no token secret, set tokenSecret or GOPHERPROXY_TOKEN_SECRET")
+	}
+
+	token, err := auth.NewAccessToken(*channel, clients, parsedActions, *validFor).Sign([]byte(serverConfig.TokenSecret))
+	if err != nil {
+		return err
+	}
+	fmt.Println(token)
+	return nil
+}
@@ -5,14 +5,34 @@ import (
 	"go.uber.org/zap/zapcore"
 )
 
+// log formats supported by CreateLoggerWithFormat
+const (
+	JsonFormat    = "json"
+	ConsoleFormat = "console"
+)
+
 var logger *zap.SugaredLogger
 
 // Init initializes the logger
 func CreateLogger(logLevel zapcore.Level) {
+	CreateLoggerWithFormat(logLevel, JsonFormat)
+}
+
+// CreateLoggerWithFormat initializes the logger
+// @param format: JsonFormat for machine readable logs, ConsoleFormat for humans
+func CreateLoggerWithFormat(logLevel zapcore.Level, format string) error {
 	config := zap.NewProductionConfig()
 	config.Level = zap.NewAtomicLevelAt(logLevel)
-	zlog, _ := config.Build()
+	config.Encoding = format
+	if format == ConsoleFormat {
+		config.EncoderConfig = zap.NewDevelopmentEncoderConfig()
+	}
+	zlog, err := config.Build()
+	if err != nil {
+		return err
+	}
 	logger = zlog.Sugar()
+	return nil
 }
 
 // Get returns a new zap logger
@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"bufio"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// CounterVec is a counter with one series per combination of label values. Counters only go up
+type CounterVec struct {
+	metricName string
+	help       string
+	labelNames []string
+
+	mutex  sync.RWMutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labelValues []string
+	value       atomic.Uint64
+}
+
+// ============================================
+// Constructors
+// ============================================
+
+// NewCounterVec creates a counter and registers it, so Write includes it
+// @param name: the metric name, e.g. gopherproxy_relayed_bytes_total
+// @param help: what the metric counts
+// @param labelNames: the labels every series has, e.g. channel
+func NewCounterVec(name string, help string, labelNames ...string) *CounterVec {
+	counter := &CounterVec{
+		metricName: name,
+		help:       help,
+		labelNames: labelNames,
+		series:     make(map[string]*counterSeries),
+	}
+	defaultRegistry.register(counter)
+	return counter
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// Inc adds one to the series with the given label values
+func (counter *CounterVec) Inc(labelValues ...string) {
+	counter.Add(1, labelValues...)
+}
+
+// Add adds to the series with the given label values, creating it if needed
+// @param labelValues: one value per label name, in the same order
+func (counter *CounterVec) Add(value uint64, labelValues ...string) {
+	if len(labelValues) != len(counter.labelNames) {
+		panic("metric " + counter.metricName + " needs " + strings.Join(counter.labelNames, ", ") + " labels")
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	counter.mutex.RLock()
+	series, ok := counter.series[key]
+	counter.mutex.RUnlock()
+	if !ok {
+		counter.mutex.Lock()
+		series, ok = counter.series[key]
+		if !ok {
+			series = &counterSeries{labelValues: append([]string(nil), labelValues...)}
+			counter.series[key] = series
+		}
+		counter.mutex.Unlock()
+	}
+	series.value.Add(value)
+}
+
+// ============================================
+// Private Methods
+// ============================================
+
+func (counter *CounterVec) name() string {
+	return counter.metricName
+}
+
+func (counter *CounterVec) write(writer *bufio.Writer) {
+	counter.mutex.RLock()
+	keys := make([]string, 0, len(counter.series))
+	for key := range counter.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	series := make([]*counterSeries, 0, len(keys))
+	for _, key := range keys {
+		series = append(series, counter.series[key])
+	}
+	counter.mutex.RUnlock()
+
+	writeHeader(writer, counter.metricName, counter.help, "counter")
+	for _, item := range series {
+		writeSample(writer, counter.metricName, counter.labelNames, item.labelValues, float64(item.value.Load()))
+	}
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"bufio"
+)
+
+// GaugeFunc is a gauge whose samples are collected when the metrics are written, e.g. the number of clients in each channel
+type GaugeFunc struct {
+	metricName string
+	help       string
+	labelNames []string
+	collect    func() []Sample
+}
+
+// ============================================
+// Constructors
+// ============================================
+
+// NewGaugeFunc creates a gauge and registers it, so Write includes it
+// @param name: the metric name, e.g. gopherproxy_channel_clients
+// @param help: what the metric measures
+// @param collect: returns the current samples. Called on every scrape, so it must be cheap and safe to call concurrently
+// @param labelNames: the labels every sample has
+func NewGaugeFunc(name string, help string, collect func() []Sample, labelNames ...string) *GaugeFunc {
+	gauge := &GaugeFunc{
+		metricName: name,
+		help:       help,
+		labelNames: labelNames,
+		collect:    collect,
+	}
+	defaultRegistry.register(gauge)
+	return gauge
+}
+
+// ============================================
+// Private Methods
+// ============================================
+
+func (gauge *GaugeFunc) name() string {
+	return gauge.metricName
+}
+
+func (gauge *GaugeFunc) write(writer *bufio.Writer) {
+	writeHeader(writer, gauge.metricName, gauge.help, "gauge")
+	for _, sample := range gauge.collect() {
+		if len(sample.LabelValues) != len(gauge.labelNames) {
+			continue
+		}
+		writeSample(writer, gauge.metricName, gauge.labelNames, sample.LabelValues, sample.Value)
+	}
+}
@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType of the Prometheus text exposition format written by Write
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// metric is a metric family the registry can write
+type metric interface {
+	name() string
+	// write writes the HELP, TYPE and sample lines of the metric
+	write(writer *bufio.Writer)
+}
+
+// registry holds every metric created with NewCounterVec or NewGaugeFunc
+type registry struct {
+	mutex   sync.Mutex
+	metrics []metric
+}
+
+var defaultRegistry = registry{}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// Write writes every metric in the Prometheus text exposition format, sorted by name
+func Write(writer io.Writer) error {
+	defaultRegistry.mutex.Lock()
+	metrics := append([]metric(nil), defaultRegistry.metrics...)
+	defaultRegistry.mutex.Unlock()
+
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].name() < metrics[j].name()
+	})
+	buffered := bufio.NewWriter(writer)
+	for _, metric := range metrics {
+		metric.write(buffered)
+	}
+	return buffered.Flush()
+}
+
+// ============================================
+// Private Methods
+// ============================================
+
+// register adds a metric to the registry. Metric names must be unique
+func (registry *registry) register(metric metric) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	for _, registered := range registry.metrics {
+		if registered.name() == metric.name() {
+			panic("metric " + metric.name() + " is registered twice")
+		}
+	}
+	registry.metrics = append(registry.metrics, metric)
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric
+func writeHeader(writer *bufio.Writer, name string, help string, metricType string) {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	fmt.Fprintf(writer, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// writeSample writes one sample line, e.g. name{channel="ops"} 42
+func writeSample(writer *bufio.Writer, name string, labelNames []string, labelValues []string, value float64) {
+	writer.WriteString(name)
+	if len(labelNames) > 0 {
+		writer.WriteByte('{')
+		for i, labelName := range labelNames {
+			if i > 0 {
+				writer.WriteByte(',')
+			}
+			writer.WriteString(labelName)
+			writer.WriteString(`="`)
+			writer.WriteString(labelEscaper.Replace(labelValues[i]))
+			writer.WriteByte('"')
+		}
+		writer.WriteByte('}')
+	}
+	writer.WriteByte(' ')
+	writer.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	writer.WriteByte('\n')
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
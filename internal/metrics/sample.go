@@ -0,0 +1,8 @@
+package metrics
+
+// Sample is one value of a GaugeFunc
+type Sample struct {
+	// one value per label name of the gauge, in the same order
+	LabelValues []string
+	Value       float64
+}
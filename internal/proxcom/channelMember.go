@@ -1,6 +1,7 @@
 package proxcom
 
 import (
+	"github.com/CanadianCommander/gopherproxy/internal/proxy"
 	"github.com/google/uuid"
 )
 
@@ -10,6 +11,14 @@ type ChannelMember struct {
 	Id              uuid.UUID
 	Name            string
 	ForwardingRules []*ForwardingRule
+	// protocol version & capabilities this member negotiated with the server.
+	// A feature that involves two members should only be used if both members have the capability.
+	ProtocolVersion int
+	Capabilities    proxy.Capabilities
+	// X25519 public key used to derive end to end encryption keys for socket channels
+	PublicKey []byte
+	// who the server authenticated the member as, e.g. oidc:alice@example.com. Set by the server
+	Identity string
 }
 
 // ===========================================
@@ -23,5 +32,15 @@ func NewChannelMember(name string) *ChannelMember {
 		Id:              uuid.New(),
 		Name:            name,
 		ForwardingRules: make([]*ForwardingRule, 0),
+		Capabilities:    make(proxy.Capabilities, 0),
 	}
 }
+
+// ===========================================
+// Public Methods
+// ===========================================
+
+// HasCapability returns true if this member negotiated the given capability
+func (member *ChannelMember) HasCapability(capability proxy.Capability) bool {
+	return member.Capabilities.Has(capability)
+}
@@ -6,11 +6,14 @@ import (
 )
 
 type CreateSocketChannelPacket struct {
-	Id             string
+	// socket channel id, assigned by the server
+	Id             uint32
 	RequestId      string
 	Source         ChannelMember
 	Sink           ChannelMember
 	ForwardingRule ForwardingRule
+	// random salt picked by the source, used to derive the end to end encryption keys of the socket channel
+	KeySalt []byte
 }
 
 // ==========================================
@@ -24,11 +27,17 @@ type CreateSocketChannelPacket struct {
 // @param rule: the forwarding rule to use for the channel
 // @return: the new packet, the request id, and an error if one occurred
 func BuildSocketChannelCreatePacket(source ChannelMember, sink ChannelMember, rule ForwardingRule) (*proxy.Packet, string, error) {
+	salt, err := proxy.NewChannelKeySalt()
+	if err != nil {
+		return nil, "", err
+	}
+
 	createChanPack := CreateSocketChannelPacket{
 		RequestId:      uuid.NewString(),
 		Source:         source,
 		Sink:           sink,
 		ForwardingRule: rule,
+		KeySalt:        salt,
 	}
 
 	packet, err := proxy.NewPacketFromStruct(createChanPack, proxy.SocketConnect)
@@ -38,3 +47,16 @@ func BuildSocketChannelCreatePacket(source ChannelMember, sink ChannelMember, ru
 	}
 	return packet, createChanPack.RequestId, nil
 }
+
+// CanEncrypt returns true if both ends of the socket channel can use end to end encryption
+func (packet *CreateSocketChannelPacket) CanEncrypt() bool {
+	return packet.BothHaveCapability(proxy.CapabilityEncryption) &&
+		len(packet.Source.PublicKey) > 0 &&
+		len(packet.Sink.PublicKey) > 0 &&
+		len(packet.KeySalt) == proxy.ChannelKeySaltSize
+}
+
+// BothHaveCapability returns true if both the source and sink of the socket channel have the given capability
+func (packet *CreateSocketChannelPacket) BothHaveCapability(capability proxy.Capability) bool {
+	return packet.Source.HasCapability(capability) && packet.Sink.HasCapability(capability)
+}
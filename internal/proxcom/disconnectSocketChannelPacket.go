@@ -4,7 +4,7 @@ import "github.com/CanadianCommander/gopherproxy/internal/proxy"
 
 type DisconnectSocketChannelPacket struct {
 	// channel id to disconnect
-	Id string
+	Id uint32
 }
 
 // ==========================================
@@ -15,7 +15,7 @@ type DisconnectSocketChannelPacket struct {
 // The client sends this to the proxy server to request a socket channel be disconnected
 // @param id: the id of the channel to disconnect
 // @return: the new packet or an error if one occurred
-func NewDisconnectSocketChannelPacket(id string) (*proxy.Packet, error) {
+func NewDisconnectSocketChannelPacket(id uint32) (*proxy.Packet, error) {
 	disconnectPacket := DisconnectSocketChannelPacket{
 		Id: id,
 	}
@@ -24,5 +24,7 @@ func NewDisconnectSocketChannelPacket(id string) (*proxy.Packet, error) {
 	if err != nil {
 		return nil, err
 	}
+	// keeps the packet on the same lane as the data of the socket channel
+	packet.Chan.Id = id
 	return packet, nil
 }
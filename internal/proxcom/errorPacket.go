@@ -6,22 +6,12 @@ import "github.com/CanadianCommander/gopherproxy/internal/proxy"
 // Constructor
 // ===========================================
 
+// NewErrorPacket creates an Error packet. The error code is taken from the error type, see proxy.ErrorPacketFromError
 func NewErrorPacket(err error) *proxy.Packet {
-	return newErrorPacket(err, proxy.Error)
+	return proxy.ErrorPacketFromError(err).ToPacket(proxy.Error)
 }
 
+// NewCriticalErrorPacket creates a CriticalError packet. The receiver is expected to disconnect
 func NewCriticalErrorPacket(err error) *proxy.Packet {
-	return newErrorPacket(err, proxy.CriticalError)
-}
-
-// ===========================================
-// Private Methods
-// ===========================================
-
-func newErrorPacket(err error, tp proxy.PacketType) *proxy.Packet {
-	return &proxy.Packet{
-		Type: tp,
-		Chan: proxy.SocketChannel{},
-		Data: []byte(err.Error()),
-	}
+	return proxy.ErrorPacketFromError(err).ToPacket(proxy.CriticalError)
 }
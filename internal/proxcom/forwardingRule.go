@@ -1,65 +1,174 @@
 package proxcom
 
 import (
+	"net"
+	"os"
 	"strconv"
 	"strings"
 )
 
+// transport protocols a forwarding rule can carry
+const (
+	ProtocolTcp = "tcp"
+	ProtocolUdp = "udp"
+)
+
+// marks a unix socket path in place of a port in a forwarding rule. Paths may not contain ':' or ','
+const unixSocketPrefix = "unix:"
+
+const invalidRuleMessage = "Invalid forwarding rule. Please provide a rule in the format: <localPort|unix:path>:remoteClient:<[remoteHost:]remotePort|unix:path>"
+
 type ForwardingRule struct {
-	LocalPort    int
+	// tcp or udp. Empty for rules from clients that predate udp forwarding, which means tcp
+	Protocol  string `json:",omitempty"`
+	LocalPort int
+	// unix socket path to listen on instead of LocalPort
+	LocalSocket  string `json:",omitempty"`
 	RemoteClient string
 	RemoteHost   string
 	RemotePort   int
+	// unix socket path on the remote client to connect to instead of RemoteHost:RemotePort
+	RemoteSocket string `json:",omitempty"`
+	// compress data sent over socket channels created by this rule
+	Compress bool
+	// file permissions of the LocalSocket. Only meaningful to the client that listens
+	LocalSocketMode os.FileMode `json:"-"`
 	// if based on the current state of the channel this rule is Valid
 	Valid bool
 }
 
+// default permissions of a local unix socket, only the owner may connect
+const DefaultLocalSocketMode os.FileMode = 0600
+
 // ============================================
 // Constructors
 // ============================================
 
 // NewForwardingRuleFromArg creates a new forwarding rule
+// The rule may be prefixed with its protocol, tcp by default. e.g. udp/5353:client1:53
+// Either end may be a unix socket. e.g. unix:/tmp/docker.sock:client1:unix:/var/run/docker.sock
+// Rule options may follow the rule separated by commas. e.g. 8080:client1:80,compress
 func NewForwardingRuleFromArg(arg string) *ForwardingRule {
-	argSlic := strings.Split(arg, ":")
+	options := strings.Split(arg, ",")
 
-	switch len(argSlic) {
-	case 3:
-		localPort, err := strconv.Atoi(argSlic[0])
-		if err != nil {
-			panic("The local port provided for the forwarding rule could not be parsed. Please provide a valid port number.")
+	protocol := ProtocolTcp
+	spec := options[0]
+	// unix socket paths contain slashes too, a protocol prefix never contains a colon
+	if prefix, rest, found := strings.Cut(spec, "/"); found && !strings.Contains(prefix, ":") {
+		if prefix != ProtocolTcp && prefix != ProtocolUdp {
+			panic("Unknown forwarding rule protocol: " + prefix + ". Valid protocols are: tcp, udp")
 		}
+		protocol = prefix
+		spec = rest
+	}
 
-		remotePort, err := strconv.Atoi(argSlic[2])
-		if err != nil {
-			panic("The remote port provided for the forwarding rule could not be parsed. Please provide a valid port number.")
+	rule := newForwardingRuleFromSpec(spec)
+	rule.Protocol = protocol
+	if rule.IsUdp() && (rule.LocalSocket != "" || rule.RemoteSocket != "") {
+		panic("Unix sockets can only be used with tcp forwarding rules")
+	}
+
+	for _, option := range options[1:] {
+		name, value, _ := strings.Cut(option, "=")
+		switch name {
+		case "compress":
+			rule.Compress = true
+		case "mode":
+			mode, err := strconv.ParseUint(value, 8, 32)
+			if err != nil || rule.LocalSocket == "" {
+				panic("The mode option takes octal file permissions, e.g. mode=0660, and requires a local unix socket")
+			}
+			rule.LocalSocketMode = os.FileMode(mode) & os.ModePerm
+		default:
+			panic("Unknown forwarding rule option: " + option + ". Valid options are: compress, mode=<octal permissions>")
 		}
+	}
+	if rule.LocalSocket != "" && rule.LocalSocketMode == 0 {
+		rule.LocalSocketMode = DefaultLocalSocketMode
+	}
+	return rule
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// IsUdp returns true if the rule forwards udp datagrams rather than a tcp stream
+func (rule *ForwardingRule) IsUdp() bool {
+	return rule.Protocol == ProtocolUdp
+}
 
-		return &ForwardingRule{
-			LocalPort:    localPort,
-			RemoteClient: argSlic[1],
-			RemoteHost:   "localhost",
-			RemotePort:   remotePort,
-			Valid:        false,
+// LocalAddress describes where the rule listens. A port or a unix socket path
+func (rule *ForwardingRule) LocalAddress() string {
+	if rule.LocalSocket != "" {
+		return unixSocketPrefix + rule.LocalSocket
+	}
+	return strconv.Itoa(rule.LocalPort)
+}
+
+// RemoteAddress describes what the remote client connects to. host:port or a unix socket path
+func (rule *ForwardingRule) RemoteAddress() string {
+	if rule.RemoteSocket != "" {
+		return unixSocketPrefix + rule.RemoteSocket
+	}
+	return net.JoinHostPort(rule.RemoteHost, strconv.Itoa(rule.RemotePort))
+}
+
+// ============================================
+// Private Methods
+// ============================================
+
+// newForwardingRuleFromSpec parses the local:remoteClient:remote part of a forwarding rule.
+// local is a port or unix:path, remote is [remoteHost:]remotePort or unix:path
+func newForwardingRuleFromSpec(arg string) *ForwardingRule {
+	argSlic := strings.Split(arg, ":")
+	rule := &ForwardingRule{
+		RemoteHost: "localhost",
+		Valid:      false,
+	}
+
+	if argSlic[0]+":" == unixSocketPrefix && len(argSlic) > 1 {
+		if argSlic[1] == "" {
+			panic("The local unix socket path provided for the forwarding rule is empty.")
 		}
-	case 4:
+		rule.LocalSocket = argSlic[1]
+		argSlic = argSlic[2:]
+	} else {
 		localPort, err := strconv.Atoi(argSlic[0])
 		if err != nil {
 			panic("The local port provided for the forwarding rule could not be parsed. Please provide a valid port number.")
 		}
+		rule.LocalPort = localPort
+		argSlic = argSlic[1:]
+	}
 
-		remotePort, err := strconv.Atoi(argSlic[3])
+	if len(argSlic) == 0 {
+		panic(invalidRuleMessage)
+	}
+	rule.RemoteClient = argSlic[0]
+	argSlic = argSlic[1:]
+
+	switch {
+	case len(argSlic) == 2 && argSlic[0]+":" == unixSocketPrefix:
+		if argSlic[1] == "" {
+			panic("The remote unix socket path provided for the forwarding rule is empty.")
+		}
+		rule.RemoteSocket = argSlic[1]
+	case len(argSlic) == 1 || len(argSlic) == 2:
+		if len(argSlic) == 2 {
+			rule.RemoteHost = argSlic[0]
+		}
+		remotePort, err := strconv.Atoi(argSlic[len(argSlic)-1])
 		if err != nil {
 			panic("The remote port provided for the forwarding rule could not be parsed. Please provide a valid port number.")
 		}
-
-		return &ForwardingRule{
-			LocalPort:    localPort,
-			RemoteClient: argSlic[1],
-			RemoteHost:   argSlic[2],
-			RemotePort:   remotePort,
-			Valid:        false,
-		}
+		rule.RemotePort = remotePort
 	default:
-		panic("Invalid forwarding rule. Please provide a rule in the format: localPort:remoteClient[:remoteHost]:remotePort")
+		panic(invalidRuleMessage)
+	}
+
+	if rule.RemoteClient == "" {
+		panic(invalidRuleMessage)
 	}
+	return rule
 }
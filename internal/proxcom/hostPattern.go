@@ -0,0 +1,93 @@
+package proxcom
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"path"
+	"strings"
+)
+
+// matches any host in a host pattern list
+const AnyHost = "*"
+
+// ============================================
+// Public Methods
+// ============================================
+
+// ValidateHostPattern checks a host pattern. See MatchHostPattern
+func ValidateHostPattern(pattern string) error {
+	if pattern == "" {
+		return errors.New("empty host pattern")
+	}
+	if socketPattern, isSocket := strings.CutPrefix(pattern, unixSocketPrefix); isSocket {
+		_, err := path.Match(socketPattern, "")
+		if err != nil {
+			return fmt.Errorf("invalid unix socket pattern %q", pattern)
+		}
+	} else if strings.Contains(pattern, "/") {
+		_, err := netip.ParsePrefix(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid CIDR %q", pattern)
+		}
+	}
+	return nil
+}
+
+// IsAddressPattern returns true if a host pattern is an IP or a CIDR, which match addresses rather than names
+// @param pattern: a pattern that passed ValidateHostPattern
+func IsAddressPattern(pattern string) bool {
+	if strings.HasPrefix(pattern, unixSocketPrefix) {
+		return false
+	}
+	if strings.Contains(pattern, "/") {
+		return true
+	}
+	_, err := netip.ParseAddr(pattern)
+	return err == nil
+}
+
+// MatchAddressPattern returns true if an address matches an IP or CIDR host pattern
+// @param pattern: a pattern for which IsAddressPattern is true
+func MatchAddressPattern(pattern string, address netip.Addr) bool {
+	if strings.Contains(pattern, "/") {
+		prefix, err := netip.ParsePrefix(pattern)
+		return err == nil && prefix.Contains(address.Unmap())
+	}
+	patternAddress, err := netip.ParseAddr(pattern)
+	return err == nil && patternAddress.Unmap() == address.Unmap()
+}
+
+// MatchHostPattern returns true if the target of a forwarding rule matches a host pattern.
+// A pattern is AnyHost, a hostname, *.domain, an IP, a CIDR, or unix:<path glob> for unix socket targets.
+// Hostnames are compared as given, never resolved, so IPs and CIDRs only match rules that target an IP.
+// Callers that deny by address must resolve names themselves, see MatchAddressPattern
+// @param pattern: a pattern that passed ValidateHostPattern
+// @param rule: the forwarding rule whose remote end is checked
+func MatchHostPattern(pattern string, rule ForwardingRule) bool {
+	socketPattern, isSocket := strings.CutPrefix(pattern, unixSocketPrefix)
+	if rule.RemoteSocket != "" {
+		matched, _ := path.Match(socketPattern, rule.RemoteSocket)
+		return isSocket && matched
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(rule.RemoteHost), ".")
+	address, addressErr := netip.ParseAddr(host)
+	switch {
+	case isSocket:
+		return false
+	case pattern == AnyHost:
+		return true
+	case strings.Contains(pattern, "/"):
+		prefix, err := netip.ParsePrefix(pattern)
+		return err == nil && addressErr == nil && prefix.Contains(address.Unmap())
+	case strings.HasPrefix(pattern, "*."):
+		return strings.HasSuffix(host, strings.ToLower(pattern[1:]))
+	}
+
+	patternAddress, err := netip.ParseAddr(pattern)
+	if err == nil {
+		return addressErr == nil && patternAddress.Unmap() == address.Unmap()
+	}
+	return strings.ToLower(pattern) == host
+}
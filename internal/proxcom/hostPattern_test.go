@@ -0,0 +1,76 @@
+package proxcom
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestMatchHostPattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		rule    ForwardingRule
+		want    bool
+	}{
+		{"any host", AnyHost, ForwardingRule{RemoteHost: "example.com"}, true},
+		{"hostname", "db.internal", ForwardingRule{RemoteHost: "DB.internal."}, true},
+		{"other hostname", "db.internal", ForwardingRule{RemoteHost: "web.internal"}, false},
+		{"wildcard domain", "*.internal", ForwardingRule{RemoteHost: "db.internal"}, true},
+		{"wildcard needs a subdomain", "*.internal", ForwardingRule{RemoteHost: "internal"}, false},
+		{"ip literal", "10.0.0.1", ForwardingRule{RemoteHost: "10.0.0.1"}, true},
+		{"mapped ip literal", "10.0.0.1", ForwardingRule{RemoteHost: "::ffff:10.0.0.1"}, true},
+		{"cidr ip literal", "10.0.0.0/8", ForwardingRule{RemoteHost: "10.1.2.3"}, true},
+		{"cidr other ip", "10.0.0.0/8", ForwardingRule{RemoteHost: "192.168.0.1"}, false},
+		{"cidr hostname is not resolved", "127.0.0.0/8", ForwardingRule{RemoteHost: "localhost"}, false},
+		{"unix socket", "unix:/var/run/*.sock", ForwardingRule{RemoteSocket: "/var/run/docker.sock"}, true},
+		{"unix pattern on host", "unix:/var/run/*.sock", ForwardingRule{RemoteHost: "localhost"}, false},
+		{"host pattern on unix socket", AnyHost, ForwardingRule{RemoteSocket: "/var/run/docker.sock"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := ValidateHostPattern(test.pattern); err != nil {
+				t.Fatalf("ValidateHostPattern(%q) = %v", test.pattern, err)
+			}
+			if got := MatchHostPattern(test.pattern, test.rule); got != test.want {
+				t.Errorf("MatchHostPattern(%q, %+v) = %v, want %v", test.pattern, test.rule, got, test.want)
+			}
+		})
+	}
+}
+
+func TestMatchAddressPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		address string
+		want    bool
+	}{
+		{"127.0.0.0/8", "127.0.0.1", true},
+		{"127.0.0.0/8", "::ffff:127.0.0.1", true},
+		{"127.0.0.0/8", "10.0.0.1", false},
+		{"::1", "::1", true},
+		{"10.0.0.1", "10.0.0.2", false},
+	}
+
+	for _, test := range tests {
+		if !IsAddressPattern(test.pattern) {
+			t.Errorf("IsAddressPattern(%q) = false", test.pattern)
+		}
+		if got := MatchAddressPattern(test.pattern, netip.MustParseAddr(test.address)); got != test.want {
+			t.Errorf("MatchAddressPattern(%q, %s) = %v, want %v", test.pattern, test.address, got, test.want)
+		}
+	}
+	for _, pattern := range []string{AnyHost, "db.internal", "*.internal", "unix:/tmp/*.sock"} {
+		if IsAddressPattern(pattern) {
+			t.Errorf("IsAddressPattern(%q) = true", pattern)
+		}
+	}
+}
+
+func TestValidateHostPattern(t *testing.T) {
+	for _, pattern := range []string{"", "10.0.0.0/33", "not/a/cidr", "unix:["} {
+		if ValidateHostPattern(pattern) == nil {
+			t.Errorf("ValidateHostPattern(%q) accepted an invalid pattern", pattern)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package proxcom
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PortRange is an inclusive range of ports, e.g. 8000-8999. A single port has From == To
+type PortRange struct {
+	From int
+	To   int
+}
+
+// ============================================
+// Constructors
+// ============================================
+
+// ParsePortRange parses a port, e.g. 22, or a port range, e.g. 8000-8999
+func ParsePortRange(value string) (PortRange, error) {
+	fromValue, toValue, isRange := strings.Cut(value, "-")
+	if !isRange {
+		toValue = fromValue
+	}
+	from, err := strconv.Atoi(strings.TrimSpace(fromValue))
+	if err != nil {
+		return PortRange{}, fmt.Errorf("invalid port range %q", value)
+	}
+	to, err := strconv.Atoi(strings.TrimSpace(toValue))
+	if err != nil || from < 1 || to > 65535 || from > to {
+		return PortRange{}, fmt.Errorf("invalid port range %q", value)
+	}
+	return PortRange{From: from, To: to}, nil
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// Contains returns true if the port is in the range
+func (portRange PortRange) Contains(port int) bool {
+	return port >= portRange.From && port <= portRange.To
+}
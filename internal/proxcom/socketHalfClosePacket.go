@@ -0,0 +1,16 @@
+package proxcom
+
+import "github.com/CanadianCommander/gopherproxy/internal/proxy"
+
+// ==========================================
+// Constructors
+// ==========================================
+
+// NewSocketHalfClosePacket creates a new packet telling the remote end of a socket channel
+// that we will send no more data on it. The remote end may keep sending until it half closes as well.
+// @param channelId: the socket channel to half close
+func NewSocketHalfClosePacket(channelId uint32) *proxy.Packet {
+	packet := proxy.NewPacketOfBytes(nil, proxy.SocketHalfClose)
+	packet.Chan = proxy.SocketChannel{Id: channelId}
+	return packet
+}
@@ -0,0 +1,40 @@
+package proxcom
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/CanadianCommander/gopherproxy/internal/proxy"
+)
+
+// WindowUpdate packets are sent by the sink of a data stream once it has written data to its local socket.
+// They grant the sender that many more bytes of credit on the socket channel.
+// The payload is the credit increment as a big endian uint32. It is not JSON as these are sent very frequently.
+
+// ==========================================
+// Constructors
+// ==========================================
+
+// NewWindowUpdatePacket creates a new packet granting credit on a socket channel
+// @param channelId: the socket channel the credit is for
+// @param credit: the number of bytes of credit to grant
+func NewWindowUpdatePacket(channelId uint32, credit uint32) *proxy.Packet {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, credit)
+
+	packet := proxy.NewPacketOfBytes(data, proxy.WindowUpdate)
+	packet.Chan = proxy.SocketChannel{Id: channelId}
+	return packet
+}
+
+// ==========================================
+// Public Methods
+// ==========================================
+
+// DecodeWindowUpdatePacket returns the credit granted by a window update packet
+func DecodeWindowUpdatePacket(packet *proxy.Packet) (uint32, error) {
+	if len(packet.Data) != 4 {
+		return 0, errors.New("malformed window update packet")
+	}
+	return binary.BigEndian.Uint32(packet.Data), nil
+}
@@ -0,0 +1,61 @@
+package proxy
+
+import "slices"
+
+// Capability is an optional protocol feature. A feature is only used
+// when both ends of a connection declare it during the handshake.
+type Capability string
+
+type Capabilities []Capability
+
+const (
+	// credit based flow control per socket channel. See WindowUpdate packets
+	CapabilityFlowControl Capability = "flow-control"
+	// Data payloads may be deflate compressed. See FlagCompressed
+	CapabilityCompression Capability = "compression"
+	// Data payloads may be end to end encrypted between channel members. See FlagEncrypted
+	CapabilityEncryption Capability = "e2e-encryption"
+	// one direction of a socket channel can be closed on its own. See SocketHalfClose packets
+	CapabilityHalfClose Capability = "half-close"
+	// the remote end answers Ping packets
+	CapabilityHeartbeat Capability = "heartbeat"
+	// the session survives websocket reconnects. See session.go
+	CapabilityResume Capability = "session-resume"
+	// the client can forward udp datagrams
+	CapabilityDatagram Capability = "datagram"
+	// the client can connect socket channels to unix sockets. See ForwardingRule.RemoteSocket
+	CapabilityUnixSocket Capability = "unix-socket"
+)
+
+// SupportedCapabilities lists every capability this build implements.
+// New features register themselves here.
+var SupportedCapabilities = Capabilities{
+	CapabilityFlowControl,
+	CapabilityCompression,
+	CapabilityEncryption,
+	CapabilityHalfClose,
+	CapabilityHeartbeat,
+	CapabilityResume,
+	CapabilityDatagram,
+	CapabilityUnixSocket,
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// Has returns true if the capability is in the set
+func (caps Capabilities) Has(capability Capability) bool {
+	return slices.Contains(caps, capability)
+}
+
+// Intersect returns the capabilities that are in both sets
+func (caps Capabilities) Intersect(other Capabilities) Capabilities {
+	var result = make(Capabilities, 0)
+	for _, capability := range caps {
+		if other.Has(capability) && !result.Has(capability) {
+			result = append(result, capability)
+		}
+	}
+	return result
+}
@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"sync"
+)
+
+// payloads smaller than this are never worth compressing
+const minCompressSize = 256
+
+// compressed payloads must be at most this fraction of the original size, otherwise the original is sent
+const maxCompressRatio = 0.9
+
+var flateWriterPool = sync.Pool{
+	New: func() any {
+		writer, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return writer
+	},
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// CompressPayload deflate compresses the payload
+// @param data the payload to compress
+// @return the compressed payload, and false if the payload did not compress well enough to bother.
+func CompressPayload(data []byte) ([]byte, bool) {
+	if len(data) < minCompressSize {
+		return data, false
+	}
+
+	var buffer bytes.Buffer
+	writer := flateWriterPool.Get().(*flate.Writer)
+	defer flateWriterPool.Put(writer)
+	writer.Reset(&buffer)
+
+	_, err := writer.Write(data)
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil || float64(buffer.Len()) > float64(len(data))*maxCompressRatio {
+		return data, false
+	}
+	return buffer.Bytes(), true
+}
+
+// DecompressPayload reverses CompressPayload
+func DecompressPayload(data []byte) ([]byte, error) {
+	reader := flate.NewReader(bytes.NewReader(data))
+	defer reader.Close()
+
+	// never inflate past what we would accept as a packet
+	data, err := io.ReadAll(io.LimitReader(reader, int64(config.MaxPacketSize)+1))
+	if err == nil && len(data) > config.MaxPacketSize {
+		return nil, errors.New("decompressed payload exceeds the max packet size")
+	}
+	return data, err
+}
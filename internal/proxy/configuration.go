@@ -1,13 +1,117 @@
 package proxy
 
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Config holds the settings below that can be changed at start up. See Configure
+type Config struct {
+	WebsocketReadBufferSize  int
+	WebsocketWriteBufferSize int
+	// the max size of a packet payload, so someone can't just crash the server. Applies to every transport.
+	// The proxy clients break packets up in to 1MB chunks, so under normal operation this should never be hit.
+	MaxPacketSize int
+	// packets queued per connection, in each direction, before writers block
+	ChannelBufferSize int
+	// http long polling messages queued in each direction before writers block
+	PollQueueSize int
+	// most unacknowledged payload bytes a session keeps for retransmission, shared by all of its lanes.
+	// A session that overflows it may not be resumable. See session.go
+	ReplayBufferSize int
+
+	// how long each side waits for the other during the Hello / HelloAck exchange
+	HandshakeTimeout time.Duration
+	// how long the server holds a poll receive request open while it has nothing to send
+	PollWaitTimeout time.Duration
+	// the server drops a poll transport the client has not polled for this long
+	PollIdleTimeout time.Duration
+}
+
+// the current configuration. Only changed by Configure, before any connection is made
+var config = DefaultConfig()
+
+// smallest MaxPacketSize that still fits the 1MB chunks sent by the proxy clients, plus encryption overhead
+const minMaxPacketSize = 2 * 1024 * 1024
+
+// heartbeat defaults, used when ProxyClientSettings do not specify them
+const defaultHeartbeatInterval = 10 * time.Second
+const defaultHeartbeatTimeout = 30 * time.Second
+
+// session resumption. See session.go
+// how long the server holds a suspended session, used when ProxyClientSettings do not specify it
+const defaultResumeGracePeriod = 60 * time.Second
+
+// the receiver acknowledges after this many packets or bytes, and on every heartbeat
+const ackPacketThreshold = 64
+const ackByteThreshold = 1024 * 1024
+
+// delay between client attempts to resume a suspended session
+const resumeRetryInterval = 1 * time.Second
+
+// most parallel connections a client may stripe its session over. The lanes split the replay buffer between them
+const maxLanes = 8
+
+// ============================================
+// Http long polling transport. See pollServerTransport
+// ============================================
+// a receive response stops collecting messages once it holds this many bytes
+const pollMaxBatchSize = 4 * 1024 * 1024
+
+// ============================================
+// Constructors
+// ============================================
+
+// DefaultConfig returns the built in configuration
+func DefaultConfig() Config {
+	return Config{
+		WebsocketReadBufferSize:  1024,
+		WebsocketWriteBufferSize: 1024,
+		MaxPacketSize:            1024 * 1024 * 10, // 10MB
+		ChannelBufferSize:        1024,
+		PollQueueSize:            256,
+		ReplayBufferSize:         64 * 1024 * 1024, // 64MB
+		HandshakeTimeout:         10 * time.Second,
+		PollWaitTimeout:          20 * time.Second,
+		PollIdleTimeout:          45 * time.Second,
+	}
+}
+
 // ============================================
-// Websocket configuration constants
+// Public Methods
 // ============================================
-const wsReadBufferSize = 1024
-const wsWriteBufferSize = 1024
 
-// limits the max size of a websocket packet to 10MB so someone can't just crash the server.
-// The proxy clients break packets up in to 1MB chunks, so under normal operation this should never be hit.
-const wsMaxPacketSize = 1024 * 1024 * 10 // 10MB
+// Configure replaces the configuration. Must be called before any connection is made
+// @return an error describing the first invalid setting. The configuration is left unchanged
+func Configure(newConfig Config) error {
+	err := newConfig.Validate()
+	if err != nil {
+		return err
+	}
+	config = newConfig
+	return nil
+}
 
-const proxyChannelBufferSize = 1024
+// Validate checks that every setting is usable
+func (config Config) Validate() error {
+	if config.WebsocketReadBufferSize <= 0 || config.WebsocketWriteBufferSize <= 0 {
+		return errors.New("websocket buffer sizes must be positive")
+	}
+	if config.MaxPacketSize < minMaxPacketSize {
+		return fmt.Errorf("max packet size must be at least %d bytes, clients send packets of up to 1MB", minMaxPacketSize)
+	}
+	if config.ChannelBufferSize <= 0 || config.PollQueueSize <= 0 {
+		return errors.New("queue sizes must be positive")
+	}
+	if config.ReplayBufferSize <= 0 {
+		return errors.New("replay buffer size must be positive")
+	}
+	if config.HandshakeTimeout <= 0 || config.PollWaitTimeout <= 0 || config.PollIdleTimeout <= 0 {
+		return errors.New("timeouts must be positive")
+	}
+	if config.PollIdleTimeout <= config.PollWaitTimeout {
+		return errors.New("poll idle timeout must be longer than the poll wait timeout")
+	}
+	return nil
+}
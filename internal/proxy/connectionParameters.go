@@ -10,8 +10,50 @@ const ChannelParam = "channel"
 // The user friendly name of the client
 const ClientName = "clientName"
 
+// The packet encoding the client will use. See PacketEncoding
+const EncodingParam = "encoding"
+
 // =========================================
 // Websocket connection headers
 // =========================================
 
+// "Basic <channel password>" or "Bearer <access token>"
 const AuthorizationHeader = "Authorization"
+
+const BasicAuthorization = "Basic "
+const BearerAuthorization = "Bearer "
+
+// =========================================
+// Http routes, relative to the api root
+// =========================================
+
+// websocket transport
+const WebsocketRoute = "ws/connect"
+
+// http long polling transport. Connect opens a poll transport, send posts framed messages, receive long polls for them
+const PollConnectRoute = "poll/connect"
+const PollSendRoute = "poll/send"
+const PollReceiveRoute = "poll/receive"
+
+// identifies the poll transport on send and receive requests. A secret, so it is not put in the url
+const PollIdHeader = "X-GopherProxy-Poll-Id"
+
+// PollConnectResponse answers a poll connect request
+type PollConnectResponse struct {
+	PollId string
+}
+
+// =========================================
+// Raw tls transport
+// =========================================
+
+// ConnectRequest carries the websocket query parameters and headers on the raw tls transport.
+// It is the first message a client sends, JSON encoded.
+type ConnectRequest struct {
+	Channel    string
+	ClientName string
+	// see EncodingParam
+	Encoding string
+	// see AuthorizationHeader
+	Authorization string
+}
@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// End to end encryption of socket channel payloads.
+//
+// Every client generates an ephemeral X25519 key pair and publishes the public key in its channel member info.
+// When a socket channel is created the source picks a random salt. Both ends then combine their private key
+// with the other end's public key and derive two AES-256-GCM keys with HKDF-SHA256, one per direction.
+// The proxy server relays the salt and the public keys but never learns the keys.
+//
+// Sealed payload layout: 8 byte big endian message counter | ciphertext + GCM tag.
+// The counter doubles as the nonce and must strictly increase, so the server cannot replay or reorder payloads.
+// Note that the server relays the public keys, so this protects against a passive relay, not an active one.
+
+// size of the random salt the source picks for each socket channel
+const ChannelKeySaltSize = 32
+
+const counterSize = 8
+
+// ChannelCipher encrypts and authenticates the payloads of one socket channel
+type ChannelCipher struct {
+	sealAead    cipher.AEAD
+	openAead    cipher.AEAD
+	sendCounter uint64
+	recvCounter uint64
+}
+
+// ============================================
+// Constructors
+// ============================================
+
+// NewKeyPair generates a new ephemeral key pair for end to end encryption
+func NewKeyPair() (*ecdh.PrivateKey, error) {
+	return ecdh.X25519().GenerateKey(rand.Reader)
+}
+
+// NewChannelKeySalt generates a random salt for a new socket channel
+func NewChannelKeySalt() ([]byte, error) {
+	salt := make([]byte, ChannelKeySaltSize)
+	_, err := rand.Read(salt)
+	return salt, err
+}
+
+// NewChannelCipher derives the cipher for our end of a socket channel
+// @param privateKey: our private key
+// @param sourcePublicKey: public key of the socket channel source
+// @param sinkPublicKey: public key of the socket channel sink
+// @param salt: the salt the source picked for this socket channel
+// @param isSource: true if we are the source of the socket channel
+func NewChannelCipher(privateKey *ecdh.PrivateKey, sourcePublicKey []byte, sinkPublicKey []byte, salt []byte, isSource bool) (*ChannelCipher, error) {
+	if len(salt) != ChannelKeySaltSize {
+		return nil, errors.New("invalid socket channel key salt")
+	}
+
+	peerKeyBytes := sinkPublicKey
+	if !isSource {
+		peerKeyBytes = sourcePublicKey
+	}
+	peerKey, err := ecdh.X25519().NewPublicKey(peerKeyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer public key: %w", err)
+	}
+
+	secret, err := privateKey.ECDH(peerKey)
+	if err != nil {
+		return nil, err
+	}
+
+	info := append(append([]byte("gopherproxy socket channel"), sourcePublicKey...), sinkPublicKey...)
+	sourceToSink, err := newAead(hkdf(secret, salt, append(info, "source->sink"...)))
+	if err != nil {
+		return nil, err
+	}
+	sinkToSource, err := newAead(hkdf(secret, salt, append(info, "sink->source"...)))
+	if err != nil {
+		return nil, err
+	}
+
+	if isSource {
+		return &ChannelCipher{sealAead: sourceToSink, openAead: sinkToSource}, nil
+	}
+	return &ChannelCipher{sealAead: sinkToSource, openAead: sourceToSink}, nil
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// Seal encrypts and authenticates a payload. Not safe for concurrent use.
+// @param data: the plaintext
+// @param additionalData: data that is authenticated but not encrypted
+func (channelCipher *ChannelCipher) Seal(data []byte, additionalData []byte) []byte {
+	channelCipher.sendCounter++
+
+	sealed := make([]byte, counterSize, counterSize+len(data)+channelCipher.sealAead.Overhead())
+	binary.BigEndian.PutUint64(sealed, channelCipher.sendCounter)
+	return channelCipher.sealAead.Seal(sealed, nonceFor(channelCipher.sendCounter), data, additionalData)
+}
+
+// Open decrypts and authenticates a payload produced by the other end's Seal. Not safe for concurrent use.
+// @param sealed: the sealed payload
+// @param additionalData: the additional data the payload was sealed with
+func (channelCipher *ChannelCipher) Open(sealed []byte, additionalData []byte) ([]byte, error) {
+	if len(sealed) < counterSize {
+		return nil, errors.New("sealed payload too short")
+	}
+
+	counter := binary.BigEndian.Uint64(sealed[:counterSize])
+	if counter <= channelCipher.recvCounter {
+		return nil, errors.New("replayed or reordered encrypted payload")
+	}
+
+	data, err := channelCipher.openAead.Open(nil, nonceFor(counter), sealed[counterSize:], additionalData)
+	if err != nil {
+		return nil, err
+	}
+	channelCipher.recvCounter = counter
+	return data, nil
+}
+
+// ============================================
+// Private Methods
+// ============================================
+
+func newAead(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func nonceFor(counter uint64) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], counter)
+	return nonce
+}
+
+// hkdf derives a 32 byte key with HKDF-SHA256 (RFC 5869). A single expand block is all we need.
+func hkdf(secret []byte, salt []byte, info []byte) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(secret)
+	pseudoRandomKey := extract.Sum(nil)
+
+	expand := hmac.New(sha256.New, pseudoRandomKey)
+	expand.Write(info)
+	expand.Write([]byte{1})
+	return expand.Sum(nil)
+}
@@ -1,6 +1,6 @@
 package proxy
 
 type SocketChannel struct {
-	Id   string
-	Name string
+	// compact numeric id of the socket channel, assigned by the server. 0 means "no socket channel"
+	Id uint32
 }
@@ -0,0 +1,45 @@
+package proxy
+
+// ErrorCode tells the receiver of an Error or CriticalError packet what went wrong, so it can react programmatically
+type ErrorCode string
+
+const (
+	// the error came from a peer that does not send structured errors
+	ErrorUnknown ErrorCode = "unknown"
+	// something went wrong that the receiver cannot do anything about
+	ErrorInternal ErrorCode = "internal"
+	// the channel password is wrong
+	ErrorAuthFailed ErrorCode = "auth-failed"
+	// the client is authenticated but not allowed to do what it asked for
+	ErrorForbidden ErrorCode = "forbidden"
+	// the channel policy on the server does not allow the requested socket channel
+	ErrorPolicyDenied ErrorCode = "policy-denied"
+	// an administrator locked the channel, it does not accept new members
+	ErrorChannelLocked ErrorCode = "channel-locked"
+	// the server only accepts channels declared in its config, and this is not one of them
+	ErrorUnknownChannel ErrorCode = "unknown-channel"
+	// the two ends do not speak a common protocol version
+	ErrorProtocolMismatch ErrorCode = "protocol-mismatch"
+	// another member of the channel already has the name the client asked for
+	ErrorNameTaken ErrorCode = "name-taken"
+	// another client joined the channel under this client's name and took over
+	ErrorSessionReplaced ErrorCode = "session-replaced"
+	// an administrator removed the client from the channel
+	ErrorKicked ErrorCode = "kicked"
+	// the session to resume does not exist anymore
+	ErrorSessionExpired ErrorCode = "session-expired"
+	// a packet referred to a channel member that is not connected
+	ErrorUnknownMember ErrorCode = "unknown-member"
+	// a packet referred to a socket channel that does not exist
+	ErrorUnknownSocketChannel ErrorCode = "unknown-socket-channel"
+	// the sink could not reach the target of the forwarding rule
+	ErrorDialRefused ErrorCode = "dial-refused"
+	ErrorDialTimeout ErrorCode = "dial-timeout"
+	ErrorDialFailed  ErrorCode = "dial-failed"
+	// the exposure policy of the sink does not allow the source to reach the target
+	ErrorExposureDenied ErrorCode = "exposure-denied"
+	// the sink refused the socket channel, e.g. because it requires end to end encryption
+	ErrorSocketChannelRefused ErrorCode = "socket-channel-refused"
+	// the sender is sending too much, too fast
+	ErrorRateLimited ErrorCode = "rate-limited"
+)
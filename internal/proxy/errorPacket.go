@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// ErrorPacket is the payload of Error and CriticalError packets. It is also an error in its own right
+type ErrorPacket struct {
+	Code    ErrorCode
+	Message string
+	// the socket channel the error is about. 0 if none
+	ChannelId uint32 `json:",omitempty"`
+	// the socket channel create request the error is about. Empty if none
+	RequestId string `json:",omitempty"`
+}
+
+// ===========================================
+// Constructors
+// ===========================================
+
+// NewErrorPacket creates a new error with the given code
+func NewErrorPacket(code ErrorCode, message string) *ErrorPacket {
+	return &ErrorPacket{
+		Code:    code,
+		Message: message,
+	}
+}
+
+// ErrorPacketFromError converts any error in to an ErrorPacket, picking the code from the error type
+func ErrorPacketFromError(err error) *ErrorPacket {
+	var errorPacket *ErrorPacket
+	var authenticationError *AuthenticationError
+	var protocolError *ProtocolError
+
+	switch {
+	case errors.As(err, &errorPacket):
+		return errorPacket
+	case errors.As(err, &authenticationError):
+		return NewErrorPacket(ErrorAuthFailed, authenticationError.Message)
+	case errors.As(err, &protocolError):
+		return NewErrorPacket(ErrorProtocolMismatch, protocolError.Message)
+	default:
+		return NewErrorPacket(ErrorInternal, err.Error())
+	}
+}
+
+// DecodeErrorPacket decodes the payload of an Error or CriticalError packet.
+// Peers that predate structured errors send plain text, which is returned with ErrorUnknown.
+func DecodeErrorPacket(packet *Packet) *ErrorPacket {
+	var errorPacket ErrorPacket
+	err := json.Unmarshal(packet.Data, &errorPacket)
+	if err != nil || errorPacket.Code == "" {
+		return NewErrorPacket(ErrorUnknown, string(packet.Data))
+	}
+	return &errorPacket
+}
+
+// ===========================================
+// Public Methods
+// ===========================================
+
+func (e *ErrorPacket) Error() string {
+	return e.Message
+}
+
+// ToPacket wraps the error in a packet
+// @param typ: Error or CriticalError
+func (e *ErrorPacket) ToPacket(typ PacketType) *Packet {
+	packet, err := NewPacketFromStruct(e, typ)
+	if err != nil {
+		// cannot happen, the struct only holds strings and numbers
+		return NewPacketOfBytes([]byte(e.Message), typ)
+	}
+	packet.Chan = SocketChannel{Id: e.ChannelId}
+	return packet
+}
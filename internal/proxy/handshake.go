@@ -0,0 +1,247 @@
+package proxy
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// current protocol version spoken by this build
+const ProtocolVersion = 1
+
+// oldest protocol version this build can still talk to
+const MinProtocolVersion = 1
+
+// protocol version reported for legacy (gob encoded) peers. They predate the handshake
+const LegacyProtocolVersion = 0
+
+// HelloPacket is sent by the client right after connecting
+type HelloPacket struct {
+	ProtocolVersion    int
+	MinProtocolVersion int
+	Capabilities       Capabilities
+	// set when the client wants to resume a suspended session instead of starting a new one
+	Resume *ResumeRequest `json:",omitempty"`
+	// how many parallel connections the client would like to stripe the session over
+	Lanes int `json:",omitempty"`
+}
+
+// ResumeRequest identifies the session a client wants to resume
+type ResumeRequest struct {
+	SessionId uuid.UUID
+	Token     string
+	// the last sequence number the client received from the server
+	LastReceivedSeq uint64
+	// the lane of the session to resume
+	Lane int `json:",omitempty"`
+}
+
+// HelloAckPacket is the server response to Hello
+type HelloAckPacket struct {
+	// the protocol version both ends will speak
+	ProtocolVersion int
+	// the capabilities both ends declared
+	Capabilities Capabilities
+
+	// session resumption. Only set if both ends declared CapabilityResume
+	SessionId         uuid.UUID
+	ResumeToken       string        `json:",omitempty"`
+	ResumeGracePeriod time.Duration `json:",omitempty"`
+	// how many parallel connections the session is striped over. The client joins all but the first by resuming them
+	Lanes int `json:",omitempty"`
+	// true if the Hello resumed an existing session
+	Resumed bool `json:",omitempty"`
+	// the last sequence number the server received from the client. Only set when resuming
+	LastReceivedSeq uint64 `json:",omitempty"`
+}
+
+// ============================================
+// Constructors
+// ============================================
+
+// NewHello creates a Hello describing this build
+func NewHello() HelloPacket {
+	return HelloPacket{
+		ProtocolVersion:    ProtocolVersion,
+		MinProtocolVersion: MinProtocolVersion,
+		Capabilities:       SupportedCapabilities,
+	}
+}
+
+// newLegacyHelloAck is the handshake result for legacy peers that do not handshake at all
+func newLegacyHelloAck() HelloAckPacket {
+	return HelloAckPacket{
+		ProtocolVersion: LegacyProtocolVersion,
+		Capabilities:    Capabilities{},
+	}
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// Negotiate checks that the remote Hello is compatible with this build
+// and returns the agreed upon protocol version and capabilities
+func (hello HelloPacket) Negotiate() (HelloAckPacket, error) {
+	if hello.ProtocolVersion < MinProtocolVersion {
+		return HelloAckPacket{}, NewProtocolError(fmt.Sprintf("Protocol version %d is no longer supported. This server requires at least version %d, please upgrade your client", hello.ProtocolVersion, MinProtocolVersion))
+	}
+	if hello.MinProtocolVersion > ProtocolVersion {
+		return HelloAckPacket{}, NewProtocolError(fmt.Sprintf("Client requires protocol version %d or newer but this server only speaks version %d, please upgrade the server", hello.MinProtocolVersion, ProtocolVersion))
+	}
+
+	return HelloAckPacket{
+		ProtocolVersion: min(hello.ProtocolVersion, ProtocolVersion),
+		Capabilities:    SupportedCapabilities.Intersect(hello.Capabilities),
+	}, nil
+}
+
+// ============================================
+// Private Methods
+// ============================================
+
+// clientHandshake sends our Hello to the server and waits for the HelloAck
+// @param resume: the session to resume, or nil to start a new session
+func clientHandshake(transport Transport, settings ProxyClientSettings, resume *ResumeRequest) (HelloAckPacket, error) {
+	encoding := settings.Encoding
+	if encoding == GobEncoding {
+		return newLegacyHelloAck(), nil
+	}
+
+	hello := NewHello()
+	hello.Resume = resume
+	if resume == nil {
+		hello.Lanes = settings.Lanes
+	}
+	helloPacket, err := NewPacketFromStruct(hello, Hello)
+	if err != nil {
+		return HelloAckPacket{}, err
+	}
+	err = writeRawPacket(transport, helloPacket, encoding)
+	if err != nil {
+		return HelloAckPacket{}, err
+	}
+
+	packet, err := readRawPacket(transport, encoding, config.HandshakeTimeout)
+	if err != nil {
+		return HelloAckPacket{}, fmt.Errorf("server did not complete the protocol handshake, it may be too old: %w", err)
+	}
+
+	switch packet.Type {
+	case HelloAck:
+		var ack HelloAckPacket
+		err = packet.DecodeJsonData(&ack)
+		if err == nil && resume != nil && !ack.Resumed {
+			err = NewErrorPacket(ErrorSessionExpired, "server did not resume the session")
+		}
+		return ack, err
+	case CriticalError:
+		return HelloAckPacket{}, DecodeErrorPacket(packet)
+	default:
+		return HelloAckPacket{}, NewProtocolError(fmt.Sprintf("expected HelloAck from server but got packet type %d", packet.Type))
+	}
+}
+
+// serverHandshake waits for the client Hello, negotiates and answers with a HelloAck.
+// If the client is incompatible a CriticalError is sent to the client and an error returned.
+// @return the HelloAck, and the resumed session if the client resumed one. In that case the
+// transport has already been handed over to the session.
+func serverHandshake(transport Transport, settings ProxyClientSettings) (HelloAckPacket, *ProxyClient, error) {
+	encoding := settings.Encoding
+	if encoding == GobEncoding {
+		return newLegacyHelloAck(), nil, nil
+	}
+
+	packet, err := readRawPacket(transport, encoding, config.HandshakeTimeout)
+	if err != nil {
+		return HelloAckPacket{}, nil, err
+	}
+	if packet.Type != Hello {
+		err = NewProtocolError(fmt.Sprintf("expected Hello from client but got packet type %d", packet.Type))
+		writeRawPacket(transport, ErrorPacketFromError(err).ToPacket(CriticalError), encoding)
+		return HelloAckPacket{}, nil, err
+	}
+
+	var hello HelloPacket
+	err = packet.DecodeJsonData(&hello)
+	if err != nil {
+		return HelloAckPacket{}, nil, err
+	}
+
+	ack, err := hello.Negotiate()
+	if err != nil {
+		writeRawPacket(transport, ErrorPacketFromError(err).ToPacket(CriticalError), encoding)
+		return HelloAckPacket{}, nil, err
+	}
+
+	if hello.Resume != nil {
+		return resumeSessionHandshake(transport, settings, *hello.Resume)
+	}
+
+	ack.SessionId = uuid.New()
+	if ack.Capabilities.Has(CapabilityResume) {
+		ack.ResumeToken, err = newResumeToken()
+		if err != nil {
+			return HelloAckPacket{}, nil, err
+		}
+		ack.ResumeGracePeriod = settings.ResumeGracePeriod
+		if ack.ResumeGracePeriod <= 0 {
+			ack.ResumeGracePeriod = defaultResumeGracePeriod
+		}
+		// lanes are joined and recovered by resuming them, so they need resumption
+		ack.Lanes = max(min(hello.Lanes, maxLanes), 1)
+	}
+
+	ackPacket, err := NewPacketFromStruct(ack, HelloAck)
+	if err != nil {
+		return HelloAckPacket{}, nil, err
+	}
+	return ack, nil, writeRawPacket(transport, ackPacket, encoding)
+}
+
+// resumeSessionHandshake answers a Hello that asks to resume a suspended session,
+// and hands the transport over to the session
+func resumeSessionHandshake(transport Transport, settings ProxyClientSettings, resume ResumeRequest) (HelloAckPacket, *ProxyClient, error) {
+	session, err := sessions.claim(resume, settings)
+	if err != nil {
+		writeRawPacket(transport, ErrorPacketFromError(err).ToPacket(CriticalError), settings.Encoding)
+		return HelloAckPacket{}, nil, err
+	}
+
+	lane := session.lane(resume.Lane)
+	ack := session.resumeAck(lane)
+	ackPacket, err := NewPacketFromStruct(ack, HelloAck)
+	if err == nil {
+		err = writeRawPacket(transport, ackPacket, settings.Encoding)
+	}
+	if err == nil {
+		err = session.attachTransport(lane, transport, resume.LastReceivedSeq)
+	}
+	if err != nil {
+		session.suspend(lane)
+		return HelloAckPacket{}, nil, err
+	}
+	return ack, session, nil
+}
+
+// writeRawPacket writes a packet directly to the transport. Only safe before the pumps are started.
+func writeRawPacket(transport Transport, packet *Packet, encoding PacketEncoding) error {
+	bytes, err := packet.Encode(encoding, nil)
+	if err != nil {
+		return err
+	}
+	return transport.WriteMessage(bytes)
+}
+
+// readRawPacket reads a packet directly from the transport. Only safe before the pumps are started.
+func readRawPacket(transport Transport, encoding PacketEncoding, timeout time.Duration) (*Packet, error) {
+	transport.SetReadDeadline(time.Now().Add(timeout))
+	defer transport.SetReadDeadline(time.Time{})
+
+	message, err := transport.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	return DecodePacket(message, encoding, nil)
+}
@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"errors"
+	"time"
+
+	"github.com/CanadianCommander/gopherproxy/internal/logging"
+)
+
+// HeartbeatPacket is the payload of Ping and Pong packets.
+// A Pong echoes the SentAt of the Ping it answers, so the pinger can measure the round trip time.
+type HeartbeatPacket struct {
+	// unix nano timestamp of when the Ping was sent, by the pinger's clock
+	SentAt int64
+}
+
+// ============================================
+// Private Methods
+// ============================================
+
+// handleHeartbeat handles Ping and Pong packets. They never leave the ProxyClient.
+// @return true if the packet was a heartbeat packet
+// @param lane: the lane the packet arrived on. The Pong answering a Ping is sent back on it
+func (client *ProxyClient) handleHeartbeat(lane *lane, packet *Packet) bool {
+	switch packet.Type {
+	case Ping:
+		pong := *packet
+		pong.Type = Pong
+		select {
+		case lane.queue <- pong:
+		case <-client.CloseChannel:
+		}
+		return true
+	case Pong:
+		var heartbeat HeartbeatPacket
+		err := packet.DecodeJsonData(&heartbeat)
+		if err != nil {
+			logging.Get().Warnw("Failed to decode pong", "error", err)
+			return true
+		}
+
+		client.heartbeatMutex.Lock()
+		client.roundTripTime = time.Since(time.Unix(0, heartbeat.SentAt))
+		client.heartbeatMutex.Unlock()
+		return true
+	default:
+		return false
+	}
+}
+
+// heartbeat checks that the lane is still alive and pings the remote end over it
+func (client *ProxyClient) heartbeat(lane *lane, timeout time.Duration) {
+	transport := client.currentTransport(lane)
+	if transport == nil {
+		// suspended, nothing to ping
+		return
+	}
+
+	client.heartbeatMutex.Lock()
+	silence := time.Since(lane.lastReceivedAt)
+	client.heartbeatMutex.Unlock()
+
+	if silence > timeout {
+		logging.Get().Warnw("Remote end missed its heartbeat deadline. Dropping connection",
+			"remoteAddr", transport.RemoteAddr(),
+			"lane", lane.index,
+			"silence", silence)
+		client.transportLost(lane, transport, errors.New("heartbeat timeout"))
+		return
+	}
+	if client.resumable() {
+		client.flushAck(lane)
+	}
+
+	ping, err := NewPacketFromStruct(HeartbeatPacket{SentAt: time.Now().UnixNano()}, Ping)
+	if err == nil {
+		select {
+		case lane.queue <- *ping:
+		default:
+			// the lane is busy, which is as good as a ping
+		}
+	}
+}
+
+// ============================================
+// Go Routines
+// ============================================
+
+// heartbeatLoop pings the remote end on every lane every heartbeat interval, and drops the transport
+// of a lane if nothing has been received on it within the heartbeat timeout.
+// The session is then suspended if it can be resumed, otherwise closed.
+func (client *ProxyClient) heartbeatLoop() {
+	interval := client.Settings.HeartbeatInterval
+	if interval <= 0 {
+		interval = defaultHeartbeatInterval
+	}
+	timeout := client.Settings.HeartbeatTimeout
+	if timeout <= 0 {
+		timeout = defaultHeartbeatTimeout
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, lane := range client.lanes {
+				client.heartbeat(lane, timeout)
+			}
+		case <-client.CloseChannel:
+			return
+		}
+	}
+}
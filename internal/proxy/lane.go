@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+)
+
+// lane is one transport of a session. A session has a single lane unless the client stripes its traffic over
+// several parallel connections, see ProxyClientSettings.Lanes. Each socket channel sticks to one lane, so its
+// packets stay in order, and each lane numbers, acknowledges and resumes its packets on its own. See session.go
+type lane struct {
+	index int
+
+	// guarded by ProxyClient.sessionMutex
+	// the transport currently carrying the lane. nil while suspended
+	transport Transport
+	// incremented every time a transport is attached to or detached from the lane
+	transportGeneration uint64
+	// packets the remote end has not acknowledged yet. nil if the session is not resumable
+	replay *replayBuffer
+	// last sequence number received, and how much has been received since we last acknowledged
+	receivedSeq    uint64
+	unackedPackets int
+	unackedBytes   int
+
+	// guarded by ProxyClient.heartbeatMutex
+	lastReceivedAt time.Time
+
+	// serializes writes to the transport
+	writeMutex sync.Mutex
+	// packets waiting for the lane write pump
+	queue      chan Packet
+	ackChannel chan bool
+}
+
+// ============================================
+// Constructors
+// ============================================
+
+// newLane creates a lane
+// @param index: position of the lane in the session
+// @param transport: the transport carrying the lane, nil if it has yet to be attached
+// @param replaySize: the most payload bytes the lane keeps for retransmission. 0 if the session is not resumable
+func newLane(index int, transport Transport, replaySize int) *lane {
+	newLane := &lane{
+		index:          index,
+		transport:      transport,
+		lastReceivedAt: time.Now(),
+		queue:          make(chan Packet, config.ChannelBufferSize),
+		ackChannel:     make(chan bool, 1),
+	}
+	if replaySize > 0 {
+		newLane.replay = newReplayBuffer(replaySize)
+	}
+	return newLane
+}
@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// legacyChannelIds maps numeric socket channel ids to the UUID strings legacy (gob encoded) peers use.
+// Legacy peers only ever see UUIDs, the rest of the process only ever sees numeric ids.
+type legacyChannelIds struct {
+	mutex      sync.Mutex
+	toLegacy   map[uint32]string
+	fromLegacy map[string]uint32
+	// the last id assigned to a UUID the remote end handed out
+	lastId uint32
+	// client side only. The legacy server assigns socket channel ids, so unknown UUIDs are new socket channels.
+	// The server assigns ids itself and drops UUIDs it did not hand out.
+	assignOnDecode bool
+}
+
+// legacyPacket is the packet layout legacy peers encode and decode with gob
+type legacyPacket struct {
+	Type PacketType
+	Chan legacySocketChannel
+	Data []byte
+}
+
+type legacySocketChannel struct {
+	Id   string
+	Name string
+}
+
+// ============================================
+// Constructors
+// ============================================
+
+// newLegacyChannelIds creates an empty id mapping for one connection
+// @param assignOnDecode: true on the client side. See legacyChannelIds
+func newLegacyChannelIds(assignOnDecode bool) *legacyChannelIds {
+	return &legacyChannelIds{
+		toLegacy:       make(map[uint32]string),
+		fromLegacy:     make(map[string]uint32),
+		assignOnDecode: assignOnDecode,
+	}
+}
+
+// ============================================
+// Private Methods
+// ============================================
+
+// toLegacyPacket converts a packet to the legacy layout. Socket channel ids in socket connect
+// and disconnect payloads are converted too.
+func (ids *legacyChannelIds) toLegacyPacket(packet *Packet) (*legacyPacket, error) {
+	data := packet.Data
+	if packet.Type == SocketConnect || packet.Type == SocketDisconnect {
+		var err error
+		data, err = rewritePayloadId(data, func(raw json.RawMessage) (any, error) {
+			var id uint32
+			err := json.Unmarshal(raw, &id)
+			return ids.encode(id), err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &legacyPacket{
+		Type: packet.Type,
+		Chan: legacySocketChannel{Id: ids.encode(packet.Chan.Id)},
+		Data: data,
+	}, nil
+}
+
+// fromLegacyPacket converts a packet in the legacy layout to a packet
+func (ids *legacyChannelIds) fromLegacyPacket(legacy *legacyPacket) (*Packet, error) {
+	data := legacy.Data
+	if legacy.Type == SocketConnect || legacy.Type == SocketDisconnect {
+		var err error
+		data, err = rewritePayloadId(data, func(raw json.RawMessage) (any, error) {
+			var id string
+			err := json.Unmarshal(raw, &id)
+			return ids.decode(id), err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Packet{
+		Type: legacy.Type,
+		Chan: SocketChannel{Id: ids.decode(legacy.Chan.Id)},
+		Data: data,
+	}, nil
+}
+
+// encode returns the UUID for a numeric socket channel id, handing out a new one the first time the id is seen.
+// A nil mapping has no socket channels, every id is sent as ""
+func (ids *legacyChannelIds) encode(id uint32) string {
+	if ids == nil || id == 0 {
+		return ""
+	}
+	ids.mutex.Lock()
+	defer ids.mutex.Unlock()
+
+	legacyId, ok := ids.toLegacy[id]
+	if !ok {
+		legacyId = uuid.NewString()
+		ids.toLegacy[id] = legacyId
+		ids.fromLegacy[legacyId] = id
+	}
+	return legacyId
+}
+
+// decode returns the numeric socket channel id for a UUID. 0 if the UUID is unknown and may not be assigned
+func (ids *legacyChannelIds) decode(legacyId string) uint32 {
+	if ids == nil || legacyId == "" {
+		return 0
+	}
+	ids.mutex.Lock()
+	defer ids.mutex.Unlock()
+
+	id, ok := ids.fromLegacy[legacyId]
+	if !ok && ids.assignOnDecode {
+		ids.lastId++
+		id = ids.lastId
+		ids.toLegacy[id] = legacyId
+		ids.fromLegacy[legacyId] = id
+	}
+	return id
+}
+
+// rewritePayloadId replaces the Id field of a json payload
+// @param convert: converts the old value of the field to the new one
+func rewritePayloadId(data []byte, convert func(raw json.RawMessage) (any, error)) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := fields["Id"]
+	if !ok {
+		return data, nil
+	}
+
+	converted, err := convert(raw)
+	if err != nil {
+		return nil, err
+	}
+	fields["Id"], err = json.Marshal(converted)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
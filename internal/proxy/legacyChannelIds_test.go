@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"testing"
+)
+
+func TestLegacyChannelIdsRoundTrip(t *testing.T) {
+	server := newLegacyChannelIds(false)
+	client := newLegacyChannelIds(true)
+
+	connect, err := NewPacketFromStruct(map[string]any{"Id": 5, "RequestId": "request"}, SocketConnect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connect.Chan.Id = 5
+
+	// server to client. The client numbers the UUID it has not seen before
+	frame, err := connect.Encode(GobEncoding, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	received, err := DecodePacket(frame, GobEncoding, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload struct{ Id uint32 }
+	if err := received.DecodeJsonData(&payload); err != nil {
+		t.Fatal(err)
+	}
+	if received.Chan.Id != 1 || payload.Id != 1 {
+		t.Fatalf("client decoded ids %d and %d, want 1", received.Chan.Id, payload.Id)
+	}
+
+	// and back, the server sees its own id again
+	frame, err = received.Encode(GobEncoding, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	returned, err := DecodePacket(frame, GobEncoding, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := returned.DecodeJsonData(&payload); err != nil {
+		t.Fatal(err)
+	}
+	if returned.Chan.Id != 5 || payload.Id != 5 {
+		t.Errorf("server decoded ids %d and %d, want 5", returned.Chan.Id, payload.Id)
+	}
+}
+
+func TestLegacyChannelIdsServerDropsUnknownIds(t *testing.T) {
+	frame, err := (&Packet{Type: Data, Chan: SocketChannel{Id: 9}, Data: []byte("x")}).Encode(GobEncoding, newLegacyChannelIds(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet, err := DecodePacket(frame, GobEncoding, newLegacyChannelIds(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packet.Chan.Id != 0 {
+		t.Errorf("server decoded a UUID it never handed out as %d, want 0", packet.Chan.Id)
+	}
+}
+
+func TestLegacyChannelIdsWithoutSocketChannel(t *testing.T) {
+	frame, err := (&Packet{Type: MemberInfo, Data: []byte("{}")}).Encode(GobEncoding, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet, err := DecodePacket(frame, GobEncoding, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packet.Type != MemberInfo || packet.Chan.Id != 0 || string(packet.Data) != "{}" {
+		t.Errorf("DecodePacket() = %+v", packet)
+	}
+}
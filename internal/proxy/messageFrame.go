@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Message framing for transports that are plain byte streams, see tlsTransport and the poll transports.
+// Each message is prefixed with its length as a big endian uint32. A zero length message is the shutdown notice.
+
+const messageFrameHeaderSize = 4
+
+// ============================================
+// Private Methods
+// ============================================
+
+// maxFramedMessageSize is the largest message a stream transport accepts. Room for the largest packet plus its frame header
+func maxFramedMessageSize() int {
+	return config.MaxPacketSize + frameHeaderSize + frameSeqSize
+}
+
+// appendMessageFrame appends the framed message to the buffer
+// @param message: the message to frame. Empty for the shutdown notice
+func appendMessageFrame(buffer []byte, message []byte) []byte {
+	buffer = binary.BigEndian.AppendUint32(buffer, uint32(len(message)))
+	return append(buffer, message...)
+}
+
+// readMessageFrame reads the next framed message
+// @return the message. Empty, but not nil, for the shutdown notice
+func readMessageFrame(reader io.Reader) ([]byte, error) {
+	var header [messageFrameHeaderSize]byte
+	_, err := io.ReadFull(reader, header[:])
+	if err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if uint64(size) > uint64(maxFramedMessageSize()) {
+		return nil, NewProtocolError(fmt.Sprintf("message of %d bytes exceeds the maximum message size", size))
+	}
+
+	message := make([]byte, size)
+	_, err = io.ReadFull(reader, message)
+	if err != nil {
+		return nil, err
+	}
+	return message, nil
+}
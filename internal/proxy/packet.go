@@ -22,11 +22,46 @@ const (
 	MemberInfo
 	SocketConnect
 	SocketDisconnect
+	// first packet sent by a client after connecting. Advertises the protocol version and capabilities of the client
+	Hello
+	// server response to Hello. Contains the negotiated protocol version and capabilities
+	HelloAck
+	// grants the receiver more byte credit to send on a socket channel
+	WindowUpdate
+	// FIN for one direction of a socket channel. The sender will send no more data,
+	// the receiver should close the write side of its local socket once all data is written.
+	SocketHalfClose
+	// heartbeat request and response. Handled inside ProxyClient. See heartbeat.go
+	Ping
+	Pong
+	// acknowledges sequenced packets so the sender can drop them from its replay buffer. See session.go
+	SessionAck
+	// a single datagram on a udp socket channel. Unlike Data, packet boundaries are meaningful
+	Datagram
 )
 
+// PacketFlags is a bit field of per packet options. Carried in the frame header.
+type PacketFlags uint16
+
+const (
+	// the payload is deflate compressed
+	FlagCompressed PacketFlags = 1 << iota
+	// the payload is end to end encrypted. See encryption.go
+	FlagEncrypted
+	// the packet carries a session sequence number. See session.go
+	FlagSequenced
+)
+
+// flags set by the source client and read by the sink client. The server must not change these,
+// so they are authenticated along with encrypted payloads.
+const EndToEndFlags = FlagCompressed | FlagEncrypted
+
 type Packet struct {
-	Type PacketType
-	Chan SocketChannel
+	Type  PacketType
+	Flags PacketFlags
+	Chan  SocketChannel
+	// session sequence number. Only valid if FlagSequenced is set
+	Seq  uint64
 	Data []byte
 }
 
@@ -57,31 +92,69 @@ func NewPacketFromStruct(obj any, typ PacketType) (*Packet, error) {
 	}, err
 }
 
-// DecodePacketFromBytes creates a new packet from a byte array
+// DecodePacket creates a new packet from a byte array using the given encoding
+// @param legacyIds: maps the socket channel ids of gob encoded packets. nil if the packet carries none
+func DecodePacket(data []byte, encoding PacketEncoding, legacyIds *legacyChannelIds) (*Packet, error) {
+	if encoding == GobEncoding {
+		return decodePacketFromGobBytes(data, legacyIds)
+	}
+	return DecodePacketFromBytes(data)
+}
+
+// DecodePacketFromBytes creates a new packet from a binary frame
 func DecodePacketFromBytes(data []byte) (*Packet, error) {
+	return decodeFrame(data)
+}
 
-	var packet = Packet{
-		Type: Data,
-		Chan: SocketChannel{},
-		Data: nil,
-	}
+// decodePacketFromGobBytes creates a new packet from a gob encoded byte array.
+// Only used when talking to peers that use the legacy gob encoding.
+// @param legacyIds: maps the UUID socket channel ids of the legacy peer to numeric ids
+func decodePacketFromGobBytes(data []byte, legacyIds *legacyChannelIds) (*Packet, error) {
+	var legacy legacyPacket
 
-	var err = gob.NewDecoder(bytes.NewBuffer(data)).Decode(&packet)
-	return &packet, err
+	var err = gob.NewDecoder(bytes.NewBuffer(data)).Decode(&legacy)
+	if err != nil {
+		return nil, err
+	}
+	return legacyIds.fromLegacyPacket(&legacy)
 }
 
 // ============================================
 // Public Methods
 // ============================================
 
-// ToBytes converts the packet to a byte array
+// Encode converts the packet to a byte array using the given encoding
+// @param legacyIds: maps the socket channel ids of gob encoded packets. nil if the packet carries none
+func (packet *Packet) Encode(encoding PacketEncoding, legacyIds *legacyChannelIds) ([]byte, error) {
+	if encoding == GobEncoding {
+		return packet.toGobBytes(legacyIds)
+	}
+	return packet.ToBytes()
+}
+
+// ToBytes converts the packet to a binary frame
 func (packet *Packet) ToBytes() ([]byte, error) {
+	return encodeFrame(packet)
+}
+
+// toGobBytes converts the packet to a gob encoded byte array in the layout legacy peers use
+// @param legacyIds: maps numeric socket channel ids to the UUIDs the legacy peer knows them by
+func (packet *Packet) toGobBytes(legacyIds *legacyChannelIds) ([]byte, error) {
 	var buffer bytes.Buffer
 
-	var err = gob.NewEncoder(&buffer).Encode(packet)
+	legacy, err := legacyIds.toLegacyPacket(packet)
+	if err != nil {
+		return nil, err
+	}
+	err = gob.NewEncoder(&buffer).Encode(legacy)
 	return buffer.Bytes(), err
 }
 
+// HasFlag returns true if the given flag is set on this packet
+func (packet *Packet) HasFlag(flag PacketFlags) bool {
+	return packet.Flags&flag != 0
+}
+
 // DecodeJsonData inside this packet.
 func (packet *Packet) DecodeJsonData(out any) error {
 	return json.Unmarshal(packet.Data, out)
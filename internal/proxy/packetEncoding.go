@@ -0,0 +1,44 @@
+package proxy
+
+import "fmt"
+
+// PacketEncoding is the wire format used to serialize packets on a connection
+type PacketEncoding int
+
+const (
+	// BinaryEncoding is the length-prefixed binary frame format. See packetFrame.go
+	BinaryEncoding PacketEncoding = iota
+	// GobEncoding is the original encoding/gob based format.
+	// Only kept for compatibility with older clients and servers.
+	GobEncoding
+)
+
+// ============================================
+// Constructors
+// ============================================
+
+// ParsePacketEncoding parses the encoding name as sent in the encoding query parameter
+// @param name: the name of the encoding. An empty name is a legacy peer, which always uses gob.
+func ParsePacketEncoding(name string) (PacketEncoding, error) {
+	switch name {
+	case "binary":
+		return BinaryEncoding, nil
+	case "gob", "":
+		return GobEncoding, nil
+	default:
+		return BinaryEncoding, fmt.Errorf("unknown packet encoding: %s", name)
+	}
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+func (encoding PacketEncoding) String() string {
+	switch encoding {
+	case GobEncoding:
+		return "gob"
+	default:
+		return "binary"
+	}
+}
@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ============================================
+// Binary frame format
+// ============================================
+//
+// Every packet is sent as a single frame. All integers are big endian.
+//
+//	 0         1         2                   4                   8                   12
+//	 +---------+---------+-------------------+-------------------+-------------------+
+//	 | version |  type   |       flags       |     stream id     |  payload length   |
+//	 +---------+---------+-------------------+-------------------+-------------------+
+//	 | payload ...                                                                   |
+//	 +-------------------------------------------------------------------------------+
+//
+// - version: the frame format version. Currently always frameVersion.
+// - type: the PacketType of the packet.
+// - flags: PacketFlags bit field.
+// - stream id: the id of the socket channel this packet belongs to. 0 if the packet is not bound to a socket channel.
+// - payload length: the number of payload bytes following the header.
+//
+// If the FlagSequenced flag is set, the header is followed by an 8 byte session sequence number
+// which is not counted in the payload length.
+
+const frameVersion = 1
+const frameHeaderSize = 12
+const frameSeqSize = 8
+
+// ============================================
+// Private Methods
+// ============================================
+
+// encodeFrame encodes the packet in to a binary frame
+func encodeFrame(packet *Packet) ([]byte, error) {
+	if packet.Type < 0 || packet.Type > 0xFF {
+		return nil, fmt.Errorf("packet type %d cannot be encoded in a frame", packet.Type)
+	}
+	if uint64(len(packet.Data)) > uint64(config.MaxPacketSize) {
+		return nil, fmt.Errorf("packet payload of %d bytes exceeds the max packet size", len(packet.Data))
+	}
+
+	headerSize := frameHeaderSize
+	if packet.HasFlag(FlagSequenced) {
+		headerSize += frameSeqSize
+	}
+
+	frame := make([]byte, headerSize+len(packet.Data))
+	frame[0] = frameVersion
+	frame[1] = byte(packet.Type)
+	binary.BigEndian.PutUint16(frame[2:4], uint16(packet.Flags))
+	binary.BigEndian.PutUint32(frame[4:8], packet.Chan.Id)
+	binary.BigEndian.PutUint32(frame[8:12], uint32(len(packet.Data)))
+	if packet.HasFlag(FlagSequenced) {
+		binary.BigEndian.PutUint64(frame[frameHeaderSize:headerSize], packet.Seq)
+	}
+	copy(frame[headerSize:], packet.Data)
+
+	return frame, nil
+}
+
+// decodeFrame decodes a binary frame in to a packet
+func decodeFrame(frame []byte) (*Packet, error) {
+	if len(frame) < frameHeaderSize {
+		return nil, errors.New("frame is shorter than the frame header")
+	}
+	if frame[0] != frameVersion {
+		return nil, fmt.Errorf("unsupported frame version %d", frame[0])
+	}
+
+	flags := PacketFlags(binary.BigEndian.Uint16(frame[2:4]))
+	headerSize := frameHeaderSize
+	var seq uint64 = 0
+	if flags&FlagSequenced != 0 {
+		headerSize += frameSeqSize
+		if len(frame) < headerSize {
+			return nil, errors.New("frame is shorter than the sequenced frame header")
+		}
+		seq = binary.BigEndian.Uint64(frame[frameHeaderSize:headerSize])
+	}
+
+	payloadLength := binary.BigEndian.Uint32(frame[8:12])
+	if uint64(payloadLength) != uint64(len(frame)-headerSize) {
+		return nil, fmt.Errorf("frame payload length %d does not match frame size %d", payloadLength, len(frame)-headerSize)
+	}
+
+	return &Packet{
+		Type:  PacketType(frame[1]),
+		Flags: flags,
+		Chan:  SocketChannel{Id: binary.BigEndian.Uint32(frame[4:8])},
+		Seq:   seq,
+		Data:  frame[headerSize:],
+	}, nil
+}
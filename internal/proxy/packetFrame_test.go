@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet Packet
+	}{
+		{"empty", Packet{Type: MemberInfo}},
+		{"data", Packet{Type: Data, Chan: SocketChannel{Id: 42}, Data: []byte("hello")}},
+		{"flags", Packet{Type: Data, Flags: FlagCompressed | FlagEncrypted, Chan: SocketChannel{Id: 0xFFFFFFFF}, Data: []byte{0, 1, 2}}},
+		{"sequenced", Packet{Type: Datagram, Flags: FlagSequenced, Chan: SocketChannel{Id: 7}, Seq: 0x0102030405060708, Data: []byte("seq")}},
+		{"sequenced without payload", Packet{Type: SocketHalfClose, Flags: FlagSequenced, Chan: SocketChannel{Id: 1}, Seq: 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			frame, err := encodeFrame(&test.packet)
+			if err != nil {
+				t.Fatalf("encodeFrame() error = %v", err)
+			}
+			wantSize := frameHeaderSize + len(test.packet.Data)
+			if test.packet.HasFlag(FlagSequenced) {
+				wantSize += frameSeqSize
+			}
+			if len(frame) != wantSize {
+				t.Errorf("frame is %d bytes, want %d", len(frame), wantSize)
+			}
+
+			decoded, err := decodeFrame(frame)
+			if err != nil {
+				t.Fatalf("decodeFrame() error = %v", err)
+			}
+			if decoded.Type != test.packet.Type || decoded.Flags != test.packet.Flags || decoded.Chan != test.packet.Chan ||
+				decoded.Seq != test.packet.Seq || !bytes.Equal(decoded.Data, test.packet.Data) {
+				t.Errorf("decodeFrame() = %+v, want %+v", decoded, test.packet)
+			}
+		})
+	}
+}
+
+func TestFrameLayout(t *testing.T) {
+	frame, err := encodeFrame(&Packet{Type: Data, Flags: FlagSequenced, Chan: SocketChannel{Id: 5}, Seq: 9, Data: []byte("ab")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{frameVersion, byte(Data), 0, byte(FlagSequenced), 0, 0, 0, 5, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 9, 'a', 'b'}
+	if !bytes.Equal(frame, want) {
+		t.Errorf("encodeFrame() = %v, want %v", frame, want)
+	}
+}
+
+func TestEncodeFrameRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet Packet
+	}{
+		{"oversize payload", Packet{Type: Data, Data: make([]byte, config.MaxPacketSize+1)}},
+		{"type out of range", Packet{Type: 0x100}},
+		{"negative type", Packet{Type: -1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := encodeFrame(&test.packet); err == nil {
+				t.Error("encodeFrame() accepted an invalid packet")
+			}
+		})
+	}
+}
+
+func TestDecodeFrameRejects(t *testing.T) {
+	valid, err := encodeFrame(&Packet{Type: Data, Chan: SocketChannel{Id: 1}, Data: []byte("payload")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	badVersion := append([]byte{}, valid...)
+	badVersion[0] = frameVersion + 1
+	lengthTooLong := append([]byte{}, valid...)
+	binary.BigEndian.PutUint32(lengthTooLong[8:12], 1<<31)
+	missingSeq := append([]byte{}, valid[:frameHeaderSize]...)
+	binary.BigEndian.PutUint16(missingSeq[2:4], uint16(FlagSequenced))
+	binary.BigEndian.PutUint32(missingSeq[8:12], 0)
+
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		{"empty", nil},
+		{"short header", valid[:frameHeaderSize-1]},
+		{"unknown version", badVersion},
+		{"truncated payload", valid[:len(valid)-1]},
+		{"trailing bytes", append(append([]byte{}, valid...), 0)},
+		{"oversize length", lengthTooLong},
+		{"sequenced without sequence number", missingSeq},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := decodeFrame(test.frame); err == nil {
+				t.Error("decodeFrame() accepted an invalid frame")
+			}
+		})
+	}
+}
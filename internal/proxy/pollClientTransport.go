@@ -0,0 +1,250 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pollClientTransport is the client end of the http long polling transport. See pollServerTransport
+type pollClientTransport struct {
+	httpClient *http.Client
+	// the api root of the proxy server
+	baseUrl url.URL
+	pollId  string
+	// messages from the server. nil is the shutdown notice
+	inbox  chan []byte
+	outbox chan []byte
+
+	closed    chan struct{}
+	closeOnce sync.Once
+	// why the transport failed. Set before closed is closed
+	failure  error
+	ctx      context.Context
+	cancel   context.CancelFunc
+	deadline atomic.Int64
+}
+
+// ============================================
+// Constructors
+// ============================================
+
+// newPollClientTransport starts polling a poll transport the server has opened for us
+// @param httpClient: the client to send requests with
+// @param baseUrl: the api root of the proxy server
+// @param pollId: the id from the PollConnectResponse
+func newPollClientTransport(httpClient *http.Client, baseUrl url.URL, pollId string) *pollClientTransport {
+	ctx, cancel := context.WithCancel(context.Background())
+	transport := &pollClientTransport{
+		httpClient: httpClient,
+		baseUrl:    baseUrl,
+		pollId:     pollId,
+		inbox:      make(chan []byte, config.PollQueueSize),
+		outbox:     make(chan []byte, config.PollQueueSize),
+		closed:     make(chan struct{}),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+
+	go transport.sendLoop()
+	go transport.receiveLoop()
+	return transport
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+func (transport *pollClientTransport) ReadMessage() ([]byte, error) {
+	var timeout <-chan time.Time
+	if deadline := transport.deadline.Load(); deadline != 0 {
+		timer := time.NewTimer(time.Until(time.Unix(0, deadline)))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case message := <-transport.inbox:
+		return pollMessage(message)
+	case <-transport.closed:
+		// deliver what arrived before the transport closed
+		select {
+		case message := <-transport.inbox:
+			return pollMessage(message)
+		default:
+			return nil, transport.failure
+		}
+	case <-timeout:
+		return nil, os.ErrDeadlineExceeded
+	}
+}
+
+func (transport *pollClientTransport) WriteMessage(message []byte) error {
+	select {
+	case transport.outbox <- message:
+		return nil
+	case <-transport.closed:
+		return transport.failure
+	}
+}
+
+func (transport *pollClientTransport) SetReadDeadline(deadline time.Time) error {
+	if deadline.IsZero() {
+		transport.deadline.Store(0)
+	} else {
+		transport.deadline.Store(deadline.UnixNano())
+	}
+	return nil
+}
+
+// Close stops polling. The server drops its end once it notices
+func (transport *pollClientTransport) Close() error {
+	transport.fail(net.ErrClosed)
+	return nil
+}
+
+// Shutdown sends the shutdown notice before closing the transport
+func (transport *pollClientTransport) Shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), transportShutdownTimeout)
+	defer cancel()
+
+	transport.post(ctx, appendMessageFrame(nil, nil))
+	return transport.Close()
+}
+
+func (transport *pollClientTransport) RemoteAddr() net.Addr {
+	return pollAddr(transport.baseUrl.Host)
+}
+
+// ============================================
+// Private Methods
+// ============================================
+
+// fail closes the transport, recording why
+func (transport *pollClientTransport) fail(err error) {
+	transport.closeOnce.Do(func() {
+		transport.failure = err
+		close(transport.closed)
+		transport.cancel()
+	})
+}
+
+// request sends a request for this transport to the given route
+func (transport *pollClientTransport) request(ctx context.Context, method string, route string, body []byte) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, method, transport.baseUrl.JoinPath(route).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set(PollIdHeader, transport.pollId)
+	return transport.httpClient.Do(request)
+}
+
+// post sends a batch of framed messages
+func (transport *pollClientTransport) post(ctx context.Context, batch []byte) error {
+	response, err := transport.request(ctx, http.MethodPost, PollSendRoute, batch)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("poll send failed with status %s", response.Status)
+	}
+	return nil
+}
+
+// ============================================
+// Go Routines
+// ============================================
+
+// sendLoop posts queued messages to the server, batching whatever has queued up while the previous post was in flight
+func (transport *pollClientTransport) sendLoop() {
+	for {
+		var batch []byte
+		select {
+		case message := <-transport.outbox:
+			batch = appendMessageFrame(nil, message)
+		case <-transport.closed:
+			return
+		}
+
+		collecting := true
+		for collecting && len(batch) < pollMaxBatchSize {
+			select {
+			case message := <-transport.outbox:
+				batch = appendMessageFrame(batch, message)
+			default:
+				collecting = false
+			}
+		}
+
+		err := transport.post(transport.ctx, batch)
+		if err != nil {
+			transport.fail(err)
+			return
+		}
+	}
+}
+
+// receiveLoop long polls the server for messages
+func (transport *pollClientTransport) receiveLoop() {
+	for {
+		ctx, cancel := context.WithTimeout(transport.ctx, config.PollWaitTimeout+config.HandshakeTimeout)
+		response, err := transport.request(ctx, http.MethodGet, PollReceiveRoute, nil)
+		if err != nil {
+			cancel()
+			transport.fail(err)
+			return
+		}
+
+		err = transport.receiveBatch(response)
+		response.Body.Close()
+		cancel()
+		if err != nil {
+			transport.fail(err)
+			return
+		}
+	}
+}
+
+// receiveBatch queues the messages of a receive response
+func (transport *pollClientTransport) receiveBatch(response *http.Response) error {
+	switch response.StatusCode {
+	case http.StatusNoContent:
+		return nil
+	case http.StatusOK:
+	default:
+		return fmt.Errorf("poll receive failed with status %s", response.Status)
+	}
+
+	for {
+		message, err := readMessageFrame(response.Body)
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if len(message) == 0 {
+			message = nil
+		}
+
+		select {
+		case transport.inbox <- message:
+		case <-transport.closed:
+			return transport.failure
+		}
+		if message == nil {
+			// the server is done with us, stop polling
+			return ErrTransportShutdown
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ============================================
+// Private Methods
+// ============================================
+
+// dialPoll opens an http long polling transport to the proxy server
+// @param proxyUrl: the websocket url of the proxy server. The poll routes are found next to the websocket route
+func dialPoll(proxyUrl url.URL, settings ProxyClientSettings) (Transport, error) {
+	baseUrl := pollBaseUrl(proxyUrl)
+
+	httpTransport := http.DefaultTransport.(*http.Transport).Clone()
+	if settings.TlsConfig != nil {
+		httpTransport.TLSClientConfig = settings.TlsConfig.Clone()
+	}
+	httpClient := &http.Client{Transport: httpTransport}
+
+	connectUrl := baseUrl.JoinPath(PollConnectRoute)
+	query := connectUrl.Query()
+	query.Add(ChannelParam, settings.Channel)
+	query.Add(ClientName, settings.Name)
+	query.Add(EncodingParam, settings.Encoding.String())
+	connectUrl.RawQuery = query.Encode()
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.HandshakeTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, connectUrl.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set(AuthorizationHeader, settings.Authorization())
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("poll connect failed with status %s", response.Status)
+	}
+
+	var connectResponse PollConnectResponse
+	err = json.NewDecoder(response.Body).Decode(&connectResponse)
+	if err != nil {
+		return nil, err
+	}
+	return newPollClientTransport(httpClient, baseUrl, connectResponse.PollId), nil
+}
+
+// pollBaseUrl derives the api root from the websocket url of the proxy server,
+// e.g. wss://proxy.example.com/api/ws/connect becomes https://proxy.example.com/api/
+func pollBaseUrl(proxyUrl url.URL) url.URL {
+	switch proxyUrl.Scheme {
+	case "ws":
+		proxyUrl.Scheme = "http"
+	case "wss":
+		proxyUrl.Scheme = "https"
+	}
+	proxyUrl.Path = strings.TrimSuffix(proxyUrl.Path, WebsocketRoute)
+	proxyUrl.RawPath = ""
+	proxyUrl.RawQuery = ""
+	return proxyUrl
+}
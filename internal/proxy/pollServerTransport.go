@@ -0,0 +1,289 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/CanadianCommander/gopherproxy/internal/logging"
+	"github.com/gin-gonic/gin"
+)
+
+// pollServerTransport is the server end of the http long polling transport, for networks that block websockets.
+// The client posts batches of framed messages to the send route, and long polls the receive route for ours.
+// See pollClientTransport for the other end.
+type pollServerTransport struct {
+	id         string
+	remoteAddr pollAddr
+	// messages from the client. nil is the shutdown notice
+	inbox  chan []byte
+	outbox chan []byte
+
+	closed    chan struct{}
+	closeOnce sync.Once
+	// true if we told the client the session is over. The next receive request delivers the notice
+	shutdown atomic.Bool
+	// unix nano time of the last request from the client
+	lastActive atomic.Int64
+	// serializes receive requests, so messages are delivered in order
+	receiveMutex sync.Mutex
+	deadline     atomic.Int64
+}
+
+// pollAddr is the address of the remote end of a poll transport
+type pollAddr string
+
+// registry of open poll transports, by id
+var pollTransports = struct {
+	transports map[string]*pollServerTransport
+	mutex      sync.Mutex
+}{
+	transports: make(map[string]*pollServerTransport),
+}
+
+// ============================================
+// Constructors
+// ============================================
+
+// NewPollTransport opens the server end of a poll transport. Hand it to AcceptTransport, and the id to the client
+// @param remoteAddr: the address of the client, for logging
+// @return the transport and the id the client presents on every request
+func NewPollTransport(remoteAddr string) (Transport, string, error) {
+	id, err := newResumeToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	transport := &pollServerTransport{
+		id:         id,
+		remoteAddr: pollAddr(remoteAddr),
+		inbox:      make(chan []byte, config.PollQueueSize),
+		outbox:     make(chan []byte, config.PollQueueSize),
+		closed:     make(chan struct{}),
+	}
+	transport.touch()
+
+	pollTransports.mutex.Lock()
+	pollTransports.transports[id] = transport
+	pollTransports.mutex.Unlock()
+
+	go transport.idleLoop()
+	return transport, id, nil
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// HandlePollSend receives a batch of framed messages from a poll client
+func HandlePollSend(context *gin.Context) {
+	transport := lookupPollTransport(context.GetHeader(PollIdHeader))
+	if transport == nil {
+		context.Status(http.StatusNotFound)
+		return
+	}
+	transport.touch()
+
+	reader := bufio.NewReader(http.MaxBytesReader(context.Writer, context.Request.Body, int64(pollMaxBatchSize+maxFramedMessageSize())))
+	for {
+		message, err := readMessageFrame(reader)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			logging.Get().Warnw("Failed to read poll transport batch", "remoteAddr", transport.remoteAddr, "error", err)
+			context.Status(http.StatusBadRequest)
+			return
+		}
+		if len(message) == 0 {
+			message = nil
+		}
+
+		select {
+		case transport.inbox <- message:
+		case <-transport.closed:
+			context.Status(http.StatusGone)
+			return
+		case <-context.Request.Context().Done():
+			return
+		}
+	}
+	context.Status(http.StatusNoContent)
+}
+
+// HandlePollReceive answers a long poll from a poll client with the messages queued for it.
+// Waits up to the poll wait timeout for a message to arrive.
+func HandlePollReceive(context *gin.Context) {
+	transport := lookupPollTransport(context.GetHeader(PollIdHeader))
+	if transport == nil {
+		context.Status(http.StatusNotFound)
+		return
+	}
+
+	transport.receiveMutex.Lock()
+	defer transport.receiveMutex.Unlock()
+	transport.touch()
+	defer transport.touch()
+
+	batch := make([]byte, 0)
+	select {
+	case message := <-transport.outbox:
+		batch = appendMessageFrame(batch, message)
+	case <-transport.closed:
+	case <-time.After(config.PollWaitTimeout):
+	case <-context.Request.Context().Done():
+		return
+	}
+
+	// collect whatever else is queued
+	collecting := true
+	for collecting && len(batch) < pollMaxBatchSize {
+		select {
+		case message := <-transport.outbox:
+			batch = appendMessageFrame(batch, message)
+		default:
+			collecting = false
+		}
+	}
+
+	if len(batch) == 0 {
+		select {
+		case <-transport.closed:
+			if !transport.shutdown.Load() {
+				context.Status(http.StatusGone)
+				return
+			}
+			batch = appendMessageFrame(batch, nil)
+		default:
+			context.Status(http.StatusNoContent)
+			return
+		}
+	}
+	context.Data(http.StatusOK, "application/octet-stream", batch)
+}
+
+func (transport *pollServerTransport) ReadMessage() ([]byte, error) {
+	var timeout <-chan time.Time
+	if deadline := transport.deadline.Load(); deadline != 0 {
+		timer := time.NewTimer(time.Until(time.Unix(0, deadline)))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case message := <-transport.inbox:
+		return pollMessage(message)
+	case <-transport.closed:
+		// deliver what arrived before the transport closed
+		select {
+		case message := <-transport.inbox:
+			return pollMessage(message)
+		default:
+			return nil, net.ErrClosed
+		}
+	case <-timeout:
+		return nil, os.ErrDeadlineExceeded
+	}
+}
+
+func (transport *pollServerTransport) WriteMessage(message []byte) error {
+	select {
+	case transport.outbox <- message:
+		return nil
+	case <-transport.closed:
+		return net.ErrClosed
+	}
+}
+
+func (transport *pollServerTransport) SetReadDeadline(deadline time.Time) error {
+	if deadline.IsZero() {
+		transport.deadline.Store(0)
+	} else {
+		transport.deadline.Store(deadline.UnixNano())
+	}
+	return nil
+}
+
+// Close forgets the transport. Requests from the client fail from now on
+func (transport *pollServerTransport) Close() error {
+	transport.closeOnce.Do(func() {
+		close(transport.closed)
+		// keep the transport registered for a moment so the client can collect the shutdown notice
+		time.AfterFunc(config.PollWaitTimeout, func() {
+			pollTransports.mutex.Lock()
+			delete(pollTransports.transports, transport.id)
+			pollTransports.mutex.Unlock()
+		})
+	})
+	return nil
+}
+
+// Shutdown closes the transport. The client receives the shutdown notice on its next receive request
+func (transport *pollServerTransport) Shutdown() error {
+	transport.shutdown.Store(true)
+	return transport.Close()
+}
+
+func (transport *pollServerTransport) RemoteAddr() net.Addr {
+	return transport.remoteAddr
+}
+
+func (addr pollAddr) Network() string {
+	return "http"
+}
+
+func (addr pollAddr) String() string {
+	return string(addr)
+}
+
+// ============================================
+// Private Methods
+// ============================================
+
+// lookupPollTransport finds an open poll transport by id. nil if there is none
+func lookupPollTransport(id string) *pollServerTransport {
+	pollTransports.mutex.Lock()
+	defer pollTransports.mutex.Unlock()
+
+	return pollTransports.transports[id]
+}
+
+// pollMessage turns a message from a poll transport inbox into a ReadMessage result
+func pollMessage(message []byte) ([]byte, error) {
+	if message == nil {
+		return nil, ErrTransportShutdown
+	}
+	return message, nil
+}
+
+// touch records activity from the client
+func (transport *pollServerTransport) touch() {
+	transport.lastActive.Store(time.Now().UnixNano())
+}
+
+// ============================================
+// Go Routines
+// ============================================
+
+// idleLoop closes the transport once the client stops polling
+func (transport *pollServerTransport) idleLoop() {
+	ticker := time.NewTicker(config.PollWaitTimeout)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if time.Since(time.Unix(0, transport.lastActive.Load())) > config.PollIdleTimeout {
+				logging.Get().Infow("Poll transport client stopped polling. Dropping transport", "remoteAddr", transport.remoteAddr)
+				transport.Close()
+				return
+			}
+		case <-transport.closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package proxy
+
+// ProtocolError is returned when the two ends of a connection cannot agree on a protocol
+type ProtocolError struct {
+	Message string
+}
+
+// ===========================================
+// Constructors
+// ===========================================
+
+func NewProtocolError(message string) *ProtocolError {
+	return &ProtocolError{
+		Message: message,
+	}
+}
+
+// ===========================================
+// Public Methods
+// ===========================================
+
+func (e *ProtocolError) Error() string {
+	return e.Message
+}
@@ -1,55 +1,119 @@
 package proxy
 
 import (
+	"crypto/tls"
+	"errors"
+	"sync"
 	"time"
 
 	"github.com/CanadianCommander/gopherproxy/internal/logging"
 	"github.com/google/uuid"
-	"github.com/gorilla/websocket"
 )
 
 type ProxyClient struct {
 	Id            uuid.UUID
-	WsCon         *websocket.Conn
-	InputChannel  chan Packet
 	OutputChannel chan Packet
 	CloseChannel  chan bool
 	Closed        bool
 	Settings      ProxyClientSettings
+	// negotiated during the handshake
+	ProtocolVersion int
+	Capabilities    Capabilities
+
+	closeMutex sync.Mutex
+	// heartbeat state
+	heartbeatMutex sync.Mutex
+	roundTripTime  time.Duration
+
+	// session state. See session.go
+	sessionMutex sync.Mutex
+	// the transports of the session. Never empty, the first lane also carries everything not tied to a socket channel
+	lanes       []*lane
+	sessionId   uuid.UUID
+	resumeToken string
+	gracePeriod time.Duration
+	// client side only. Dials a new transport to resume a lane of the session
+	redial func(resume ResumeRequest) (Transport, HelloAckPacket, error)
+	// socket channel ids as the remote end knows them. Only set for the legacy gob encoding
+	legacyIds *legacyChannelIds
 }
 
 type ProxyClientSettings struct {
 	Name     string
 	Channel  string
 	Password string
+	// access token issued by the server. Used instead of the password when set
+	Token string
+	// the wire format used for packets on this connection
+	Encoding PacketEncoding
+	// how often to ping the remote end, and how long it may stay silent before the connection is considered dead.
+	// Zero values use the defaults.
+	HeartbeatInterval time.Duration
+	HeartbeatTimeout  time.Duration
+	// server side only. How long a suspended session waits to be resumed. Zero uses the default.
+	ResumeGracePeriod time.Duration
+	// client side only. tls settings for wss:// and gopher+tls:// connections. nil uses the system defaults
+	TlsConfig *tls.Config
+	// client side only. How many parallel connections to stripe socket channels over. Zero means one.
+	// The server may grant fewer. Requires session resumption
+	Lanes int
 }
 
 // ============================================
 // Constructors
 // ============================================
 
-// newProxyClient creates a new websocket proxy client
-// @param wsCon: the websocket connection
-func newProxyClient(wsCon *websocket.Conn, settings ProxyClientSettings) *ProxyClient {
-	var client = ProxyClient{
-		Id:            uuid.New(),
-		WsCon:         wsCon,
-		InputChannel:  make(chan Packet, proxyChannelBufferSize),
-		OutputChannel: make(chan Packet, proxyChannelBufferSize),
-		CloseChannel:  make(chan bool, 1),
-		Closed:        false,
-		Settings:      settings,
+// newProxyClient creates a new proxy client
+// @param transport: the connection to the remote end. It carries the first lane, the others are attached later
+// @param ack: the result of the protocol handshake
+// @param redial: client side, dials a new transport to resume or join a lane of the session. nil on the server
+func newProxyClient(transport Transport, settings ProxyClientSettings, ack HelloAckPacket, redial func(resume ResumeRequest) (Transport, HelloAckPacket, error)) *ProxyClient {
+	id := ack.SessionId
+	if id == uuid.Nil {
+		id = uuid.New()
+	}
+	resumable := ack.Capabilities.Has(CapabilityResume) && ack.ResumeToken != ""
+	// the replay buffer is bounded per session, however many lanes the client asked for
+	replaySize := 0
+	if resumable {
+		replaySize = config.ReplayBufferSize / max(ack.Lanes, 1)
 	}
 
-	wsCon.SetCloseHandler(func(code int, text string) error {
-		logging.Get().Infow("Websocket connection closed",
-			"code", code,
-			"text", text)
-		return client.Close()
-	})
+	var client = ProxyClient{
+		Id:              id,
+		OutputChannel:   make(chan Packet, config.ChannelBufferSize),
+		CloseChannel:    make(chan bool, 1),
+		Closed:          false,
+		Settings:        settings,
+		ProtocolVersion: ack.ProtocolVersion,
+		Capabilities:    ack.Capabilities,
 
-	go client.messagePump()
-	go client.writePump()
+		lanes:       []*lane{newLane(0, transport, replaySize)},
+		sessionId:   id,
+		resumeToken: ack.ResumeToken,
+		gracePeriod: ack.ResumeGracePeriod,
+		redial:      redial,
+	}
+	if settings.Encoding == GobEncoding {
+		client.legacyIds = newLegacyChannelIds(redial != nil)
+	}
+	if resumable {
+		for index := 1; index < ack.Lanes; index++ {
+			client.lanes = append(client.lanes, newLane(index, nil, replaySize))
+		}
+	}
+
+	client.watchTransport(client.lanes[0], transport)
+	for _, lane := range client.lanes {
+		go client.writePump(lane)
+		if lane.transport == nil {
+			// the client joins the other lanes the same way it resumes them
+			client.suspend(lane)
+		}
+	}
+	if client.Capabilities.Has(CapabilityHeartbeat) {
+		go client.heartbeatLoop()
+	}
 
 	return &client
 }
@@ -63,7 +127,11 @@ func (client *ProxyClient) Write(packet Packet) {
 		return
 	}
 
-	client.InputChannel <- packet
+	lane := client.laneFor(&packet)
+	select {
+	case lane.queue <- packet:
+	case <-client.CloseChannel:
+	}
 }
 
 func (client *ProxyClient) Read() (Packet, bool) {
@@ -75,79 +143,202 @@ func (client *ProxyClient) Read() (Packet, bool) {
 	}
 }
 
+// Lanes returns the number of parallel connections the session stripes its socket channels over
+func (client *ProxyClient) Lanes() int {
+	return len(client.lanes)
+}
+
+// Authorization returns the AuthorizationHeader value for the settings. The access token wins over the password
+func (settings ProxyClientSettings) Authorization() string {
+	if settings.Token != "" {
+		return BearerAuthorization + settings.Token
+	}
+	return BasicAuthorization + settings.Password
+}
+
+// QueueDepth returns the number of packets waiting to be handled: received packets not read yet,
+// and packets waiting to be sent on any lane
+func (client *ProxyClient) QueueDepth() (received int, sending int) {
+	for _, lane := range client.lanes {
+		sending += len(lane.queue)
+	}
+	return len(client.OutputChannel), sending
+}
+
+// RoundTripTime returns the last measured heartbeat round trip time. 0 if none has been measured yet
+func (client *ProxyClient) RoundTripTime() time.Duration {
+	client.heartbeatMutex.Lock()
+	defer client.heartbeatMutex.Unlock()
+
+	return client.roundTripTime
+}
+
+// Close closes the connection, ending the session. Safe to call from multiple go routines.
 func (client *ProxyClient) Close() error {
+	client.closeMutex.Lock()
 	if client.Closed {
+		client.closeMutex.Unlock()
 		return nil
 	}
-
 	client.Closed = true
-	close(client.InputChannel)
-	close(client.OutputChannel)
-	client.CloseChannel <- true
 	close(client.CloseChannel)
+	client.closeMutex.Unlock()
+
+	sessions.remove(client)
+
+	client.sessionMutex.Lock()
+	transports := make([]Transport, 0, len(client.lanes))
+	for _, lane := range client.lanes {
+		if lane.transport != nil {
+			transports = append(transports, lane.transport)
+			lane.transport = nil
+		}
+	}
+	client.sessionMutex.Unlock()
 
-	client.WsCon.WriteControl(websocket.CloseMessage, nil, time.Now().Add(1000*time.Millisecond))
-	return client.WsCon.Close()
+	var err error
+	for _, transport := range transports {
+		err = errors.Join(err, transport.Shutdown())
+	}
+	return err
 }
 
 // ============================================
 // Private Methods
 // ============================================
 
-// messagePump reads from the websocket connection and writes to the websocket input channel
-func (client *ProxyClient) messagePump() {
-	logging.Get().Infow("Starting proxy message pump", "RemoteAddr", client.WsCon.RemoteAddr())
+// watchTransport starts reading from a transport that now carries the lane
+func (client *ProxyClient) watchTransport(lane *lane, transport Transport) {
+	go client.messagePump(lane, transport)
+}
+
+// laneFor picks the lane a packet is sent on. Packets of a socket channel always take the same lane
+func (client *ProxyClient) laneFor(packet *Packet) *lane {
+	return client.lanes[packet.Chan.Id%uint32(len(client.lanes))]
+}
+
+// currentTransport returns the transport currently carrying the lane, nil while suspended
+func (client *ProxyClient) currentTransport(lane *lane) Transport {
+	client.sessionMutex.Lock()
+	defer client.sessionMutex.Unlock()
+
+	return lane.transport
+}
+
+// send numbers the packet if the session is resumable and writes it to the transport of the lane.
+// While the lane is suspended the packet is only kept for retransmission.
+func (client *ProxyClient) send(lane *lane, packet Packet) {
+	lane.writeMutex.Lock()
+	defer lane.writeMutex.Unlock()
+
+	client.sessionMutex.Lock()
+	if client.resumable() && isSequenced(packet.Type) {
+		lane.replay.push(&packet)
+	}
+	transport := lane.transport
+	client.sessionMutex.Unlock()
+
+	if transport != nil {
+		client.writePacket(lane, transport, &packet)
+	}
+}
+
+// writePacket writes a packet to the transport. The caller must hold the lane write mutex
+func (client *ProxyClient) writePacket(lane *lane, transport Transport, packet *Packet) error {
+	bytes, err := packet.Encode(client.Settings.Encoding, client.legacyIds)
+	if err != nil {
+		logging.Get().Warn("Failed to encode packet for sending to remote end",
+			"error", err,
+			"remoteAddr", transport.RemoteAddr())
+		return nil
+	}
+
+	err = transport.WriteMessage(bytes)
+	if err != nil {
+		transportErrors.Inc(transportName(transport), "write")
+		logging.Get().Warn("Failed to write to remote end",
+			"error", err,
+			"remoteAddr", transport.RemoteAddr())
+		client.transportLost(lane, transport, err)
+	}
+	return err
+}
+
+// messagePump reads from the transport of a lane and writes to the output channel
+func (client *ProxyClient) messagePump(lane *lane, transport Transport) {
+	logging.Get().Infow("Starting proxy message pump", "RemoteAddr", transport.RemoteAddr(), "lane", lane.index)
 
 	for {
 		if client.Closed {
 			break
 		}
 
-		msgType, message, err := client.WsCon.ReadMessage()
-		if err != nil {
-			logging.Get().Warn("Failed to read from websocket, likely close. ",
-				"error", err)
+		message, err := transport.ReadMessage()
+		if errors.Is(err, ErrTransportShutdown) {
+			logging.Get().Infow("Remote end closed the connection", "remoteAddr", transport.RemoteAddr())
 			client.Close()
 			break
+		} else if err != nil {
+			transportErrors.Inc(transportName(transport), "read")
+			logging.Get().Warn("Failed to read from transport, likely close. ",
+				"error", err)
+			client.transportLost(lane, transport, err)
+			break
+		}
+
+		client.heartbeatMutex.Lock()
+		lane.lastReceivedAt = time.Now()
+		client.heartbeatMutex.Unlock()
+
+		packet, err := DecodePacket(message, client.Settings.Encoding, client.legacyIds)
+		if err != nil {
+			logging.Get().Warn("Failed to decode incoming packet from remote end",
+				"error", err,
+				"remoteAddr", transport.RemoteAddr())
+			continue
 		}
 
-		if msgType == websocket.BinaryMessage {
-			packet, err := DecodePacketFromBytes(message)
+		if packet.Type == SessionAck {
+			client.handleSessionAck(lane, packet)
+			continue
+		}
+		if packet.HasFlag(FlagSequenced) {
+			fresh, err := client.receiveSequenced(lane, packet)
 			if err != nil {
-				logging.Get().Warn("Failed to decode incoming packet from remote websocket",
-					"error", err,
-					"remoteAddr", client.WsCon.RemoteAddr())
-			} else {
-				client.OutputChannel <- *packet
+				client.transportLost(lane, transport, err)
+				break
+			}
+			if !fresh {
+				continue
+			}
+			// sequence numbers belong to this hop. A relayed packet is numbered again by the session it is sent on
+			packet.Flags &^= FlagSequenced
+			packet.Seq = 0
+		}
+
+		if !client.handleHeartbeat(lane, packet) {
+			select {
+			case client.OutputChannel <- *packet:
+			case <-client.CloseChannel:
 			}
 		}
 	}
 
-	logging.Get().Infow("Proxy message pump closed", "RemoteAddr", client.WsCon.RemoteAddr())
+	logging.Get().Infow("Proxy message pump closed", "RemoteAddr", transport.RemoteAddr())
 }
 
-// writePump reads from the websocket input channel and writes to the websocket connection
-func (client *ProxyClient) writePump() {
-	logging.Get().Infow("Starting proxy write pump", "RemoteAddr", client.WsCon.RemoteAddr())
+// writePump writes the packets queued for a lane to its transport
+func (client *ProxyClient) writePump(lane *lane) {
+	logging.Get().Infow("Starting proxy write pump", "sessionId", client.sessionId, "lane", lane.index)
 
 	for {
 		select {
-		case packet := <-client.InputChannel:
-			bytes, err := packet.ToBytes()
-			if err != nil {
-				logging.Get().Warn("Failed to encode packet for sending to remote websocket",
-					"error", err,
-					"remoteAddr", client.WsCon.RemoteAddr())
-			} else {
-				err = client.WsCon.WriteMessage(websocket.BinaryMessage, bytes)
-				if err != nil {
-					logging.Get().Warn("Failed to write to remote websocket",
-						"error", err,
-						"remoteAddr", client.WsCon.RemoteAddr())
-				}
-			}
+		case packet := <-lane.queue:
+			client.send(lane, packet)
+		case <-lane.ackChannel:
+			client.sendAck(lane)
 		case <-client.CloseChannel:
-			logging.Get().Infow("Proxy write pump closed", "RemoteAddr", client.WsCon.RemoteAddr())
+			logging.Get().Infow("Proxy write pump closed", "sessionId", client.sessionId, "lane", lane.index)
 			return
 		}
 	}
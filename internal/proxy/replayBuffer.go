@@ -0,0 +1,79 @@
+package proxy
+
+// replayBuffer numbers outgoing packets and holds them until the remote end acknowledges them,
+// so they can be retransmitted when a session is resumed. Not safe for concurrent use.
+type replayBuffer struct {
+	packets []Packet
+	// total payload bytes held
+	size    int
+	maxSize int
+	// sequence number of the last packet pushed
+	lastSeq uint64
+}
+
+// ============================================
+// Constructors
+// ============================================
+
+// newReplayBuffer creates an empty replay buffer
+// @param maxSize: the most payload bytes to hold. The oldest packets are dropped beyond this
+func newReplayBuffer(maxSize int) *replayBuffer {
+	return &replayBuffer{
+		packets: make([]Packet, 0),
+		size:    0,
+		maxSize: maxSize,
+		lastSeq: 0,
+	}
+}
+
+// ============================================
+// Private Methods
+// ============================================
+
+// push assigns the next sequence number to the packet and holds on to it
+func (buffer *replayBuffer) push(packet *Packet) {
+	buffer.lastSeq++
+	packet.Seq = buffer.lastSeq
+	packet.Flags |= FlagSequenced
+
+	buffer.packets = append(buffer.packets, *packet)
+	buffer.size += len(packet.Data)
+	for buffer.size > buffer.maxSize && len(buffer.packets) > 1 {
+		buffer.drop()
+	}
+}
+
+// acknowledge drops all packets up to and including the given sequence number
+func (buffer *replayBuffer) acknowledge(seq uint64) {
+	for len(buffer.packets) > 0 && buffer.packets[0].Seq <= seq {
+		buffer.drop()
+	}
+}
+
+// since returns all packets after the given sequence number
+// @param seq: the last sequence number the remote end received
+// @return the packets, and false if some of them have already been dropped
+func (buffer *replayBuffer) since(seq uint64) ([]Packet, bool) {
+	if seq > buffer.lastSeq {
+		return nil, false
+	}
+	if seq == buffer.lastSeq {
+		return []Packet{}, true
+	}
+	if len(buffer.packets) == 0 || buffer.packets[0].Seq > seq+1 {
+		return nil, false
+	}
+
+	for i, packet := range buffer.packets {
+		if packet.Seq > seq {
+			return append([]Packet{}, buffer.packets[i:]...), true
+		}
+	}
+	return []Packet{}, true
+}
+
+func (buffer *replayBuffer) drop() {
+	buffer.size -= len(buffer.packets[0].Data)
+	buffer.packets[0] = Packet{}
+	buffer.packets = buffer.packets[1:]
+}
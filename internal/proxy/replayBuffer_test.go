@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"testing"
+)
+
+// pushed fills a replay buffer with packets of the given payload sizes
+func pushed(maxSize int, sizes ...int) *replayBuffer {
+	buffer := newReplayBuffer(maxSize)
+	for _, size := range sizes {
+		buffer.push(&Packet{Type: Data, Data: make([]byte, size)})
+	}
+	return buffer
+}
+
+func seqs(packets []Packet) []uint64 {
+	numbers := make([]uint64, 0, len(packets))
+	for _, packet := range packets {
+		numbers = append(numbers, packet.Seq)
+	}
+	return numbers
+}
+
+func TestReplayBufferPush(t *testing.T) {
+	buffer := newReplayBuffer(100)
+	packet := Packet{Type: Data, Data: []byte("a")}
+	buffer.push(&packet)
+	buffer.push(&packet)
+
+	if packet.Seq != 2 || !packet.HasFlag(FlagSequenced) {
+		t.Errorf("push() numbered the packet %d with flags %b, want 2 and FlagSequenced", packet.Seq, packet.Flags)
+	}
+	if buffer.size != 2 || len(buffer.packets) != 2 {
+		t.Errorf("buffer holds %d packets of %d bytes, want 2 of 2", len(buffer.packets), buffer.size)
+	}
+}
+
+func TestReplayBufferSince(t *testing.T) {
+	tests := []struct {
+		name   string
+		buffer *replayBuffer
+		ack    uint64
+		since  uint64
+		want   []uint64
+		wantOk bool
+	}{
+		{"nothing sent", pushed(100), 0, 0, []uint64{}, true},
+		{"everything missed", pushed(100, 1, 1, 1), 0, 0, []uint64{1, 2, 3}, true},
+		{"some missed", pushed(100, 1, 1, 1), 0, 1, []uint64{2, 3}, true},
+		{"nothing missed", pushed(100, 1, 1, 1), 0, 3, []uint64{}, true},
+		{"after acknowledge", pushed(100, 1, 1, 1), 2, 2, []uint64{3}, true},
+		{"peer claims more than was sent", pushed(100, 1, 1, 1), 0, 4, nil, false},
+		{"missed packets already acknowledged", pushed(100, 1, 1, 1), 2, 1, nil, false},
+		{"missed packets dropped for space", pushed(10, 6, 6, 6), 0, 0, nil, false},
+		{"newest packets kept for space", pushed(10, 6, 6, 6), 0, 2, []uint64{3}, true},
+		{"oversize packet kept", pushed(10, 20), 0, 0, []uint64{1}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.buffer.acknowledge(test.ack)
+			packets, ok := test.buffer.since(test.since)
+			if ok != test.wantOk {
+				t.Fatalf("since(%d) ok = %v, want %v", test.since, ok, test.wantOk)
+			}
+			if !ok {
+				return
+			}
+			got := seqs(packets)
+			if len(got) != len(test.want) {
+				t.Fatalf("since(%d) = %v, want %v", test.since, got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Fatalf("since(%d) = %v, want %v", test.since, got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestReplayBufferAcknowledge(t *testing.T) {
+	buffer := pushed(100, 3, 4, 5)
+
+	buffer.acknowledge(0)
+	if len(buffer.packets) != 3 || buffer.size != 12 {
+		t.Fatalf("acknowledge(0) left %d packets of %d bytes, want 3 of 12", len(buffer.packets), buffer.size)
+	}
+	buffer.acknowledge(2)
+	if len(buffer.packets) != 1 || buffer.size != 5 {
+		t.Fatalf("acknowledge(2) left %d packets of %d bytes, want 1 of 5", len(buffer.packets), buffer.size)
+	}
+	// stale and repeated acknowledgements are harmless
+	buffer.acknowledge(1)
+	buffer.acknowledge(10)
+	if len(buffer.packets) != 0 || buffer.size != 0 {
+		t.Fatalf("acknowledge(10) left %d packets of %d bytes, want none", len(buffer.packets), buffer.size)
+	}
+
+	// numbering carries on after everything is acknowledged
+	packet := Packet{Type: Data}
+	buffer.push(&packet)
+	if packet.Seq != 4 {
+		t.Errorf("push() after acknowledge numbered the packet %d, want 4", packet.Seq)
+	}
+}
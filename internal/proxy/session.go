@@ -0,0 +1,352 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/CanadianCommander/gopherproxy/internal/logging"
+)
+
+// Session resumption.
+//
+// When both ends declare CapabilityResume the ProxyClient is a session that can outlive its transport.
+// Every packet other than Ping, Pong and SessionAck is numbered and kept in a replay buffer until the remote
+// end acknowledges it with a SessionAck. If the transport drops, the session is suspended instead of closed.
+// The client redials and presents the resume token from the HelloAck together with the last sequence number it
+// received. The server answers with the last sequence number it received, and both ends retransmit what the
+// other missed. A session that is not resumed within the grace period is closed.
+//
+// A session striped over several lanes does all of this per lane. The client joins the extra lanes after the
+// handshake by resuming them, which also delivers whatever the server queued for them in the mean time.
+
+// ============================================
+// Public Methods
+// ============================================
+
+// Suspended returns true while the session has lost a transport and is waiting for it to be resumed
+func (client *ProxyClient) Suspended() bool {
+	client.sessionMutex.Lock()
+	defer client.sessionMutex.Unlock()
+
+	if client.Closed {
+		return false
+	}
+	for _, lane := range client.lanes {
+		if lane.transport == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterSession makes a server side session resumable. Call it once the client has been authenticated
+// and admitted, a session that is never registered cannot be resumed or have lanes joined.
+func (client *ProxyClient) RegisterSession() {
+	if client.redial != nil || !client.resumable() {
+		return
+	}
+	// under the close mutex so a concurrent Close cannot miss the registration
+	client.closeMutex.Lock()
+	defer client.closeMutex.Unlock()
+	if !client.Closed {
+		sessions.add(client)
+	}
+}
+
+// ============================================
+// Private Methods
+// ============================================
+
+// resumable returns true if the session can survive the loss of its transports
+func (client *ProxyClient) resumable() bool {
+	return client.lanes[0].replay != nil
+}
+
+// isSequenced returns true if packets of the given type are numbered and retransmitted on resume
+func isSequenced(packetType PacketType) bool {
+	return packetType != Ping && packetType != Pong && packetType != SessionAck
+}
+
+// resumeAck builds the HelloAck sent to a client resuming a lane of this session
+func (client *ProxyClient) resumeAck(lane *lane) HelloAckPacket {
+	client.sessionMutex.Lock()
+	defer client.sessionMutex.Unlock()
+
+	return HelloAckPacket{
+		ProtocolVersion:   client.ProtocolVersion,
+		Capabilities:      client.Capabilities,
+		SessionId:         client.sessionId,
+		ResumeToken:       client.resumeToken,
+		ResumeGracePeriod: client.gracePeriod,
+		Lanes:             len(client.lanes),
+		Resumed:           true,
+		LastReceivedSeq:   lane.receivedSeq,
+	}
+}
+
+// lane returns the lane with the given index, nil if there is none
+func (client *ProxyClient) lane(index int) *lane {
+	if index < 0 || index >= len(client.lanes) {
+		return nil
+	}
+	return client.lanes[index]
+}
+
+// transportLost is called when a transport fails. The lane is suspended if it can be resumed, otherwise the session is closed.
+// @param lane: the lane the transport carries
+// @param transport: the transport that failed. Ignored if the lane has already moved on from it
+// @param reason: why the transport failed
+func (client *ProxyClient) transportLost(lane *lane, transport Transport, reason error) {
+	client.sessionMutex.Lock()
+	if transport != lane.transport {
+		client.sessionMutex.Unlock()
+		return
+	}
+	if !client.resumable() {
+		client.sessionMutex.Unlock()
+		client.Close()
+		return
+	}
+	lane.transport = nil
+	lane.transportGeneration++
+	client.sessionMutex.Unlock()
+
+	transport.Close()
+	logging.Get().Infow("Transport lost. Session suspended",
+		"sessionId", client.sessionId,
+		"lane", lane.index,
+		"remoteAddr", transport.RemoteAddr(),
+		"reason", reason)
+	client.suspend(lane)
+}
+
+// suspend waits for a lane without a transport to be resumed. The server waits for the client,
+// the client redials the server. The session is closed if the lane is not resumed within the grace period.
+func (client *ProxyClient) suspend(lane *lane) {
+	client.sessionMutex.Lock()
+	generation := lane.transportGeneration
+	client.sessionMutex.Unlock()
+
+	if client.redial != nil {
+		go client.resumeLoop(lane, generation)
+	} else {
+		time.AfterFunc(client.gracePeriod, func() {
+			client.expireSuspension(lane, generation)
+		})
+	}
+}
+
+// expireSuspension closes the session if the lane is still suspended since the given transport generation
+func (client *ProxyClient) expireSuspension(lane *lane, generation uint64) {
+	client.sessionMutex.Lock()
+	expired := lane.transport == nil && lane.transportGeneration == generation
+	client.sessionMutex.Unlock()
+
+	if expired {
+		logging.Get().Infow("Suspended session was not resumed in time. Closing", "sessionId", client.sessionId, "lane", lane.index)
+		client.Close()
+	}
+}
+
+// detachTransport prepares a lane to be resumed on a new transport, dropping the current one if any.
+// The session is closed if it cannot be resumed because retransmission data was lost.
+// @param peerReceivedSeq: the last sequence number the remote end received on the lane
+// @return false if the session cannot be resumed
+func (client *ProxyClient) detachTransport(lane *lane, peerReceivedSeq uint64) bool {
+	client.sessionMutex.Lock()
+	if client.Closed {
+		client.sessionMutex.Unlock()
+		return false
+	}
+	if _, ok := lane.replay.since(peerReceivedSeq); !ok {
+		client.sessionMutex.Unlock()
+		client.Close()
+		return false
+	}
+	oldTransport := lane.transport
+	lane.transport = nil
+	lane.transportGeneration++
+	client.sessionMutex.Unlock()
+
+	if oldTransport != nil {
+		oldTransport.Close()
+	}
+	return true
+}
+
+// attachTransport resumes a lane on a new transport, retransmitting everything the remote end missed
+// @param transport: the new transport. The handshake must be complete
+// @param peerReceivedSeq: the last sequence number the remote end received on the lane
+func (client *ProxyClient) attachTransport(lane *lane, transport Transport, peerReceivedSeq uint64) error {
+	lane.writeMutex.Lock()
+	client.sessionMutex.Lock()
+	if client.Closed {
+		client.sessionMutex.Unlock()
+		lane.writeMutex.Unlock()
+		return errors.New("session is closed")
+	}
+	lane.replay.acknowledge(peerReceivedSeq)
+	packets, ok := lane.replay.since(peerReceivedSeq)
+	if !ok {
+		client.sessionMutex.Unlock()
+		lane.writeMutex.Unlock()
+		client.Close()
+		return NewErrorPacket(ErrorSessionExpired, "Session can no longer be resumed, too much data was lost")
+	}
+	lane.transport = transport
+	lane.transportGeneration++
+	client.sessionMutex.Unlock()
+
+	client.heartbeatMutex.Lock()
+	lane.lastReceivedAt = time.Now()
+	client.heartbeatMutex.Unlock()
+
+	// retransmit before the write pump sends anything new
+	for i := range packets {
+		if client.writePacket(lane, transport, &packets[i]) != nil {
+			break
+		}
+	}
+	lane.writeMutex.Unlock()
+
+	logging.Get().Infow("Session resumed",
+		"sessionId", client.sessionId,
+		"lane", lane.index,
+		"remoteAddr", transport.RemoteAddr(),
+		"retransmitted", len(packets))
+	client.watchTransport(lane, transport)
+	return nil
+}
+
+// receiveSequenced checks the sequence number of a packet that arrived on a lane
+// @return false if the packet is a duplicate that has already been received,
+// or an error if packets have gone missing
+func (client *ProxyClient) receiveSequenced(lane *lane, packet *Packet) (bool, error) {
+	client.sessionMutex.Lock()
+	defer client.sessionMutex.Unlock()
+
+	if packet.Seq <= lane.receivedSeq {
+		return false, nil
+	}
+	if packet.Seq != lane.receivedSeq+1 {
+		return false, NewProtocolError(fmt.Sprintf("expected sequence number %d but got %d", lane.receivedSeq+1, packet.Seq))
+	}
+
+	lane.receivedSeq = packet.Seq
+	lane.unackedPackets++
+	lane.unackedBytes += len(packet.Data)
+	if lane.unackedPackets >= ackPacketThreshold || lane.unackedBytes >= ackByteThreshold {
+		requestAck(lane)
+	}
+	return true, nil
+}
+
+// flushAck requests an acknowledgement if anything has been received on the lane since the last one
+func (client *ProxyClient) flushAck(lane *lane) {
+	client.sessionMutex.Lock()
+	defer client.sessionMutex.Unlock()
+
+	if lane.unackedPackets > 0 {
+		requestAck(lane)
+	}
+}
+
+// requestAck asks the write pump of the lane to send a SessionAck
+func requestAck(lane *lane) {
+	select {
+	case lane.ackChannel <- true:
+	default:
+	}
+}
+
+// sendAck acknowledges everything received on the lane so far. Called by the write pump
+func (client *ProxyClient) sendAck(lane *lane) {
+	lane.writeMutex.Lock()
+	defer lane.writeMutex.Unlock()
+
+	client.sessionMutex.Lock()
+	transport := lane.transport
+	seq := lane.receivedSeq
+	lane.unackedPackets = 0
+	lane.unackedBytes = 0
+	client.sessionMutex.Unlock()
+
+	if transport != nil {
+		client.writePacket(lane, transport, NewPacketOfBytes(binary.BigEndian.AppendUint64(nil, seq), SessionAck))
+	}
+}
+
+// handleSessionAck drops acknowledged packets from the replay buffer of the lane
+func (client *ProxyClient) handleSessionAck(lane *lane, packet *Packet) {
+	if len(packet.Data) != 8 || !client.resumable() {
+		logging.Get().Warnw("Ignoring invalid session ack", "sessionId", client.sessionId)
+		return
+	}
+
+	client.sessionMutex.Lock()
+	defer client.sessionMutex.Unlock()
+
+	lane.replay.acknowledge(binary.BigEndian.Uint64(packet.Data))
+}
+
+// ============================================
+// Go Routines
+// ============================================
+
+// resumeLoop redials the server until the lane is resumed, the server refuses, or the grace period runs out.
+// Client side only.
+// @param generation: the transport generation the lane was suspended at
+func (client *ProxyClient) resumeLoop(lane *lane, generation uint64) {
+	deadline := time.Now().Add(client.gracePeriod)
+
+	for attempt := 0; time.Now().Before(deadline); attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(resumeRetryInterval):
+			case <-client.CloseChannel:
+				return
+			}
+		}
+
+		client.sessionMutex.Lock()
+		if lane.transportGeneration != generation || client.Closed {
+			client.sessionMutex.Unlock()
+			return
+		}
+		request := ResumeRequest{
+			SessionId:       client.sessionId,
+			Token:           client.resumeToken,
+			LastReceivedSeq: lane.receivedSeq,
+			Lane:            lane.index,
+		}
+		client.sessionMutex.Unlock()
+
+		transport, ack, err := client.redial(request)
+		var errorPacket *ErrorPacket
+		if errors.As(err, &errorPacket) {
+			if generation == 0 && errorPacket.Code == ErrorSessionExpired {
+				// joining a lane for the first time. The server registers the session once it admitted us,
+				// which may not have happened yet
+				logging.Get().Debugw("Server does not know the session yet. Retrying", "sessionId", client.sessionId, "lane", lane.index)
+				continue
+			}
+			logging.Get().Warnw("Server refused to resume session", "sessionId", client.sessionId, "lane", lane.index, "error", err)
+			break
+		} else if err != nil {
+			logging.Get().Debugw("Failed to resume session. Retrying", "sessionId", client.sessionId, "lane", lane.index, "error", err)
+			continue
+		}
+
+		err = client.attachTransport(lane, transport, ack.LastReceivedSeq)
+		if err != nil {
+			logging.Get().Warnw("Failed to resume session", "sessionId", client.sessionId, "lane", lane.index, "error", err)
+			transport.Close()
+			break
+		}
+		return
+	}
+
+	client.Close()
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// sessionRegistry tracks the server side sessions that can be resumed
+type sessionRegistry struct {
+	sessions map[uuid.UUID]*ProxyClient
+	mutex    sync.Mutex
+}
+
+var sessions = sessionRegistry{
+	sessions: make(map[uuid.UUID]*ProxyClient),
+}
+
+// ============================================
+// Private Methods
+// ============================================
+
+// add registers a resumable session
+func (registry *sessionRegistry) add(client *ProxyClient) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	registry.sessions[client.sessionId] = client
+}
+
+// remove forgets a session. Called when the session is closed
+func (registry *sessionRegistry) remove(client *ProxyClient) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if registry.sessions[client.sessionId] == client {
+		delete(registry.sessions, client.sessionId)
+	}
+}
+
+// claim looks up the session a client wants to resume and detaches the requested lane from its current transport, if any
+// @param resume: the resume request from the client Hello
+// @param settings: the settings of the incoming connection. Must match the session
+// @return the session or an ErrorSessionExpired ErrorPacket if it cannot be resumed
+func (registry *sessionRegistry) claim(resume ResumeRequest, settings ProxyClientSettings) (*ProxyClient, error) {
+	registry.mutex.Lock()
+	session := registry.sessions[resume.SessionId]
+	registry.mutex.Unlock()
+
+	if session == nil ||
+		subtle.ConstantTimeCompare([]byte(session.resumeToken), []byte(resume.Token)) != 1 ||
+		session.Settings.Channel != settings.Channel ||
+		session.Settings.Password != settings.Password ||
+		session.Settings.Token != settings.Token ||
+		session.Settings.Encoding != settings.Encoding {
+		return nil, NewErrorPacket(ErrorSessionExpired, "Session expired or unknown, it cannot be resumed")
+	}
+	lane := session.lane(resume.Lane)
+	if lane == nil {
+		return nil, NewErrorPacket(ErrorSessionExpired, fmt.Sprintf("Session has no lane %d, it cannot be resumed", resume.Lane))
+	}
+
+	if !session.detachTransport(lane, resume.LastReceivedSeq) {
+		return nil, NewErrorPacket(ErrorSessionExpired, "Session can no longer be resumed, too much data was lost")
+	}
+	return session, nil
+}
+
+// newResumeToken generates the secret a client presents to resume its session
+func newResumeToken() (string, error) {
+	token := make([]byte, 32)
+	_, err := rand.Read(token)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+)
+
+// default port of the raw tls transport, used when a gopher+tls:// url does not specify one
+const DefaultTlsPort = "8443"
+
+// AcceptTlsConnection reads the ConnectRequest a client sends first on the raw tls transport
+// @param conn: the accepted tls connection
+// @return the transport to hand to AcceptTransport once the request is validated
+func AcceptTlsConnection(conn net.Conn) (Transport, ConnectRequest, error) {
+	transport := newTlsTransport(conn)
+
+	// also bounds the tls handshake, which happens on the first read
+	transport.SetReadDeadline(time.Now().Add(config.HandshakeTimeout))
+	message, err := transport.ReadMessage()
+	transport.SetReadDeadline(time.Time{})
+	if err != nil {
+		return nil, ConnectRequest{}, err
+	}
+
+	var request ConnectRequest
+	err = json.Unmarshal(message, &request)
+	if err != nil {
+		return nil, ConnectRequest{}, NewProtocolError(fmt.Sprintf("invalid connect request: %s", err))
+	}
+	return transport, request, nil
+}
+
+// dialTls opens a raw tls connection to the proxy server and sends the ConnectRequest
+func dialTls(url url.URL, settings ProxyClientSettings) (Transport, error) {
+	address := url.Host
+	if url.Port() == "" {
+		address = net.JoinHostPort(url.Hostname(), DefaultTlsPort)
+	}
+
+	tlsConfig := &tls.Config{}
+	if settings.TlsConfig != nil {
+		tlsConfig = settings.TlsConfig.Clone()
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = url.Hostname()
+	}
+
+	dialer := &net.Dialer{Timeout: config.HandshakeTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	transport := newTlsTransport(conn)
+
+	request, err := json.Marshal(ConnectRequest{
+		Channel:       settings.Channel,
+		ClientName:    settings.Name,
+		Encoding:      settings.Encoding.String(),
+		Authorization: settings.Authorization(),
+	})
+	if err == nil {
+		err = transport.WriteMessage(request)
+	}
+	if err != nil {
+		transport.Close()
+		return nil, err
+	}
+	return transport, nil
+}
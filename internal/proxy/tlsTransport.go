@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"bufio"
+	"net"
+	"time"
+)
+
+// tlsTransport carries packets over a plain tls (or tcp) connection, without HTTP or websocket framing.
+// Messages are framed as described in messageFrame.go
+type tlsTransport struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// ============================================
+// Constructors
+// ============================================
+
+// newTlsTransport wraps an established connection
+func newTlsTransport(conn net.Conn) *tlsTransport {
+	return &tlsTransport{
+		conn:   conn,
+		reader: bufio.NewReaderSize(conn, 64*1024),
+	}
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+func (transport *tlsTransport) ReadMessage() ([]byte, error) {
+	message, err := readMessageFrame(transport.reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(message) == 0 {
+		return nil, ErrTransportShutdown
+	}
+	return message, nil
+}
+
+func (transport *tlsTransport) WriteMessage(message []byte) error {
+	if len(message) == 0 {
+		return NewProtocolError("cannot send an empty message")
+	}
+
+	frame := make([]byte, 0, messageFrameHeaderSize+len(message))
+	_, err := transport.conn.Write(appendMessageFrame(frame, message))
+	return err
+}
+
+func (transport *tlsTransport) SetReadDeadline(deadline time.Time) error {
+	return transport.conn.SetReadDeadline(deadline)
+}
+
+func (transport *tlsTransport) Close() error {
+	return transport.conn.Close()
+}
+
+// Shutdown sends the shutdown notice before closing the connection
+func (transport *tlsTransport) Shutdown() error {
+	transport.conn.SetWriteDeadline(time.Now().Add(transportShutdownTimeout))
+	transport.conn.Write(appendMessageFrame(nil, nil))
+	return transport.conn.Close()
+}
+
+func (transport *tlsTransport) RemoteAddr() net.Addr {
+	return transport.conn.RemoteAddr()
+}
@@ -0,0 +1,30 @@
+package proxy
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// Transport carries encoded packets between the two ends of a ProxyClient, one packet per message.
+// A session may move between transports when it is resumed. See session.go
+type Transport interface {
+	// ReadMessage blocks until the next message arrives.
+	// Returns ErrTransportShutdown if the remote end ended the session on purpose.
+	ReadMessage() ([]byte, error)
+	// WriteMessage sends one message. Not safe for concurrent use
+	WriteMessage(message []byte) error
+	// SetReadDeadline sets the deadline for ReadMessage. The zero value means no deadline
+	SetReadDeadline(deadline time.Time) error
+	// Close drops the connection. The remote end considers the transport lost, not the session ended
+	Close() error
+	// Shutdown tells the remote end the session is over, then closes the connection
+	Shutdown() error
+	RemoteAddr() net.Addr
+}
+
+// ErrTransportShutdown is returned by Transport.ReadMessage once the remote end has shut the transport down
+var ErrTransportShutdown = errors.New("transport shut down by the remote end")
+
+// how long Shutdown waits to deliver its goodbye to the remote end
+const transportShutdownTimeout = 1 * time.Second
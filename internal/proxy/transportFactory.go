@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"errors"
+	"net/url"
+
+	"github.com/CanadianCommander/gopherproxy/internal/logging"
+)
+
+// URL scheme selecting the raw tls transport, e.g. gopher+tls://proxy.example.com:8443
+const TlsScheme = "gopher+tls"
+
+// AcceptTransport performs the server side protocol handshake on a new transport
+// @return the proxy client, and true if the connection resumed an existing session rather than starting a new one
+func AcceptTransport(transport Transport, settings ProxyClientSettings) (*ProxyClient, bool, error) {
+	ack, session, err := serverHandshake(transport, settings)
+	if err != nil {
+		transport.Close()
+		return nil, false, err
+	}
+	if session != nil {
+		return session, true, nil
+	}
+	logging.Get().Infow("Protocol handshake complete",
+		"remoteAddr", transport.RemoteAddr(),
+		"protocolVersion", ack.ProtocolVersion,
+		"capabilities", ack.Capabilities)
+
+	return newProxyClient(transport, settings, ack, nil), false, nil
+}
+
+// RejectTransport tells a client why it cannot connect, then closes the transport
+func RejectTransport(transport Transport, err error) {
+	writeRawPacket(transport, ErrorPacketFromError(err).ToPacket(CriticalError), BinaryEncoding)
+	transport.Shutdown()
+}
+
+// NewOutgoingSocket connects to the proxy server at the given url and performs the protocol handshake.
+// ws:// and wss:// urls connect over a websocket, falling back to http long polling if the websocket fails.
+// http:// and https:// urls use http long polling right away, gopher+tls:// urls the raw tls transport.
+func NewOutgoingSocket(url url.URL, settings ProxyClientSettings) (*ProxyClient, error) {
+	transport, ack, err := dialProxyServer(url, settings, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	redial := func(resume ResumeRequest) (Transport, HelloAckPacket, error) {
+		return dialProxyServer(url, settings, &resume)
+	}
+	return newProxyClient(transport, settings, ack, redial), nil
+}
+
+// dialProxyServer connects to the proxy server and performs the protocol handshake
+// @param resume: the session to resume, or nil to start a new session
+func dialProxyServer(url url.URL, settings ProxyClientSettings, resume *ResumeRequest) (Transport, HelloAckPacket, error) {
+	switch url.Scheme {
+	case TlsScheme:
+		return connectProxyServer(dialTls, url, settings, resume)
+	case "http", "https":
+		return connectProxyServer(dialPoll, url, settings, resume)
+	}
+
+	transport, ack, err := connectProxyServer(dialWebsocket, url, settings, resume)
+	var protocolError *ProtocolError
+	var errorPacket *ErrorPacket
+	if err == nil || errors.As(err, &protocolError) || errors.As(err, &errorPacket) {
+		// connected, or the server itself turned us away
+		return transport, ack, err
+	}
+
+	// something between us and the server, such as an inspection proxy, may be blocking websockets
+	logging.Get().Warnw("Websocket connection failed. Falling back to http long polling", "error", err)
+	transport, ack, pollErr := connectProxyServer(dialPoll, url, settings, resume)
+	if pollErr != nil {
+		return nil, HelloAckPacket{}, errors.Join(err, pollErr)
+	}
+	return transport, ack, nil
+}
+
+// connectProxyServer opens a transport to the proxy server and performs the protocol handshake
+// @param dial: opens the transport
+// @param resume: the session to resume, or nil to start a new session
+func connectProxyServer(dial func(url.URL, ProxyClientSettings) (Transport, error), url url.URL, settings ProxyClientSettings, resume *ResumeRequest) (Transport, HelloAckPacket, error) {
+	transport, err := dial(url, settings)
+	if err != nil {
+		return nil, HelloAckPacket{}, err
+	}
+
+	ack, err := clientHandshake(transport, settings, resume)
+	if err != nil {
+		transport.Close()
+		return nil, HelloAckPacket{}, err
+	}
+	return transport, ack, nil
+}
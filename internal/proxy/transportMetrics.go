@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"github.com/CanadianCommander/gopherproxy/internal/metrics"
+)
+
+// transport names used as metric labels
+const (
+	websocketTransportName = "websocket"
+	pollTransportName      = "poll"
+	tlsTransportName       = "tls"
+)
+
+var transportErrors = metrics.NewCounterVec("gopherproxy_transport_errors_total",
+	"Failed reads and writes on client connections, by transport and operation.",
+	"transport", "operation")
+
+// ============================================
+// Private Methods
+// ============================================
+
+// transportName names the kind of transport for metrics
+func transportName(transport Transport) string {
+	switch transport.(type) {
+	case *websocketTransport:
+		return websocketTransportName
+	case *pollServerTransport, *pollClientTransport:
+		return pollTransportName
+	case *tlsTransport:
+		return tlsTransportName
+	default:
+		return "unknown"
+	}
+}
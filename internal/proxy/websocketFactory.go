@@ -1,7 +1,6 @@
 package proxy
 
 import (
-	"fmt"
 	"net/http"
 	"net/url"
 
@@ -10,42 +9,45 @@ import (
 	"github.com/gorilla/websocket"
 )
 
-func UpgradeConnection(context *gin.Context, settings ProxyClientSettings) (*ProxyClient, error) {
+// UpgradeConnection upgrades an incoming http request to a websocket and performs the protocol handshake
+// @return the proxy client, and true if the connection resumed an existing session rather than starting a new one
+func UpgradeConnection(context *gin.Context, settings ProxyClientSettings) (*ProxyClient, bool, error) {
 
 	var upgrader = websocket.Upgrader{
-		ReadBufferSize:  wsReadBufferSize,
-		WriteBufferSize: wsWriteBufferSize,
+		ReadBufferSize:  config.WebsocketReadBufferSize,
+		WriteBufferSize: config.WebsocketWriteBufferSize,
 	}
 
 	var wsCon, err = upgrader.Upgrade(context.Writer, context.Request, nil)
-	wsCon.SetReadLimit(wsMaxPacketSize)
 	if err != nil {
 		logging.Get().Errorw("Failed to upgrade connection to websocket",
 			"error", err)
-		return nil, err
+		return nil, false, err
 	}
 	logging.Get().Infow("Connection upgraded to websocket",
 		"remoteAddr", context.Request.RemoteAddr)
 
-	return newProxyClient(wsCon, settings), nil
+	return AcceptTransport(newWebsocketTransport(wsCon), settings)
 }
 
-// NewOutgoingSocket creates a new outgoing websocket connection to the given url
-func NewOutgoingSocket(url url.URL, settings ProxyClientSettings) (*ProxyClient, error) {
+// dialWebsocket opens a websocket to the proxy server
+func dialWebsocket(url url.URL, settings ProxyClientSettings) (Transport, error) {
 	dialer := websocket.Dialer{
-		ReadBufferSize:  wsReadBufferSize,
-		WriteBufferSize: wsWriteBufferSize,
+		ReadBufferSize:  config.WebsocketReadBufferSize,
+		WriteBufferSize: config.WebsocketWriteBufferSize,
+		TLSClientConfig: settings.TlsConfig,
 	}
 
 	// set query params
 	query := url.Query()
 	query.Add(ChannelParam, settings.Channel)
 	query.Add(ClientName, settings.Name)
+	query.Add(EncodingParam, settings.Encoding.String())
 	url.RawQuery = query.Encode()
 
-	wsCon, _, err := dialer.Dial(url.String(), http.Header{AuthorizationHeader: []string{fmt.Sprintf("Basic %s", settings.Password)}})
+	wsCon, _, err := dialer.Dial(url.String(), http.Header{AuthorizationHeader: []string{settings.Authorization()}})
 	if err != nil {
 		return nil, err
 	}
-	return newProxyClient(wsCon, settings), nil
+	return newWebsocketTransport(wsCon), nil
 }
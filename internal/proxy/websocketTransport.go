@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// websocketTransport carries packets as binary websocket messages
+type websocketTransport struct {
+	wsCon *websocket.Conn
+}
+
+// ============================================
+// Constructors
+// ============================================
+
+// newWebsocketTransport wraps an established websocket connection
+func newWebsocketTransport(wsCon *websocket.Conn) *websocketTransport {
+	wsCon.SetReadLimit(int64(config.MaxPacketSize))
+	return &websocketTransport{wsCon: wsCon}
+}
+
+// ============================================
+// Public Methods
+// ============================================
+
+// ReadMessage reads the next binary message. Other message types are skipped
+func (transport *websocketTransport) ReadMessage() ([]byte, error) {
+	for {
+		msgType, message, err := transport.wsCon.ReadMessage()
+		var closeError *websocket.CloseError
+		if errors.As(err, &closeError) && closeError.Code != websocket.CloseAbnormalClosure {
+			return nil, fmt.Errorf("%w: %w", ErrTransportShutdown, err)
+		} else if err != nil {
+			return nil, err
+		}
+
+		if msgType == websocket.BinaryMessage {
+			return message, nil
+		}
+	}
+}
+
+func (transport *websocketTransport) WriteMessage(message []byte) error {
+	return transport.wsCon.WriteMessage(websocket.BinaryMessage, message)
+}
+
+func (transport *websocketTransport) SetReadDeadline(deadline time.Time) error {
+	return transport.wsCon.SetReadDeadline(deadline)
+}
+
+func (transport *websocketTransport) Close() error {
+	return transport.wsCon.Close()
+}
+
+// Shutdown sends a websocket close message before closing the connection
+func (transport *websocketTransport) Shutdown() error {
+	transport.wsCon.WriteControl(websocket.CloseMessage, nil, time.Now().Add(transportShutdownTimeout))
+	return transport.wsCon.Close()
+}
+
+func (transport *websocketTransport) RemoteAddr() net.Addr {
+	return transport.wsCon.RemoteAddr()
+}